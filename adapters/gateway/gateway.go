@@ -0,0 +1,400 @@
+// Package gateway 将MCPHost的所有连接聚合为一个MCP服务器
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/longdexin/MCP_Host"
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// 默认的名称分隔符，与MCPClient中 "服务器ID.工具名" 的命名方式一致
+const DefaultSeparator = "."
+
+// Gateway 聚合MCPHost的所有连接，工具、资源和提示以服务器ID为命名空间，调用通过MCPHost转发
+type Gateway struct {
+	host            *MCP_Host.MCPHost
+	mcpServer       *server.MCPServer
+	name            string
+	version         string
+	separator       string
+	refreshInterval time.Duration
+
+	tools     map[string][]mcp.Tool     // 按服务器记录的上游工具
+	resources map[string][]mcp.Resource // 按服务器记录的上游资源
+	prompts   map[string][]mcp.Prompt   // 按服务器记录的上游提示
+	digests   [3]string                 // 上一次发布的工具、资源、提示摘要，未变化时不通知客户端
+	watched   map[string]*client.Client // 按服务器记录已订阅列表变化通知的客户端，断开后移除
+	dirty     map[string]bool           // 通知了列表变化、需要重新加载的服务器
+	mutex     sync.Mutex
+
+	refreshing chan struct{}
+	ctx        context.Context
+	cancel     context.CancelFunc
+}
+
+// Option Gateway的配置选项
+type Option func(*Gateway)
+
+// WithServerInfo 设置网关的服务器名称和版本
+func WithServerInfo(name string, version string) Option {
+	return func(g *Gateway) {
+		g.name = name
+		g.version = version
+	}
+}
+
+// WithSeparator 设置服务器ID与名称之间的分隔符，默认为 "."
+func WithSeparator(separator string) Option {
+	return func(g *Gateway) {
+		g.separator = separator
+	}
+}
+
+// WithRefreshInterval 定期刷新目录，用于发现新连接的服务器，0表示仅在上游通知变化或手动调用Refresh时刷新
+func WithRefreshInterval(interval time.Duration) Option {
+	return func(g *Gateway) {
+		g.refreshInterval = interval
+	}
+}
+
+// New 创建网关，需调用Refresh加载目录
+func New(host *MCP_Host.MCPHost, opts ...Option) *Gateway {
+	ctx, cancel := context.WithCancel(context.Background())
+	g := &Gateway{
+		host:       host,
+		name:       "MCP Host Gateway",
+		version:    "1.0.0",
+		separator:  DefaultSeparator,
+		tools:      make(map[string][]mcp.Tool),
+		resources:  make(map[string][]mcp.Resource),
+		prompts:    make(map[string][]mcp.Prompt),
+		watched:    make(map[string]*client.Client),
+		dirty:      make(map[string]bool),
+		refreshing: make(chan struct{}, 1),
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+
+	g.mcpServer = server.NewMCPServer(g.name, g.version,
+		server.WithToolCapabilities(true),
+		server.WithResourceCapabilities(false, true),
+		server.WithPromptCapabilities(true),
+	)
+
+	go g.refreshLoop()
+	return g
+}
+
+// GetMCPServer 返回聚合后的MCP服务器
+func (g *Gateway) GetMCPServer() *server.MCPServer {
+	return g.mcpServer
+}
+
+// ServeStdio 通过标准输入输出提供服务
+func (g *Gateway) ServeStdio(opts ...server.StdioOption) error {
+	return server.ServeStdio(g.mcpServer, opts...)
+}
+
+// NewSSEServer 创建SSE服务器
+func (g *Gateway) NewSSEServer(opts ...server.SSEOption) *server.SSEServer {
+	return server.NewSSEServer(g.mcpServer, opts...)
+}
+
+// NewStreamableHTTPServer 创建Streamable HTTP服务器
+func (g *Gateway) NewStreamableHTTPServer(opts ...server.StreamableHTTPOption) *server.StreamableHTTPServer {
+	return server.NewStreamableHTTPServer(g.mcpServer, opts...)
+}
+
+// Close 停止后台刷新
+func (g *Gateway) Close() {
+	g.cancel()
+}
+
+// serverCatalog 一次刷新中从一个服务器加载的目录，nil字段表示沿用上一次的结果
+type serverCatalog struct {
+	tools     []mcp.Tool
+	resources []mcp.Resource
+	prompts   []mcp.Prompt
+	conn      *MCP_Host.ServerConnection
+}
+
+// Refresh 从所有服务器重新加载目录，加载过程中不持有锁。
+// 已注册的服务器使用缓存的工具定义，资源和提示仅在首次连接或服务器通知列表变化时重新加载，
+// 定期刷新不会重置其空闲计时；某个服务器加载失败时保留其上一次的目录
+func (g *Gateway) Refresh(ctx context.Context) error {
+	g.mutex.Lock()
+	dirty := g.dirty
+	g.dirty = make(map[string]bool)
+	loadedResources := make(map[string]bool, len(g.resources))
+	for serverID := range g.resources {
+		loadedResources[serverID] = true
+	}
+	loadedPrompts := make(map[string]bool, len(g.prompts))
+	for serverID := range g.prompts {
+		loadedPrompts[serverID] = true
+	}
+	g.mutex.Unlock()
+
+	var errs []error
+	var failed []string
+	serverIDs := g.host.ServerIDs()
+	catalogs := make(map[string]*serverCatalog, len(serverIDs))
+	for _, serverID := range serverIDs {
+		catalog := &serverCatalog{}
+		catalogs[serverID] = catalog
+		passive := g.host.IsRegistered(serverID) && !dirty[serverID]
+
+		if tools, ok := g.host.CachedTools(serverID); passive && ok {
+			catalog.tools = tools
+		} else if toolsResult, err := g.host.CatalogTools(ctx, serverID); err != nil {
+			errs = append(errs, fmt.Errorf("server %s: failed to list tools: %w", serverID, err))
+			failed = append(failed, serverID)
+		} else {
+			catalog.tools = toolsResult.Tools
+		}
+
+		conn, connected := g.host.GetConnection(serverID)
+		if !connected {
+			continue
+		}
+		catalog.conn = conn
+
+		if conn.Capabilities.Resources != nil && (!passive || !loadedResources[serverID]) {
+			if resourcesResult, err := g.host.ListResources(ctx, serverID); err != nil {
+				errs = append(errs, fmt.Errorf("server %s: failed to list resources: %w", serverID, err))
+				failed = append(failed, serverID)
+			} else {
+				catalog.resources = resourcesResult.Resources
+			}
+		}
+		if conn.Capabilities.Prompts != nil && (!passive || !loadedPrompts[serverID]) {
+			if promptsResult, err := g.host.ListPrompts(ctx, serverID); err != nil {
+				errs = append(errs, fmt.Errorf("server %s: failed to list prompts: %w", serverID, err))
+				failed = append(failed, serverID)
+			} else {
+				catalog.prompts = promptsResult.Prompts
+			}
+		}
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	// 加载失败的服务器在下一次刷新时重试
+	for _, serverID := range failed {
+		if dirty[serverID] {
+			g.dirty[serverID] = true
+		}
+	}
+	for serverID, catalog := range catalogs {
+		if catalog.tools != nil {
+			g.tools[serverID] = catalog.tools
+		}
+		if catalog.resources != nil {
+			g.resources[serverID] = catalog.resources
+		}
+		if catalog.prompts != nil {
+			g.prompts[serverID] = catalog.prompts
+		}
+		if catalog.conn != nil {
+			g.watch(serverID, catalog.conn)
+		} else {
+			delete(g.watched, serverID)
+		}
+	}
+
+	// 移除已断开且未注册的服务器
+	for serverID := range g.tools {
+		if catalogs[serverID] == nil {
+			delete(g.tools, serverID)
+		}
+	}
+	for serverID := range g.resources {
+		if catalogs[serverID] == nil {
+			delete(g.resources, serverID)
+		}
+	}
+	for serverID := range g.prompts {
+		if catalogs[serverID] == nil {
+			delete(g.prompts, serverID)
+		}
+	}
+	for serverID := range g.watched {
+		if catalogs[serverID] == nil {
+			delete(g.watched, serverID)
+		}
+	}
+
+	g.publish()
+	return errors.Join(errs...)
+}
+
+// publish 将目录发布到MCP服务器，目录未变化时不做处理
+func (g *Gateway) publish() {
+	var tools []server.ServerTool
+	for serverID, upstream := range g.tools {
+		for _, tool := range upstream {
+			tools = append(tools, server.ServerTool{Tool: g.namespaceTool(serverID, tool), Handler: g.toolHandler(serverID, tool.Name)})
+		}
+	}
+	if digest := digestOf(tools, func(t server.ServerTool) any { return t.Tool }); digest != g.digests[0] {
+		g.digests[0] = digest
+		g.mcpServer.SetTools(tools...)
+	}
+
+	var resources []server.ServerResource
+	for serverID, upstream := range g.resources {
+		for _, resource := range upstream {
+			exposed := resource
+			exposed.URI = g.ResourceURI(serverID, resource.URI)
+			exposed.Name = g.Name(serverID, resource.Name)
+			resources = append(resources, server.ServerResource{Resource: exposed, Handler: g.resourceHandler(serverID, resource.URI, exposed.URI)})
+		}
+	}
+	if digest := digestOf(resources, func(r server.ServerResource) any { return r.Resource }); digest != g.digests[1] {
+		g.digests[1] = digest
+		g.mcpServer.SetResources(resources...)
+	}
+
+	var prompts []server.ServerPrompt
+	for serverID, upstream := range g.prompts {
+		for _, prompt := range upstream {
+			exposed := prompt
+			exposed.Name = g.Name(serverID, prompt.Name)
+			prompts = append(prompts, server.ServerPrompt{Prompt: exposed, Handler: g.promptHandler(serverID, prompt.Name)})
+		}
+	}
+	if digest := digestOf(prompts, func(p server.ServerPrompt) any { return p.Prompt }); digest != g.digests[2] {
+		g.digests[2] = digest
+		g.mcpServer.SetPrompts(prompts...)
+	}
+}
+
+// Name 返回服务器上的工具或提示对外暴露的名称
+func (g *Gateway) Name(serverID string, name string) string {
+	return serverID + g.separator + name
+}
+
+// ResourceURI 返回服务器上的资源对外暴露的URI，形如 "服务器ID+原URI"
+func (g *Gateway) ResourceURI(serverID string, uri string) string {
+	return serverID + "+" + uri
+}
+
+func (g *Gateway) namespaceTool(serverID string, tool mcp.Tool) mcp.Tool {
+	tool.Name = g.Name(serverID, tool.Name)
+	return tool
+}
+
+// toolHandler 将工具调用转发到MCPHost.ExecuteTool
+func (g *Gateway) toolHandler(serverID string, toolName string) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		result, err := g.host.ExecuteTool(ctx, serverID, toolName, request.GetArguments())
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		return result, nil
+	}
+}
+
+// resourceHandler 将资源读取转发到MCPHost.ReadResource，并将返回内容中的URI改写为对外暴露的URI
+func (g *Gateway) resourceHandler(serverID string, uri string, exposedURI string) server.ResourceHandlerFunc {
+	return func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		result, err := g.host.ReadResource(ctx, serverID, uri)
+		if err != nil {
+			return nil, err
+		}
+		contents := make([]mcp.ResourceContents, 0, len(result.Contents))
+		for _, content := range result.Contents {
+			switch c := content.(type) {
+			case mcp.TextResourceContents:
+				if c.URI == uri {
+					c.URI = exposedURI
+				}
+				contents = append(contents, c)
+			case mcp.BlobResourceContents:
+				if c.URI == uri {
+					c.URI = exposedURI
+				}
+				contents = append(contents, c)
+			default:
+				contents = append(contents, content)
+			}
+		}
+		return contents, nil
+	}
+}
+
+// promptHandler 将提示获取转发到MCPHost.GetPrompt
+func (g *Gateway) promptHandler(serverID string, promptName string) server.PromptHandlerFunc {
+	return func(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+		return g.host.GetPrompt(ctx, serverID, promptName, request.Params.Arguments)
+	}
+}
+
+// watch 订阅服务器的列表变化通知，每个客户端只订阅一次，调用方需持有锁
+func (g *Gateway) watch(serverID string, conn *MCP_Host.ServerConnection) {
+	if g.watched[serverID] == conn.Client {
+		return
+	}
+	g.watched[serverID] = conn.Client
+	conn.Client.OnNotification(func(notification mcp.JSONRPCNotification) {
+		switch notification.Method {
+		case mcp.MethodNotificationToolsListChanged,
+			mcp.MethodNotificationResourcesListChanged,
+			mcp.MethodNotificationPromptsListChanged:
+			g.mutex.Lock()
+			g.dirty[serverID] = true
+			g.mutex.Unlock()
+			g.scheduleRefresh()
+		}
+	})
+}
+
+// scheduleRefresh 请求后台刷新，多次请求合并为一次
+func (g *Gateway) scheduleRefresh() {
+	select {
+	case g.refreshing <- struct{}{}:
+	default:
+	}
+}
+
+// refreshLoop 处理刷新请求和定期刷新
+func (g *Gateway) refreshLoop() {
+	var tick <-chan time.Time
+	if g.refreshInterval > 0 {
+		ticker := time.NewTicker(g.refreshInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-g.ctx.Done():
+			return
+		case <-g.refreshing:
+		case <-tick:
+		}
+		g.Refresh(g.ctx)
+	}
+}
+
+// digestOf 计算目录摘要，用于判断目录是否变化
+func digestOf[T any](items []T, definition func(T) any) string {
+	definitions := make(map[string]any, len(items))
+	for _, item := range items {
+		bs, _ := json.Marshal(definition(item))
+		definitions[string(bs)] = struct{}{}
+	}
+	bs, _ := json.Marshal(definitions)
+	return string(bs)
+}
@@ -0,0 +1,270 @@
+package MCP_Host
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// 审计结果摘要的最大长度
+const auditResultSummaryLimit = 512
+
+// AuditEntry 一次工具执行的审计记录
+type AuditEntry struct {
+	Seq            int64          `json:"seq"`                       // 序号，从1开始递增
+	Timestamp      time.Time      `json:"timestamp"`                 // 执行开始时间
+	Principal      string         `json:"principal,omitempty"`       // 触发执行的主体
+	ConversationID string         `json:"conversation_id,omitempty"` // 会话ID
+	Round          int            `json:"round,omitempty"`           // 工具执行轮次
+	Server         string         `json:"server"`                    // 服务器ID
+	Tool           string         `json:"tool"`                      // 工具名称
+	Args           map[string]any `json:"args,omitempty"`            // 调用参数
+	Result         string         `json:"result,omitempty"`          // 结果摘要
+	IsError        bool           `json:"is_error,omitempty"`        // 服务器是否将结果标记为错误
+	Error          string         `json:"error,omitempty"`           // 调用错误
+	LatencyMS      int64          `json:"latency_ms"`                // 耗时（毫秒）
+}
+
+// AuditRecord 写入审计日志的一行，Hash由PrevHash和Entry的原始JSON计算
+type AuditRecord struct {
+	Entry    json.RawMessage `json:"entry"`
+	PrevHash string          `json:"prev_hash"`
+	Hash     string          `json:"hash"`
+}
+
+// AuditSink 审计记录器
+type AuditSink interface {
+	// Record 记录一次工具执行，Seq由实现填充
+	Record(ctx context.Context, entry AuditEntry) error
+	// Close 关闭记录器
+	Close() error
+}
+
+type auditContextKey int
+
+const (
+	auditPrincipalKey auditContextKey = iota
+	auditConversationKey
+	auditRoundKey
+)
+
+// ContextWithPrincipal 在上下文中设置触发工具执行的主体
+func ContextWithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, auditPrincipalKey, principal)
+}
+
+// ContextWithConversationID 在上下文中设置会话ID
+func ContextWithConversationID(ctx context.Context, conversationID string) context.Context {
+	return context.WithValue(ctx, auditConversationKey, conversationID)
+}
+
+// ContextWithRound 在上下文中设置工具执行轮次
+func ContextWithRound(ctx context.Context, round int) context.Context {
+	return context.WithValue(ctx, auditRoundKey, round)
+}
+
+// PrincipalFromContext 获取上下文中的主体
+func PrincipalFromContext(ctx context.Context) string {
+	principal, _ := ctx.Value(auditPrincipalKey).(string)
+	return principal
+}
+
+// ConversationIDFromContext 获取上下文中的会话ID
+func ConversationIDFromContext(ctx context.Context) string {
+	conversationID, _ := ctx.Value(auditConversationKey).(string)
+	return conversationID
+}
+
+// RoundFromContext 获取上下文中的工具执行轮次
+func RoundFromContext(ctx context.Context) int {
+	round, _ := ctx.Value(auditRoundKey).(int)
+	return round
+}
+
+// recordAudit 记录一次工具执行
+func (h *MCPHost) recordAudit(ctx context.Context, serverID string, toolName string, args map[string]any, result *mcp.CallToolResult, callErr error, latency time.Duration) error {
+	entry := AuditEntry{
+		Timestamp:      time.Now().Add(-latency).UTC(),
+		Principal:      PrincipalFromContext(ctx),
+		ConversationID: ConversationIDFromContext(ctx),
+		Round:          RoundFromContext(ctx),
+		Server:         serverID,
+		Tool:           toolName,
+		Args:           h.redactor.RedactArgs(args),
+		LatencyMS:      latency.Milliseconds(),
+	}
+	if callErr != nil {
+		entry.Error = h.redactor.RedactString(callErr.Error())
+	}
+	if result != nil {
+		entry.IsError = result.IsError
+		entry.Result = summarizeToolResult(h.redactor.RedactContent(result.Content), auditResultSummaryLimit)
+	}
+	return h.auditSink.Record(ctx, entry)
+}
+
+// summarizeToolResult 生成工具结果的文本摘要
+func summarizeToolResult(contents []mcp.Content, limit int) string {
+	parts := make([]string, 0, len(contents))
+	for _, content := range contents {
+		switch c := content.(type) {
+		case mcp.TextContent:
+			parts = append(parts, c.Text)
+		case mcp.ImageContent:
+			parts = append(parts, fmt.Sprintf("[image %s]", c.MIMEType))
+		case mcp.AudioContent:
+			parts = append(parts, fmt.Sprintf("[audio %s]", c.MIMEType))
+		case mcp.EmbeddedResource:
+			parts = append(parts, "[resource]")
+		default:
+			parts = append(parts, "[content]")
+		}
+	}
+	summary := strings.Join(parts, "\n")
+	if runes := []rune(summary); len(runes) > limit {
+		summary = string(runes[:limit]) + "..."
+	}
+	return summary
+}
+
+// JSONLAuditSink 以JSONL文件保存审计记录，每条记录与上一条构成哈希链
+type JSONLAuditSink struct {
+	file     *os.File
+	lastHash string
+	seq      int64
+	mutex    sync.Mutex
+}
+
+var _ AuditSink = (*JSONLAuditSink)(nil)
+
+// NewJSONLAuditSink 打开（或创建）审计日志文件，并从已有记录恢复哈希链
+func NewJSONLAuditSink(path string) (*JSONLAuditSink, error) {
+	sink := &JSONLAuditSink{}
+	if err := VerifyAuditLogFunc(path, func(entry AuditEntry, record AuditRecord) {
+		sink.seq = entry.Seq
+		sink.lastHash = record.Hash
+	}); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	sink.file = file
+	return sink, nil
+}
+
+// Record 追加一条审计记录
+func (s *JSONLAuditSink) Record(ctx context.Context, entry AuditEntry) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.file == nil {
+		return errors.New("audit sink is closed")
+	}
+
+	entry.Seq = s.seq + 1
+	entryBytes, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit entry: %w", err)
+	}
+	record := AuditRecord{
+		Entry:    entryBytes,
+		PrevHash: s.lastHash,
+		Hash:     auditHash(s.lastHash, entryBytes),
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit record: %w", err)
+	}
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit record: %w", err)
+	}
+	s.seq = entry.Seq
+	s.lastHash = record.Hash
+	return nil
+}
+
+// Close 关闭审计日志文件
+func (s *JSONLAuditSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// auditHash 计算哈希链中的一环
+func auditHash(prevHash string, entry []byte) string {
+	sum := sha256.New()
+	sum.Write([]byte(prevHash))
+	sum.Write([]byte{'\n'})
+	sum.Write(entry)
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+// VerifyAuditLog 校验审计日志的哈希链，返回第一个被篡改位置的错误
+func VerifyAuditLog(path string) error {
+	return VerifyAuditLogFunc(path, nil)
+}
+
+// VerifyAuditLogFunc 校验审计日志的哈希链，并对每条校验通过的记录调用fn
+func VerifyAuditLogFunc(path string, fn func(entry AuditEntry, record AuditRecord)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	var prevHash string
+	var prevSeq int64
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var record AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return fmt.Errorf("audit log line %d: invalid record: %w", line, err)
+		}
+		if record.PrevHash != prevHash {
+			return fmt.Errorf("audit log line %d: broken chain, prev_hash mismatch", line)
+		}
+		if hash := auditHash(record.PrevHash, record.Entry); hash != record.Hash {
+			return fmt.Errorf("audit log line %d: hash mismatch", line)
+		}
+		var entry AuditEntry
+		if err := json.Unmarshal(record.Entry, &entry); err != nil {
+			return fmt.Errorf("audit log line %d: invalid entry: %w", line, err)
+		}
+		if entry.Seq != prevSeq+1 {
+			return fmt.Errorf("audit log line %d: unexpected seq %d", line, entry.Seq)
+		}
+		if fn != nil {
+			fn(entry, record)
+		}
+		prevHash = record.Hash
+		prevSeq = entry.Seq
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return nil
+}
@@ -4,13 +4,18 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"time"
 
 	"maps"
+	"slices"
 
 	"github.com/mark3labs/mcp-go/client"
 	"github.com/mark3labs/mcp-go/client/transport"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type ConnectionType string
@@ -31,23 +36,70 @@ type ServerConnection struct {
 	ServerInfo   *mcp.InitializeResult
 	Capabilities mcp.ServerCapabilities
 	Connected    bool
+
+	process *stdioProcess // 由MCPHost启动的服务器进程
+	oauth   *OAuthConfig  // OAuth授权配置，重连时复用已注册的客户端和令牌
 }
 
 // MCPHost 管理多个MCP服务器连接
 type MCPHost struct {
 	connections map[string]*ServerConnection
 	mutex       sync.RWMutex
+	auditSink   AuditSink
+	auditStrict bool // 审计记录写入失败时ExecuteTool返回错误
+	observers   []HostObserver
+	redactor    *Redactor
+	toolCache   map[string][]mcp.Tool
+	cacheMutex  sync.RWMutex
+
+	registrations map[string]*serverRegistration
+	idleTimeout   time.Duration
+	parent        *MCPHost      // 上级主机，自身没有的服务器由上级主机提供
+	activity      *hostActivity // 租户主机上正在进行的操作
+	recorder      *Cassette
+
+	tracerProvider trace.TracerProvider
+	propagator     propagation.TextMapPropagator
+}
+
+// HostOption MCPHost的配置选项
+type HostOption func(*MCPHost)
+
+// WithAuditSink 设置工具执行的审计记录器
+func WithAuditSink(sink AuditSink) HostOption {
+	return func(h *MCPHost) {
+		h.auditSink = sink
+	}
+}
+
+// WithAuditFailClosed 审计记录写入失败时ExecuteTool返回错误。默认只通知实现了AuditObserver的观察者并返回工具结果，
+// 因为此时工具已经执行，返回错误可能导致调用方重复执行有副作用的工具
+func WithAuditFailClosed() HostOption {
+	return func(h *MCPHost) {
+		h.auditStrict = true
+	}
 }
 
 // NewMCPHost 创建一个新的MCP Host实例
-func NewMCPHost() *MCPHost {
-	return &MCPHost{
-		connections: make(map[string]*ServerConnection),
+func NewMCPHost(opts ...HostOption) *MCPHost {
+	h := &MCPHost{
+		connections:   make(map[string]*ServerConnection),
+		toolCache:     make(map[string][]mcp.Tool),
+		registrations: make(map[string]*serverRegistration),
+	}
+	for _, opt := range opts {
+		opt(h)
 	}
+	return h
 }
 
 // ConnectSSE 使用SSE传输连接到MCP服务器
 func (h *MCPHost) ConnectSSE(ctx context.Context, serverID string, baseURL string, options ...transport.ClientOption) (*ServerConnection, error) {
+	return h.connectSSE(ctx, serverID, baseURL, nil, options)
+}
+
+// connectSSE 建立SSE连接，oauth不为nil时由传输层附带和刷新令牌
+func (h *MCPHost) connectSSE(ctx context.Context, serverID string, baseURL string, oauth *OAuthConfig, options []transport.ClientOption) (*ServerConnection, error) {
 	h.mutex.RLock()
 	_, exists := h.connections[serverID]
 	h.mutex.RUnlock()
@@ -55,10 +107,15 @@ func (h *MCPHost) ConnectSSE(ctx context.Context, serverID string, baseURL strin
 		return nil, fmt.Errorf("connection with ID %s already exists", serverID)
 	}
 
-	c, err := client.NewSSEMCPClient(baseURL, options...)
+	clientOptions := options
+	if oauth != nil {
+		clientOptions = append(slices.Clone(options), transport.WithOAuth(oauth.transportConfig()))
+	}
+	c, err := client.NewSSEMCPClient(baseURL, clientOptions...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create SSE client: %w", err)
 	}
+	c = h.recordClient(serverID, c)
 
 	if err := c.Start(ctx); err != nil {
 		c.Close()
@@ -87,57 +144,21 @@ func (h *MCPHost) ConnectSSE(ctx context.Context, serverID string, baseURL strin
 		ServerInfo:   serverInfo,
 		Capabilities: serverInfo.Capabilities,
 		Connected:    true,
+		oauth:        oauth,
 	}
 
 	// 将连接添加到映射
 	h.mutex.Lock()
 	h.connections[serverID] = conn
 	h.mutex.Unlock()
+	h.notifyConnectionChanged(serverID, true)
 
 	return conn, nil
 }
 
 // ConnectStdio 使用Stdio传输连接到MCP服务器
 func (h *MCPHost) ConnectStdio(ctx context.Context, serverID string, command string, env []string, args ...string) (*ServerConnection, error) {
-	h.mutex.RLock()
-	_, exists := h.connections[serverID]
-	h.mutex.RUnlock()
-	if exists {
-		return nil, fmt.Errorf("connection with ID %s already exists", serverID)
-	}
-
-	c, err := client.NewStdioMCPClient(command, env, args...)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create stdio client: %w", err)
-	}
-
-	initRequest := mcp.InitializeRequest{}
-	initRequest.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
-	initRequest.Params.ClientInfo = mcp.Implementation{
-		Name:    "MCP Host",
-		Version: "1.0.0",
-	}
-
-	serverInfo, err := c.Initialize(ctx, initRequest)
-	if err != nil {
-		c.Close()
-		return nil, fmt.Errorf("failed to initialize connection: %w", err)
-	}
-
-	conn := &ServerConnection{
-		Type:         StdioConnectionType,
-		Client:       c,
-		ServerID:     serverID,
-		ServerInfo:   serverInfo,
-		Capabilities: serverInfo.Capabilities,
-		Connected:    true,
-	}
-
-	h.mutex.Lock()
-	h.connections[serverID] = conn
-	h.mutex.Unlock()
-
-	return conn, nil
+	return h.ConnectStdioWithOptions(ctx, serverID, command, env, StdioOptions{}, args...)
 }
 
 // ConnectInProcess 使用进程内传输方式连接到MCP服务器
@@ -153,6 +174,7 @@ func (h *MCPHost) ConnectInProcess(ctx context.Context, serverID string, server
 	if err != nil {
 		return nil, fmt.Errorf("failed to create in-process client: %w", err)
 	}
+	c = h.recordClient(serverID, c)
 
 	if err := c.Start(ctx); err != nil {
 		c.Close()
@@ -184,12 +206,16 @@ func (h *MCPHost) ConnectInProcess(ctx context.Context, serverID string, server
 	h.mutex.Lock()
 	h.connections[serverID] = conn
 	h.mutex.Unlock()
+	h.notifyConnectionChanged(serverID, true)
 
 	return conn, nil
 }
 
 // GetConnection 通过ID获取服务器连接
 func (h *MCPHost) GetConnection(serverID string) (*ServerConnection, bool) {
+	if owner := h.owner(serverID); owner != h {
+		return owner.GetConnection(serverID)
+	}
 	h.mutex.RLock()
 	defer h.mutex.RUnlock()
 
@@ -203,6 +229,9 @@ func (h *MCPHost) GetAllConnections() map[string]*ServerConnection {
 	defer h.mutex.RUnlock()
 
 	connections := make(map[string]*ServerConnection, len(h.connections))
+	if h.parent != nil {
+		maps.Copy(connections, h.parent.GetAllConnections())
+	}
 	maps.Copy(connections, h.connections)
 
 	return connections
@@ -210,11 +239,15 @@ func (h *MCPHost) GetAllConnections() map[string]*ServerConnection {
 
 // DisconnectServer 关闭到指定服务器的连接并将其从映射中移除
 func (h *MCPHost) DisconnectServer(serverID string) error {
-	h.mutex.Lock()
-	defer h.mutex.Unlock()
+	return h.disconnect(serverID, nil)
+}
 
+// disconnect 关闭连接，expected不为nil时只在当前连接仍是expected时关闭
+func (h *MCPHost) disconnect(serverID string, expected *ServerConnection) error {
+	h.mutex.Lock()
 	conn, exists := h.connections[serverID]
-	if !exists {
+	if !exists || (expected != nil && conn != expected) {
+		h.mutex.Unlock()
 		return fmt.Errorf("no connection found with ID %s", serverID)
 	}
 
@@ -223,6 +256,9 @@ func (h *MCPHost) DisconnectServer(serverID string) error {
 
 	delete(h.connections, serverID)
 	conn.Connected = false
+	h.mutex.Unlock()
+	conn.process.stop()
+	h.notifyConnectionChanged(serverID, false)
 
 	return err
 }
@@ -230,12 +266,18 @@ func (h *MCPHost) DisconnectServer(serverID string) error {
 // DisconnectAll 关闭所有连接
 func (h *MCPHost) DisconnectAll() {
 	h.mutex.Lock()
-	defer h.mutex.Unlock()
-
+	closed := make([]*ServerConnection, 0, len(h.connections))
 	for id, conn := range h.connections {
 		conn.Client.Close()
 		conn.Connected = false
 		delete(h.connections, id)
+		closed = append(closed, conn)
+	}
+	h.mutex.Unlock()
+
+	for _, conn := range closed {
+		conn.process.stop()
+		h.notifyConnectionChanged(conn.ServerID, false)
 	}
 }
 
@@ -267,19 +309,46 @@ func (h *MCPHost) SetGlobalNotificationHandler(handler func(serverID string, not
 	}
 }
 
+// EnsureConnection 获取可用的服务器连接，已注册但未连接的服务器在此时连接
 func (h *MCPHost) EnsureConnection(ctx context.Context, serverID string) (*ServerConnection, error) {
+	if owner := h.owner(serverID); owner != h {
+		return owner.EnsureConnection(ctx, serverID)
+	}
 	h.mutex.RLock()
 	conn, exists := h.connections[serverID]
+	registration, registered := h.registrations[serverID]
 	h.mutex.RUnlock()
 	if !exists {
-		return nil, fmt.Errorf("no connection found with ID %s", serverID)
+		if !registered {
+			return nil, fmt.Errorf("no connection found with ID %s", serverID)
+		}
+		return h.connectRegistered(ctx, serverID, registration)
 	}
 	err := conn.Client.Ping(ctx)
 	if err != nil {
 		h.DisconnectServer(serverID)
-		switch conn.Type {
-		case SSEConnectionType:
-			conn, err = h.ConnectSSE(ctx, conn.ServerID, conn.BaseURL, conn.Options...)
+		switch {
+		case registered:
+			spanCtx, span := h.startReconnectSpan(ctx, conn)
+			conn, err = h.connectRegistered(spanCtx, serverID, registration)
+			endSpan(span, err)
+			h.notifyReconnected(serverID, err)
+			if err != nil {
+				return nil, fmt.Errorf("can not reconnect with ID %s", serverID)
+			}
+		case conn.Type == SSEConnectionType && conn.oauth != nil:
+			spanCtx, span := h.startReconnectSpan(ctx, conn)
+			conn, err = h.ConnectSSEWithOAuth(spanCtx, conn.ServerID, conn.BaseURL, *conn.oauth, conn.Options...)
+			endSpan(span, err)
+			h.notifyReconnected(serverID, err)
+			if err != nil {
+				return nil, fmt.Errorf("can not reconnect with ID %s", serverID)
+			}
+		case conn.Type == SSEConnectionType:
+			spanCtx, span := h.startReconnectSpan(ctx, conn)
+			conn, err = h.ConnectSSE(spanCtx, conn.ServerID, conn.BaseURL, conn.Options...)
+			endSpan(span, err)
+			h.notifyReconnected(serverID, err)
 			if err != nil {
 				return nil, fmt.Errorf("can not reconnect with ID %s", serverID)
 			}
@@ -290,7 +359,21 @@ func (h *MCPHost) EnsureConnection(ctx context.Context, serverID string) (*Serve
 }
 
 // ExecuteTool 在指定服务器上执行工具
-func (h *MCPHost) ExecuteTool(ctx context.Context, serverID string, toolName string, args map[string]any) (*mcp.CallToolResult, error) {
+func (h *MCPHost) ExecuteTool(ctx context.Context, serverID string, toolName string, args map[string]any) (result *mcp.CallToolResult, err error) {
+	defer h.use()()
+	if owner := h.owner(serverID); owner != h {
+		return owner.ExecuteTool(ctx, serverID, toolName, args)
+	}
+	ctx, span := h.startToolSpan(ctx, serverID, toolName)
+	callStart := time.Now()
+	defer func() {
+		isError := result != nil && result.IsError
+		span.SetAttributes(attribute.Bool(AttrMCPToolIsError, isError))
+		endSpan(span, err)
+		h.notifyToolCallFinished(serverID, toolName, time.Since(callStart), isError, err)
+	}()
+	defer h.acquire(serverID)()
+
 	conn, err := h.EnsureConnection(ctx, serverID)
 	if err != nil {
 		return nil, err
@@ -298,21 +381,82 @@ func (h *MCPHost) ExecuteTool(ctx context.Context, serverID string, toolName str
 	request := mcp.CallToolRequest{}
 	request.Params.Name = toolName
 	request.Params.Arguments = args
-	return conn.Client.CallTool(ctx, request)
+	request.Params.Meta = h.injectTraceMeta(ctx, request.Params.Meta)
+	start := time.Now()
+	result, err = conn.Client.CallTool(ctx, request)
+	if h.auditSink != nil {
+		if auditErr := h.recordAudit(ctx, serverID, toolName, args, result, err, time.Since(start)); auditErr != nil {
+			h.notifyAuditFailed(serverID, toolName, auditErr)
+			if h.auditStrict && err == nil {
+				return result, fmt.Errorf("failed to record audit entry: %w", auditErr)
+			}
+		}
+	}
+	return result, err
 }
 
 // ListTools 列出指定服务器上的所有工具
 func (h *MCPHost) ListTools(ctx context.Context, serverID string) (*mcp.ListToolsResult, error) {
+	defer h.use()()
+	if owner := h.owner(serverID); owner != h {
+		return owner.ListTools(ctx, serverID)
+	}
+	defer h.acquire(serverID)()
 	conn, err := h.EnsureConnection(ctx, serverID)
 	if err != nil {
 		return nil, err
 	}
 	request := mcp.ListToolsRequest{}
-	return conn.Client.ListTools(ctx, request)
+	result, err := conn.Client.ListTools(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	h.cacheMutex.Lock()
+	h.toolCache[serverID] = result.Tools
+	h.cacheMutex.Unlock()
+	return result, nil
+}
+
+// CachedTools 返回最近一次ListTools缓存的工具定义
+func (h *MCPHost) CachedTools(serverID string) ([]mcp.Tool, bool) {
+	if owner := h.owner(serverID); owner != h {
+		return owner.CachedTools(serverID)
+	}
+	h.cacheMutex.RLock()
+	defer h.cacheMutex.RUnlock()
+
+	tools, ok := h.toolCache[serverID]
+	return tools, ok
+}
+
+// GetTool 获取工具定义，优先使用缓存，缓存中不存在时重新列出工具
+func (h *MCPHost) GetTool(ctx context.Context, serverID string, toolName string) (*mcp.Tool, error) {
+	if tools, ok := h.CachedTools(serverID); ok {
+		for i := range tools {
+			if tools[i].Name == toolName {
+				return &tools[i], nil
+			}
+		}
+	}
+	result, err := h.ListTools(ctx, serverID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range result.Tools {
+		if result.Tools[i].Name == toolName {
+			return &result.Tools[i], nil
+		}
+	}
+	return nil, fmt.Errorf("tool %s not found on server %s", toolName, serverID)
 }
 
 // ListResources 列出指定服务器上的所有资源
 func (h *MCPHost) ListResources(ctx context.Context, serverID string) (*mcp.ListResourcesResult, error) {
+	defer h.use()()
+	if owner := h.owner(serverID); owner != h {
+		return owner.ListResources(ctx, serverID)
+	}
+	defer h.acquire(serverID)()
 	conn, err := h.EnsureConnection(ctx, serverID)
 	if err != nil {
 		return nil, err
@@ -323,6 +467,11 @@ func (h *MCPHost) ListResources(ctx context.Context, serverID string) (*mcp.List
 
 // ReadResource 从指定服务器读取资源
 func (h *MCPHost) ReadResource(ctx context.Context, serverID string, uri string) (*mcp.ReadResourceResult, error) {
+	defer h.use()()
+	if owner := h.owner(serverID); owner != h {
+		return owner.ReadResource(ctx, serverID, uri)
+	}
+	defer h.acquire(serverID)()
 	conn, err := h.EnsureConnection(ctx, serverID)
 	if err != nil {
 		return nil, err
@@ -331,3 +480,35 @@ func (h *MCPHost) ReadResource(ctx context.Context, serverID string, uri string)
 	request.Params.URI = uri
 	return conn.Client.ReadResource(ctx, request)
 }
+
+// ListPrompts 列出指定服务器上的所有提示
+func (h *MCPHost) ListPrompts(ctx context.Context, serverID string) (*mcp.ListPromptsResult, error) {
+	defer h.use()()
+	if owner := h.owner(serverID); owner != h {
+		return owner.ListPrompts(ctx, serverID)
+	}
+	defer h.acquire(serverID)()
+	conn, err := h.EnsureConnection(ctx, serverID)
+	if err != nil {
+		return nil, err
+	}
+	request := mcp.ListPromptsRequest{}
+	return conn.Client.ListPrompts(ctx, request)
+}
+
+// GetPrompt 从指定服务器获取提示
+func (h *MCPHost) GetPrompt(ctx context.Context, serverID string, name string, arguments map[string]string) (*mcp.GetPromptResult, error) {
+	defer h.use()()
+	if owner := h.owner(serverID); owner != h {
+		return owner.GetPrompt(ctx, serverID, name, arguments)
+	}
+	defer h.acquire(serverID)()
+	conn, err := h.EnsureConnection(ctx, serverID)
+	if err != nil {
+		return nil, err
+	}
+	request := mcp.GetPromptRequest{}
+	request.Params.Name = name
+	request.Params.Arguments = arguments
+	return conn.Client.GetPrompt(ctx, request)
+}
@@ -0,0 +1,295 @@
+package MCP_Host
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client/transport"
+)
+
+// 执行凭据命令的默认超时时间
+const DefaultExecCredentialTimeout = 30 * time.Second
+
+// CredentialProvider 为到服务器的请求提供请求头，例如短期有效的访问令牌
+type CredentialProvider interface {
+	Headers(ctx context.Context) (map[string]string, error)
+}
+
+// 凭据过期前提前刷新的默认时间
+const DefaultExecCredentialRefreshSkew = 30 * time.Second
+
+// CredentialHeaders 先从每个provider获取一次请求头，任一provider失败时返回错误，避免请求在缺少凭据时发出。
+// 返回的传输选项在每次请求（包括重连）时从providers获取请求头，后面的provider覆盖前面的同名请求头；
+// 之后某个provider获取失败时沿用其上一次成功获取的请求头。provider在锁外调用，慢的provider不会阻塞其他请求
+func CredentialHeaders(ctx context.Context, providers ...CredentialProvider) (transport.ClientOption, error) {
+	last := make([]map[string]string, len(providers))
+	for i, provider := range providers {
+		headers, err := provider.Headers(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("credential provider %d: %w", i, err)
+		}
+		last[i] = headers
+	}
+
+	var mutex sync.Mutex
+	return transport.WithHeaderFunc(func(ctx context.Context) map[string]string {
+		current := make([]map[string]string, len(providers))
+		succeeded := make([]bool, len(providers))
+		for i, provider := range providers {
+			var err error
+			current[i], err = provider.Headers(ctx)
+			succeeded[i] = err == nil
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		headers := make(map[string]string)
+		for i := range providers {
+			if succeeded[i] {
+				last[i] = current[i]
+			}
+			maps.Copy(headers, last[i])
+		}
+		return headers
+	}), nil
+}
+
+// StaticCredentialProvider 固定的请求头
+type StaticCredentialProvider map[string]string
+
+var _ CredentialProvider = StaticCredentialProvider(nil)
+
+// Headers 实现CredentialProvider
+func (p StaticCredentialProvider) Headers(ctx context.Context) (map[string]string, error) {
+	return p, nil
+}
+
+// EnvCredentialProvider 每次请求时读取环境变量作为请求头的值
+type EnvCredentialProvider struct {
+	variable string
+	header   string
+	prefix   string
+}
+
+var _ CredentialProvider = (*EnvCredentialProvider)(nil)
+
+// NewEnvCredentialProvider 创建环境变量凭据，请求头的值为prefix加上环境变量的值，例如 "Bearer "
+func NewEnvCredentialProvider(variable string, header string, prefix string) *EnvCredentialProvider {
+	return &EnvCredentialProvider{variable: variable, header: header, prefix: prefix}
+}
+
+// Headers 实现CredentialProvider
+func (p *EnvCredentialProvider) Headers(ctx context.Context) (map[string]string, error) {
+	value := os.Getenv(p.variable)
+	if value == "" {
+		return nil, fmt.Errorf("environment variable %s is not set", p.variable)
+	}
+	return map[string]string{p.header: p.prefix + value}, nil
+}
+
+// FileCredentialProvider 从文件读取凭据，文件修改后重新读取，适用于由其他进程轮换的令牌文件
+type FileCredentialProvider struct {
+	path   string
+	header string
+	prefix string
+
+	modTime time.Time
+	size    int64
+	value   string
+	mutex   sync.Mutex
+}
+
+var _ CredentialProvider = (*FileCredentialProvider)(nil)
+
+// NewFileCredentialProvider 创建文件凭据，请求头的值为prefix加上去除首尾空白的文件内容
+func NewFileCredentialProvider(path string, header string, prefix string) *FileCredentialProvider {
+	return &FileCredentialProvider{path: path, header: header, prefix: prefix}
+}
+
+// Headers 实现CredentialProvider
+func (p *FileCredentialProvider) Headers(ctx context.Context) (map[string]string, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat credential file: %w", err)
+	}
+	if p.value == "" || !info.ModTime().Equal(p.modTime) || info.Size() != p.size {
+		bs, err := os.ReadFile(p.path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read credential file: %w", err)
+		}
+		value := strings.TrimSpace(string(bs))
+		if value == "" {
+			return nil, fmt.Errorf("credential file %s is empty", p.path)
+		}
+		p.value, p.modTime, p.size = value, info.ModTime(), info.Size()
+	}
+	return map[string]string{p.header: p.prefix + p.value}, nil
+}
+
+// ExecCredentialProvider 执行辅助命令获取凭据。命令的标准输出可以是JSON：
+//
+//	{"headers": {"Authorization": "Bearer ..."}, "expires_in": 3600}
+//
+// 也可以是纯文本令牌，此时作为 "Authorization: Bearer 令牌" 使用。凭据在过期前被缓存，
+// 临近过期时由一个请求执行命令刷新，其他请求在凭据过期前继续使用缓存的凭据
+type ExecCredentialProvider struct {
+	command     string
+	args        []string
+	env         []string
+	timeout     time.Duration
+	cacheTTL    time.Duration
+	refreshSkew time.Duration
+
+	headers      map[string]string
+	refreshAt    time.Time
+	expiresAt    time.Time
+	mutex        sync.Mutex
+	refreshMutex sync.Mutex // 保证同时只有一个请求执行命令
+}
+
+var _ CredentialProvider = (*ExecCredentialProvider)(nil)
+
+// ExecCredentialOption ExecCredentialProvider的配置选项
+type ExecCredentialOption func(*ExecCredentialProvider)
+
+// WithExecCredentialEnv 设置命令额外的环境变量
+func WithExecCredentialEnv(env ...string) ExecCredentialOption {
+	return func(p *ExecCredentialProvider) {
+		p.env = append(p.env, env...)
+	}
+}
+
+// WithExecCredentialTimeout 设置命令的超时时间，默认为30秒
+func WithExecCredentialTimeout(timeout time.Duration) ExecCredentialOption {
+	return func(p *ExecCredentialProvider) {
+		p.timeout = timeout
+	}
+}
+
+// WithExecCredentialCacheTTL 设置输出中没有expires_in时的缓存时间，0表示每次请求都执行命令
+func WithExecCredentialCacheTTL(ttl time.Duration) ExecCredentialOption {
+	return func(p *ExecCredentialProvider) {
+		p.cacheTTL = ttl
+	}
+}
+
+// WithExecCredentialRefreshSkew 设置凭据过期前提前刷新的时间，默认为30秒，不超过有效期的一半
+func WithExecCredentialRefreshSkew(skew time.Duration) ExecCredentialOption {
+	return func(p *ExecCredentialProvider) {
+		p.refreshSkew = skew
+	}
+}
+
+// NewExecCredentialProvider 创建命令凭据
+func NewExecCredentialProvider(command string, args []string, opts ...ExecCredentialOption) *ExecCredentialProvider {
+	p := &ExecCredentialProvider{
+		command:     command,
+		args:        args,
+		timeout:     DefaultExecCredentialTimeout,
+		refreshSkew: DefaultExecCredentialRefreshSkew,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// execCredentialOutput 命令的JSON输出
+type execCredentialOutput struct {
+	Headers   map[string]string `json:"headers"`
+	ExpiresIn int64             `json:"expires_in,omitempty"`
+}
+
+// Headers 实现CredentialProvider
+func (p *ExecCredentialProvider) Headers(ctx context.Context) (map[string]string, error) {
+	headers, valid, fresh := p.cached()
+	if fresh {
+		return headers, nil
+	}
+	if valid {
+		// 凭据仍有效时不等待其他请求的刷新
+		if !p.refreshMutex.TryLock() {
+			return headers, nil
+		}
+	} else {
+		p.refreshMutex.Lock()
+	}
+	defer p.refreshMutex.Unlock()
+
+	// 等待期间可能已被其他请求刷新
+	if headers, valid, fresh = p.cached(); fresh {
+		return headers, nil
+	}
+	refreshed, err := p.run(ctx)
+	if err != nil {
+		if valid {
+			return headers, nil
+		}
+		return nil, err
+	}
+	return refreshed, nil
+}
+
+// cached 返回缓存的凭据，valid表示尚未过期，fresh表示尚未到刷新时间
+func (p *ExecCredentialProvider) cached() (headers map[string]string, valid bool, fresh bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.headers == nil {
+		return nil, false, false
+	}
+	now := time.Now()
+	return p.headers, now.Before(p.expiresAt), now.Before(p.refreshAt)
+}
+
+// run 执行命令获取凭据并更新缓存
+func (p *ExecCredentialProvider) run(ctx context.Context) (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, p.command, p.args...)
+	cmd.Env = append(os.Environ(), p.env...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("credential command failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	ttl := p.cacheTTL
+	trimmed := bytes.TrimSpace(out)
+	var output execCredentialOutput
+	switch {
+	case len(trimmed) == 0:
+		return nil, fmt.Errorf("credential command returned no output")
+	case trimmed[0] == '{':
+		if err := json.Unmarshal(trimmed, &output); err != nil {
+			return nil, fmt.Errorf("failed to parse credential command output: %w", err)
+		}
+		if output.ExpiresIn > 0 {
+			ttl = time.Duration(output.ExpiresIn) * time.Second
+		}
+	default:
+		output.Headers = map[string]string{"Authorization": "Bearer " + string(trimmed)}
+	}
+
+	now := time.Now()
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.headers = output.Headers
+	p.expiresAt = now.Add(ttl)
+	p.refreshAt = p.expiresAt.Add(-min(p.refreshSkew, ttl/2))
+	return p.headers, nil
+}
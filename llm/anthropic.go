@@ -0,0 +1,770 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	DefaultAnthropicBaseURL   = "https://api.anthropic.com" // 默认的Anthropic API地址
+	DefaultAnthropicVersion   = "2023-06-01"                // 默认的anthropic-version请求头
+	DefaultAnthropicModel     = "claude-sonnet-4-5"         // 默认模型
+	DefaultAnthropicMaxTokens = 4096                        // 未指定MaxTokens时使用的最大令牌数
+)
+
+// GenerationInfo中记录提示缓存令牌数的键
+const (
+	GenerationInfoCacheReadTokens     = "cache_read_input_tokens"
+	GenerationInfoCacheCreationTokens = "cache_creation_input_tokens"
+)
+
+// 缓存的思考块数量上限，用于在后续请求中回传工具调用之前的思考
+const anthropicThinkingCacheSize = 256
+
+// AnthropicClient Anthropic Messages API的LLM实现，支持流式输出、工具调用、扩展思考和提示缓存
+type AnthropicClient struct {
+	httpClient     *http.Client
+	apiKey         string
+	baseURL        string
+	version        string
+	model          string
+	maxTokens      int
+	thinkingBudget int
+	promptCaching  bool
+	betas          []string
+	tracer         trace.Tracer
+	observers      []RequestObserver
+
+	// 扩展思考启用时，回传工具调用结果必须同时回传带签名的思考块，按工具调用ID缓存
+	thinking      map[string][]anthropicBlock
+	thinkingOrder []string
+	thinkingMutex sync.Mutex
+}
+
+// AnthropicOption Anthropic客户端的配置选项
+type AnthropicOption func(*anthropicOptions)
+
+type anthropicOptions struct {
+	apiKey         string
+	baseURL        string
+	version        string
+	model          string
+	maxTokens      int
+	thinkingBudget int
+	promptCaching  bool
+	betas          []string
+	httpClient     *http.Client
+	tracerProvider trace.TracerProvider
+	observers      []RequestObserver
+}
+
+var _ LLM = (*AnthropicClient)(nil)
+
+// NewAnthropicClient 创建Anthropic客户端，默认从ANTHROPIC_API_KEY、ANTHROPIC_MODEL和ANTHROPIC_BASE_URL读取配置
+func NewAnthropicClient(opts ...AnthropicOption) (*AnthropicClient, error) {
+	options := &anthropicOptions{
+		baseURL:    DefaultAnthropicBaseURL,
+		version:    DefaultAnthropicVersion,
+		model:      DefaultAnthropicModel,
+		maxTokens:  DefaultAnthropicMaxTokens,
+		httpClient: http.DefaultClient,
+	}
+	if apiKey := os.Getenv("ANTHROPIC_API_KEY"); apiKey != "" {
+		options.apiKey = apiKey
+	}
+	if model := os.Getenv("ANTHROPIC_MODEL"); model != "" {
+		options.model = model
+	}
+	if baseURL := os.Getenv("ANTHROPIC_BASE_URL"); baseURL != "" {
+		options.baseURL = baseURL
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	if options.apiKey == "" {
+		return nil, errors.New("missing Anthropic API key")
+	}
+
+	return &AnthropicClient{
+		httpClient:     options.httpClient,
+		apiKey:         options.apiKey,
+		baseURL:        strings.TrimSuffix(options.baseURL, "/"),
+		version:        options.version,
+		model:          options.model,
+		maxTokens:      options.maxTokens,
+		thinkingBudget: options.thinkingBudget,
+		promptCaching:  options.promptCaching,
+		betas:          options.betas,
+		tracer:         tracerFrom(options.tracerProvider),
+		observers:      options.observers,
+		thinking:       make(map[string][]anthropicBlock),
+	}, nil
+}
+
+// WithAnthropicAPIKey 设置API密钥
+func WithAnthropicAPIKey(apiKey string) AnthropicOption {
+	return func(opts *anthropicOptions) {
+		opts.apiKey = apiKey
+	}
+}
+
+// WithAnthropicModel 设置模型
+func WithAnthropicModel(model string) AnthropicOption {
+	return func(opts *anthropicOptions) {
+		opts.model = model
+	}
+}
+
+// WithAnthropicBaseURL 设置API地址
+func WithAnthropicBaseURL(baseURL string) AnthropicOption {
+	return func(opts *anthropicOptions) {
+		opts.baseURL = baseURL
+	}
+}
+
+// WithAnthropicVersion 设置anthropic-version请求头
+func WithAnthropicVersion(version string) AnthropicOption {
+	return func(opts *anthropicOptions) {
+		opts.version = version
+	}
+}
+
+// WithAnthropicBeta 添加anthropic-beta请求头中的功能
+func WithAnthropicBeta(betas ...string) AnthropicOption {
+	return func(opts *anthropicOptions) {
+		opts.betas = append(opts.betas, betas...)
+	}
+}
+
+// WithAnthropicMaxTokens 设置GenerateOptions未指定MaxTokens时使用的最大令牌数
+func WithAnthropicMaxTokens(maxTokens int) AnthropicOption {
+	return func(opts *anthropicOptions) {
+		opts.maxTokens = maxTokens
+	}
+}
+
+// WithAnthropicThinking 启用扩展思考，budgetTokens为思考可使用的令牌数，思考内容映射到ReasoningContent
+func WithAnthropicThinking(budgetTokens int) AnthropicOption {
+	return func(opts *anthropicOptions) {
+		opts.thinkingBudget = budgetTokens
+	}
+}
+
+// WithAnthropicPromptCaching 启用提示缓存，在系统提示、工具定义和最后一条消息上设置缓存断点
+func WithAnthropicPromptCaching(enabled bool) AnthropicOption {
+	return func(opts *anthropicOptions) {
+		opts.promptCaching = enabled
+	}
+}
+
+// WithAnthropicHTTPClient 设置HTTP客户端
+func WithAnthropicHTTPClient(client *http.Client) AnthropicOption {
+	return func(opts *anthropicOptions) {
+		opts.httpClient = client
+	}
+}
+
+// WithAnthropicTracerProvider 设置链路追踪的TracerProvider，默认使用全局TracerProvider
+func WithAnthropicTracerProvider(provider trace.TracerProvider) AnthropicOption {
+	return func(opts *anthropicOptions) {
+		opts.tracerProvider = provider
+	}
+}
+
+// WithAnthropicRequestObserver 添加LLM请求观察者
+func WithAnthropicRequestObserver(observer RequestObserver) AnthropicOption {
+	return func(opts *anthropicOptions) {
+		opts.observers = append(opts.observers, observer)
+	}
+}
+
+// anthropicBlock Messages API的内容块
+type anthropicBlock struct {
+	Type         string             `json:"type"`
+	Text         string             `json:"text,omitempty"`
+	Thinking     string             `json:"thinking,omitempty"`
+	Signature    string             `json:"signature,omitempty"`
+	Data         string             `json:"data,omitempty"`
+	ID           string             `json:"id,omitempty"`
+	Name         string             `json:"name,omitempty"`
+	Input        json.RawMessage    `json:"input,omitempty"`
+	ToolUseID    string             `json:"tool_use_id,omitempty"`
+	Content      string             `json:"content,omitempty"`
+	CacheControl *anthropicCacheTag `json:"cache_control,omitempty"`
+}
+
+type anthropicCacheTag struct {
+	Type string `json:"type"`
+}
+
+type anthropicMessage struct {
+	Role    string           `json:"role"`
+	Content []anthropicBlock `json:"content"`
+}
+
+type anthropicTool struct {
+	Name         string             `json:"name"`
+	Description  string             `json:"description,omitempty"`
+	InputSchema  any                `json:"input_schema"`
+	CacheControl *anthropicCacheTag `json:"cache_control,omitempty"`
+}
+
+type anthropicThinking struct {
+	Type         string `json:"type"`
+	BudgetTokens int    `json:"budget_tokens"`
+}
+
+type anthropicToolChoice struct {
+	Type                   string `json:"type"`
+	Name                   string `json:"name,omitempty"`
+	DisableParallelToolUse bool   `json:"disable_parallel_tool_use,omitempty"`
+}
+
+type anthropicRequest struct {
+	Model         string               `json:"model"`
+	MaxTokens     int                  `json:"max_tokens"`
+	System        []anthropicBlock     `json:"system,omitempty"`
+	Messages      []anthropicMessage   `json:"messages"`
+	Tools         []anthropicTool      `json:"tools,omitempty"`
+	ToolChoice    *anthropicToolChoice `json:"tool_choice,omitempty"`
+	Temperature   *float32             `json:"temperature,omitempty"`
+	TopP          *float32             `json:"top_p,omitempty"`
+	TopK          int                  `json:"top_k,omitempty"`
+	StopSequences []string             `json:"stop_sequences,omitempty"`
+	Stream        bool                 `json:"stream,omitempty"`
+	Thinking      *anthropicThinking   `json:"thinking,omitempty"`
+}
+
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+type anthropicResponse struct {
+	ID         string           `json:"id"`
+	Model      string           `json:"model"`
+	Role       string           `json:"role"`
+	Content    []anthropicBlock `json:"content"`
+	StopReason string           `json:"stop_reason"`
+	Usage      anthropicUsage   `json:"usage"`
+}
+
+type anthropicError struct {
+	Type  string `json:"type"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Generate 生成文本回复
+func (c *AnthropicClient) Generate(ctx context.Context, messages []Message, options ...GenerateOption) (*Generation, error) {
+	return c.GenerateContent(ctx, messages, options...)
+}
+
+// GenerateContent 使用消息列表生成回复
+func (c *AnthropicClient) GenerateContent(ctx context.Context, messages []Message, options ...GenerateOption) (gen *Generation, err error) {
+	opts := DefaultGenerateOption()
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	ctx, span := startChatSpan(ctx, c.tracer, "anthropic", c.model, opts)
+	start := time.Now()
+	defer func() {
+		setGenerationModel(gen, c.model)
+		endChatSpan(span, c.model, gen, err)
+		notifyRequestFinished(c.observers, "anthropic", c.model, time.Since(start), gen, err)
+	}()
+
+	req, names := c.buildRequest(messages, opts)
+	if req.Stream {
+		return c.handleStreamResponse(ctx, req, names, opts)
+	}
+
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result anthropicResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode anthropic response: %w", err)
+	}
+	return c.toGeneration(result, names), nil
+}
+
+// buildRequest 转换为Messages API请求，返回请求中工具名称到原名称的映射
+func (c *AnthropicClient) buildRequest(messages []Message, opts *GenerateOptions) (*anthropicRequest, map[string]string) {
+	req := &anthropicRequest{
+		Model:         c.model,
+		MaxTokens:     opts.MaxTokens,
+		TopK:          opts.TopK,
+		StopSequences: opts.StopWords,
+		Stream:        opts.StreamingFunc != nil,
+	}
+	if req.MaxTokens <= 0 {
+		req.MaxTokens = c.maxTokens
+	}
+	if c.thinkingBudget > 0 {
+		// 扩展思考不支持设置temperature和top_k，且max_tokens必须大于思考预算
+		req.Thinking = &anthropicThinking{Type: "enabled", BudgetTokens: c.thinkingBudget}
+		req.TopK = 0
+		if req.MaxTokens <= c.thinkingBudget {
+			req.MaxTokens = c.thinkingBudget + c.maxTokens
+		}
+	} else if opts.Temperature > 0 {
+		req.Temperature = &opts.Temperature
+	}
+	if opts.TopP > 0 && c.thinkingBudget == 0 {
+		req.TopP = &opts.TopP
+	}
+
+	names := make(map[string]string, len(opts.Tools))
+	for _, tool := range opts.Tools {
+		if tool.Function == nil {
+			continue
+		}
+		name := sanitizeToolName(tool.Function.Name)
+		names[name] = tool.Function.Name
+		schema := tool.Function.Parameters
+		if schema == nil {
+			schema = map[string]any{"type": "object"}
+		}
+		req.Tools = append(req.Tools, anthropicTool{Name: name, Description: tool.Function.Description, InputSchema: schema})
+	}
+	if len(req.Tools) > 0 {
+		req.ToolChoice = anthropicChoice(opts.ToolChoice)
+		if opts.ParallelToolCalls != nil && !*opts.ParallelToolCalls {
+			if req.ToolChoice == nil {
+				req.ToolChoice = &anthropicToolChoice{Type: "auto"}
+			}
+			req.ToolChoice.DisableParallelToolUse = true
+		}
+	}
+
+	for _, msg := range messages {
+		switch msg.Role {
+		case RoleSystem:
+			if strings.TrimSpace(msg.Content) != "" {
+				req.System = append(req.System, anthropicBlock{Type: "text", Text: msg.Content})
+			}
+		case RoleTool:
+			req.Messages = appendAnthropicMessage(req.Messages, "user", anthropicBlock{Type: "tool_result", ToolUseID: msg.ToolCallId, Content: msg.Content})
+		case RoleAssistant:
+			var blocks []anthropicBlock
+			if len(msg.ToolCalls) > 0 && c.thinkingBudget > 0 {
+				blocks = append(blocks, c.cachedThinking(msg.ToolCalls[0].ID)...)
+			}
+			if strings.TrimSpace(msg.Content) != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: msg.Content})
+			}
+			for _, tc := range msg.ToolCalls {
+				if tc.Function == nil {
+					continue
+				}
+				input := json.RawMessage(tc.Function.Arguments)
+				if !json.Valid(input) {
+					input = json.RawMessage("{}")
+				}
+				blocks = append(blocks, anthropicBlock{Type: "tool_use", ID: tc.ID, Name: sanitizeToolName(tc.Function.Name), Input: input})
+			}
+			req.Messages = appendAnthropicMessage(req.Messages, "assistant", blocks...)
+		default:
+			if strings.TrimSpace(msg.Content) != "" {
+				req.Messages = appendAnthropicMessage(req.Messages, "user", anthropicBlock{Type: "text", Text: msg.Content})
+			}
+		}
+	}
+
+	if c.promptCaching {
+		ephemeral := &anthropicCacheTag{Type: "ephemeral"}
+		if len(req.System) > 0 {
+			req.System[len(req.System)-1].CacheControl = ephemeral
+		}
+		if len(req.Tools) > 0 {
+			req.Tools[len(req.Tools)-1].CacheControl = ephemeral
+		}
+		if len(req.Messages) > 0 {
+			last := req.Messages[len(req.Messages)-1].Content
+			if n := len(last); n > 0 && last[n-1].Type != "thinking" && last[n-1].Type != "redacted_thinking" {
+				last[n-1].CacheControl = ephemeral
+			}
+		}
+	}
+	return req, names
+}
+
+// appendAnthropicMessage 追加内容块，与上一条消息角色相同时合并，例如多个工具结果需要放在同一条用户消息中
+func appendAnthropicMessage(messages []anthropicMessage, role string, blocks ...anthropicBlock) []anthropicMessage {
+	if len(blocks) == 0 {
+		return messages
+	}
+	if n := len(messages); n > 0 && messages[n-1].Role == role {
+		messages[n-1].Content = append(messages[n-1].Content, blocks...)
+		return messages
+	}
+	return append(messages, anthropicMessage{Role: role, Content: blocks})
+}
+
+// anthropicChoice 将OpenAI风格的ToolChoice转换为Anthropic的tool_choice
+func anthropicChoice(choice any) *anthropicToolChoice {
+	switch v := choice.(type) {
+	case string:
+		switch v {
+		case "none":
+			return &anthropicToolChoice{Type: "none"}
+		case "required", "any":
+			return &anthropicToolChoice{Type: "any"}
+		case "auto":
+			return &anthropicToolChoice{Type: "auto"}
+		}
+	case ToolChoice:
+		if v.Function != nil {
+			return &anthropicToolChoice{Type: "tool", Name: sanitizeToolName(v.Function.Name)}
+		}
+	case *ToolChoice:
+		if v != nil && v.Function != nil {
+			return &anthropicToolChoice{Type: "tool", Name: sanitizeToolName(v.Function.Name)}
+		}
+	}
+	return nil
+}
+
+// sanitizeToolName 转换为只包含字母、数字、下划线和连字符的工具名称，"服务器ID.工具名" 中的 "." 转换为 "__"
+func sanitizeToolName(name string) string {
+	var sb strings.Builder
+	for _, r := range name {
+		switch {
+		case r == '.':
+			sb.WriteString("__")
+		case r == '_' || r == '-' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9'):
+			sb.WriteRune(r)
+		default:
+			sb.WriteRune('_')
+		}
+	}
+	sanitized := sb.String()
+	if len(sanitized) > 64 {
+		sanitized = sanitized[:64]
+	}
+	return sanitized
+}
+
+// do 发送请求，非2xx响应转换为错误
+func (c *AnthropicClient) do(ctx context.Context, req *anthropicRequest) (*http.Response, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal anthropic request: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/v1/messages", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-api-key", c.apiKey)
+	httpReq.Header.Set("anthropic-version", c.version)
+	if len(c.betas) > 0 {
+		httpReq.Header.Set("anthropic-beta", strings.Join(c.betas, ","))
+	}
+	if req.Stream {
+		httpReq.Header.Set("Accept", "text/event-stream")
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send anthropic request: %w", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		bs, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		var apiErr anthropicError
+		if json.Unmarshal(bs, &apiErr) == nil && apiErr.Error.Message != "" {
+			return nil, fmt.Errorf("anthropic: %s: %s (status %d)", apiErr.Error.Type, apiErr.Error.Message, resp.StatusCode)
+		}
+		return nil, fmt.Errorf("anthropic: unexpected status code %d: %s", resp.StatusCode, strings.TrimSpace(string(bs)))
+	}
+	return resp, nil
+}
+
+// toGeneration 将非流式响应转换为Generation
+func (c *AnthropicClient) toGeneration(resp anthropicResponse, names map[string]string) *Generation {
+	gen := &Generation{
+		Role:           openai.ChatMessageRoleAssistant,
+		StopReason:     anthropicStopReason(resp.StopReason),
+		GenerationInfo: make(map[string]any),
+	}
+	setGenerationModel(gen, resp.Model)
+	var content, reasoning strings.Builder
+	var thinking []anthropicBlock
+	for _, block := range resp.Content {
+		switch block.Type {
+		case "text":
+			content.WriteString(block.Text)
+		case "thinking":
+			reasoning.WriteString(block.Thinking)
+			thinking = append(thinking, block)
+		case "redacted_thinking":
+			thinking = append(thinking, block)
+		case "tool_use":
+			gen.ToolCalls = append(gen.ToolCalls, ToolCall{
+				ID:       block.ID,
+				Type:     string(openai.ToolTypeFunction),
+				Function: &FunctionCall{Name: originalToolName(names, block.Name), Arguments: string(block.Input)},
+			})
+		}
+	}
+	gen.Content = strings.TrimSpace(content.String())
+	gen.ReasoningContent = strings.TrimSpace(reasoning.String())
+	c.finishGeneration(gen, thinking, resp.Usage)
+	return gen
+}
+
+// finishGeneration 设置用量和Messages，并缓存工具调用之前的思考块
+func (c *AnthropicClient) finishGeneration(gen *Generation, thinking []anthropicBlock, usage anthropicUsage) {
+	gen.Usage = &Usage{
+		PromptTokens:     usage.InputTokens + usage.CacheCreationInputTokens + usage.CacheReadInputTokens,
+		CompletionTokens: usage.OutputTokens,
+	}
+	gen.Usage.TotalTokens = gen.Usage.PromptTokens + gen.Usage.CompletionTokens
+	if usage.CacheReadInputTokens > 0 {
+		gen.GenerationInfo[GenerationInfoCacheReadTokens] = usage.CacheReadInputTokens
+	}
+	if usage.CacheCreationInputTokens > 0 {
+		gen.GenerationInfo[GenerationInfoCacheCreationTokens] = usage.CacheCreationInputTokens
+	}
+
+	gen.Messages = append(gen.Messages, assistantMessage(gen))
+
+	if len(thinking) > 0 && len(gen.ToolCalls) > 0 {
+		c.cacheThinking(gen.ToolCalls[0].ID, thinking)
+	}
+}
+
+func (c *AnthropicClient) cacheThinking(toolCallID string, blocks []anthropicBlock) {
+	c.thinkingMutex.Lock()
+	defer c.thinkingMutex.Unlock()
+
+	if _, exists := c.thinking[toolCallID]; !exists {
+		c.thinkingOrder = append(c.thinkingOrder, toolCallID)
+	}
+	c.thinking[toolCallID] = blocks
+	for len(c.thinkingOrder) > anthropicThinkingCacheSize {
+		delete(c.thinking, c.thinkingOrder[0])
+		c.thinkingOrder = c.thinkingOrder[1:]
+	}
+}
+
+func (c *AnthropicClient) cachedThinking(toolCallID string) []anthropicBlock {
+	c.thinkingMutex.Lock()
+	defer c.thinkingMutex.Unlock()
+
+	return c.thinking[toolCallID]
+}
+
+// anthropicStopReason 转换为OpenAI的结束原因
+func anthropicStopReason(reason string) string {
+	switch reason {
+	case "end_turn", "stop_sequence":
+		return string(openai.FinishReasonStop)
+	case "tool_use":
+		return string(openai.FinishReasonToolCalls)
+	case "max_tokens":
+		return string(openai.FinishReasonLength)
+	default:
+		return reason
+	}
+}
+
+// originalToolName 将请求中的工具名称还原为原名称
+func originalToolName(names map[string]string, name string) string {
+	if original, ok := names[name]; ok {
+		return original
+	}
+	return name
+}
+
+// anthropicStreamEvent 流式响应中的事件
+type anthropicStreamEvent struct {
+	Type         string             `json:"type"`
+	Index        int                `json:"index"`
+	Message      *anthropicResponse `json:"message,omitempty"`
+	ContentBlock *anthropicBlock    `json:"content_block,omitempty"`
+	Delta        struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		Thinking    string `json:"thinking"`
+		Signature   string `json:"signature"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage *anthropicUsage `json:"usage,omitempty"`
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// handleStreamResponse 处理流式响应，增量以OpenAI的格式传给StreamingFunc
+func (c *AnthropicClient) handleStreamResponse(ctx context.Context, req *anthropicRequest, names map[string]string, opts *GenerateOptions) (*Generation, error) {
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	gen := &Generation{
+		Role:           openai.ChatMessageRoleAssistant,
+		GenerationInfo: make(map[string]any),
+	}
+	var usage anthropicUsage
+	var content, reasoning strings.Builder
+	blocks := make(map[int]*anthropicBlock)
+	arguments := make(map[int]*strings.Builder)
+	toolIndexes := make(map[int]int) // 内容块索引到工具调用索引
+	var order []int
+
+	emit := func(delta openai.ChatCompletionStreamChoiceDelta) error {
+		if opts.StreamingFunc == nil || opts.DisableStreamingFunc {
+			return nil
+		}
+		if err := opts.StreamingFunc(ctx, &delta, nil, 0); err != nil {
+			return fmt.Errorf("streaming function returned error: %w", err)
+		}
+		return nil
+	}
+	// finish 根据已接收的内容块完成生成结果，流被取消或中断时也返回已接收的部分
+	finish := func() *Generation {
+		var thinking []anthropicBlock
+		for _, index := range order {
+			block := blocks[index]
+			switch block.Type {
+			case "thinking", "redacted_thinking":
+				thinking = append(thinking, *block)
+			case "tool_use":
+				args := arguments[index].String()
+				if args == "" {
+					args = "{}"
+				}
+				gen.ToolCalls = append(gen.ToolCalls, ToolCall{
+					ID:       block.ID,
+					Type:     string(openai.ToolTypeFunction),
+					Function: &FunctionCall{Name: originalToolName(names, block.Name), Arguments: args},
+				})
+			}
+		}
+		gen.Content = strings.TrimSpace(content.String())
+		gen.ReasoningContent = strings.TrimSpace(reasoning.String())
+		c.finishGeneration(gen, thinking, usage)
+		return gen
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		data, ok := strings.CutPrefix(line, "data:")
+		if !ok {
+			continue
+		}
+		var event anthropicStreamEvent
+		if err := json.Unmarshal([]byte(strings.TrimSpace(data)), &event); err != nil {
+			return nil, fmt.Errorf("failed to decode anthropic stream event: %w", err)
+		}
+
+		switch event.Type {
+		case "message_start":
+			if event.Message != nil {
+				usage = event.Message.Usage
+				setGenerationModel(gen, event.Message.Model)
+			}
+		case "content_block_start":
+			if event.ContentBlock == nil {
+				continue
+			}
+			block := *event.ContentBlock
+			blocks[event.Index] = &block
+			order = append(order, event.Index)
+			if block.Type == "tool_use" {
+				index := len(toolIndexes)
+				toolIndexes[event.Index] = index
+				arguments[event.Index] = &strings.Builder{}
+				name := originalToolName(names, block.Name)
+				if err := emit(openai.ChatCompletionStreamChoiceDelta{ToolCalls: []openai.ToolCall{{
+					Index:    &index,
+					ID:       block.ID,
+					Type:     openai.ToolTypeFunction,
+					Function: openai.FunctionCall{Name: name},
+				}}}); err != nil {
+					return finish(), err
+				}
+			}
+		case "content_block_delta":
+			block := blocks[event.Index]
+			if block == nil {
+				continue
+			}
+			switch event.Delta.Type {
+			case "text_delta":
+				content.WriteString(event.Delta.Text)
+				if err := emit(openai.ChatCompletionStreamChoiceDelta{Content: event.Delta.Text}); err != nil {
+					return finish(), err
+				}
+			case "thinking_delta":
+				block.Thinking += event.Delta.Thinking
+				reasoning.WriteString(event.Delta.Thinking)
+				if err := emit(openai.ChatCompletionStreamChoiceDelta{ReasoningContent: event.Delta.Thinking}); err != nil {
+					return finish(), err
+				}
+			case "signature_delta":
+				block.Signature += event.Delta.Signature
+			case "input_json_delta":
+				arguments[event.Index].WriteString(event.Delta.PartialJSON)
+				index := toolIndexes[event.Index]
+				if err := emit(openai.ChatCompletionStreamChoiceDelta{ToolCalls: []openai.ToolCall{{
+					Index:    &index,
+					Function: openai.FunctionCall{Arguments: event.Delta.PartialJSON},
+				}}}); err != nil {
+					return finish(), err
+				}
+			}
+		case "message_delta":
+			if event.Delta.StopReason != "" {
+				gen.StopReason = anthropicStopReason(event.Delta.StopReason)
+			}
+			if event.Usage != nil {
+				usage.OutputTokens = event.Usage.OutputTokens
+			}
+		case "error":
+			if event.Error != nil {
+				return nil, fmt.Errorf("anthropic: %s: %s", event.Error.Type, event.Error.Message)
+			}
+			return nil, errors.New("anthropic: stream error")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, context.Canceled) {
+			return finish(), nil
+		}
+		return nil, fmt.Errorf("error receiving from stream: %w", err)
+	}
+	return finish(), nil
+}
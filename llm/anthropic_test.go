@@ -0,0 +1,244 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// newAnthropicTestClient 启动模拟Messages API的服务器，handle收到解码后的请求并写入响应
+func newAnthropicTestClient(t *testing.T, handle func(t *testing.T, req anthropicRequest, w http.ResponseWriter), opts ...AnthropicOption) *AnthropicClient {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if got := r.Header.Get("x-api-key"); got != "test-key" {
+			t.Errorf("x-api-key = %q", got)
+		}
+		if got := r.Header.Get("anthropic-version"); got != DefaultAnthropicVersion {
+			t.Errorf("anthropic-version = %q", got)
+		}
+		var req anthropicRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		handle(t, req, w)
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := NewAnthropicClient(append([]AnthropicOption{
+		WithAnthropicAPIKey("test-key"),
+		WithAnthropicBaseURL(server.URL),
+		WithAnthropicModel("claude-test"),
+	}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestAnthropicGenerateContent(t *testing.T) {
+	client := newAnthropicTestClient(t, func(t *testing.T, req anthropicRequest, w http.ResponseWriter) {
+		if req.Model != "claude-test" || req.Stream {
+			t.Errorf("model = %q, stream = %v", req.Model, req.Stream)
+		}
+		if len(req.System) != 1 || req.System[0].Text != "be brief" || req.System[0].CacheControl == nil {
+			t.Errorf("system = %+v", req.System)
+		}
+		if len(req.Tools) != 2 || req.Tools[0].Name != "weather__forecast" || req.Tools[1].Name != "files__read_file" {
+			t.Fatalf("tools = %+v", req.Tools)
+		}
+		if req.Tools[0].CacheControl != nil || req.Tools[1].CacheControl == nil {
+			t.Errorf("cache_control should only be set on the last tool")
+		}
+
+		// user, assistant(tool_use x2), user(tool_result x2 + text)
+		if len(req.Messages) != 3 {
+			t.Fatalf("messages = %+v", req.Messages)
+		}
+		assistant := req.Messages[1]
+		if assistant.Role != "assistant" || len(assistant.Content) != 2 || assistant.Content[0].Type != "tool_use" || assistant.Content[0].Name != "weather__forecast" {
+			t.Errorf("assistant = %+v", assistant)
+		}
+		if string(assistant.Content[1].Input) != "{}" {
+			t.Errorf("invalid arguments should be sent as {}, got %s", assistant.Content[1].Input)
+		}
+		results := req.Messages[2]
+		if results.Role != "user" || len(results.Content) != 3 {
+			t.Fatalf("tool results should be merged into one user message: %+v", results)
+		}
+		for i, id := range []string{"call_1", "call_2"} {
+			if block := results.Content[i]; block.Type != "tool_result" || block.ToolUseID != id {
+				t.Errorf("block %d = %+v", i, block)
+			}
+		}
+		if last := results.Content[2]; last.Type != "text" || last.CacheControl == nil {
+			t.Errorf("last block = %+v", last)
+		}
+
+		fmt.Fprint(w, `{"id":"msg_1","model":"claude-test-20250101","role":"assistant","stop_reason":"tool_use",
+			"content":[{"type":"text","text":"checking "},{"type":"tool_use","id":"toolu_1","name":"weather__forecast","input":{"city":"Paris"}}],
+			"usage":{"input_tokens":10,"output_tokens":5,"cache_read_input_tokens":100,"cache_creation_input_tokens":20}}`)
+	}, WithAnthropicPromptCaching(true))
+
+	messages := []Message{
+		*NewSystemMessage("", "be brief"),
+		*NewUserMessage("", "weather?"),
+		*NewAssistantMessage("", "", []ToolCall{
+			{ID: "call_1", Type: "function", Function: &FunctionCall{Name: "weather.forecast", Arguments: `{"city":"Paris"}`}},
+			{ID: "call_2", Type: "function", Function: &FunctionCall{Name: "files.read_file", Arguments: `not json`}},
+		}),
+		*NewToolMessage("call_1", "sunny"),
+		*NewToolMessage("call_2", "contents"),
+		*NewUserMessage("", "and tomorrow?"),
+	}
+	tools := []Tool{
+		{Type: "function", Function: &FunctionDefinition{Name: "weather.forecast", Parameters: map[string]any{"type": "object"}}},
+		{Type: "function", Function: &FunctionDefinition{Name: "files.read_file"}},
+	}
+	gen, err := client.GenerateContent(context.Background(), messages, WithTools(tools))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if gen.Content != "checking" || gen.StopReason != string(openai.FinishReasonToolCalls) {
+		t.Errorf("content = %q, stop reason = %q", gen.Content, gen.StopReason)
+	}
+	if len(gen.ToolCalls) != 1 || gen.ToolCalls[0].Function.Name != "weather.forecast" || gen.ToolCalls[0].Function.Arguments != `{"city":"Paris"}` {
+		t.Fatalf("tool calls = %+v", gen.ToolCalls)
+	}
+	if gen.Usage == nil || gen.Usage.PromptTokens != 130 || gen.Usage.CompletionTokens != 5 || gen.Usage.TotalTokens != 135 {
+		t.Errorf("usage = %+v", gen.Usage)
+	}
+	if gen.GenerationInfo[GenerationInfoCacheReadTokens] != 100 || gen.GenerationInfo[GenerationInfoModel] != "claude-test-20250101" {
+		t.Errorf("generation info = %+v", gen.GenerationInfo)
+	}
+	if len(gen.Messages) != 1 || len(gen.Messages[0].ToolCalls) != 1 || gen.Messages[0].ToolCalls[0].Function.Name != "weather.forecast" {
+		t.Errorf("messages = %+v", gen.Messages)
+	}
+}
+
+func TestAnthropicThinkingSignatureCache(t *testing.T) {
+	requests := 0
+	client := newAnthropicTestClient(t, func(t *testing.T, req anthropicRequest, w http.ResponseWriter) {
+		requests++
+		if req.Thinking == nil || req.Thinking.BudgetTokens != 1024 || req.Temperature != nil {
+			t.Errorf("thinking = %+v, temperature = %v", req.Thinking, req.Temperature)
+		}
+		if req.MaxTokens <= 1024 {
+			t.Errorf("max_tokens %d must exceed the thinking budget", req.MaxTokens)
+		}
+		if requests == 1 {
+			fmt.Fprint(w, `{"role":"assistant","stop_reason":"tool_use","content":[
+				{"type":"thinking","thinking":"need weather","signature":"sig-1"},
+				{"type":"tool_use","id":"toolu_1","name":"weather__forecast","input":{}}]}`)
+			return
+		}
+		assistant := req.Messages[1]
+		if len(assistant.Content) != 2 || assistant.Content[0].Type != "thinking" || assistant.Content[0].Signature != "sig-1" {
+			t.Errorf("thinking block was not sent back before tool_use: %+v", assistant.Content)
+		}
+		fmt.Fprint(w, `{"role":"assistant","stop_reason":"end_turn","content":[{"type":"text","text":"sunny"}]}`)
+	}, WithAnthropicThinking(1024))
+
+	messages := []Message{*NewUserMessage("", "weather?")}
+	gen, err := client.GenerateContent(context.Background(), messages, WithTemperature(0.5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gen.ReasoningContent != "need weather" || len(gen.ToolCalls) != 1 {
+		t.Fatalf("generation = %+v", gen)
+	}
+	messages = append(messages, *NewAssistantMessage("", "", gen.ToolCalls), *NewToolMessage("toolu_1", "sunny"))
+	if _, err := client.GenerateContent(context.Background(), messages); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 2 {
+		t.Errorf("requests = %d", requests)
+	}
+}
+
+func TestAnthropicStream(t *testing.T) {
+	events := []string{
+		`{"type":"message_start","message":{"model":"claude-test-20250101","usage":{"input_tokens":12}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"thinking"}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"hmm"}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"signature_delta","signature":"sig"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"text"}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"Let me "}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"check."}}`,
+		`{"type":"content_block_start","index":2,"content_block":{"type":"tool_use","id":"toolu_1","name":"weather__forecast"}}`,
+		`{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"{\"city\":"}}`,
+		`{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"\"Paris\"}"}}`,
+		`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":7}}`,
+		`{"type":"message_stop"}`,
+	}
+	client := newAnthropicTestClient(t, func(t *testing.T, req anthropicRequest, w http.ResponseWriter) {
+		if !req.Stream {
+			t.Error("stream should be set when a streaming function is given")
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range events {
+			var typ struct {
+				Type string `json:"type"`
+			}
+			json.Unmarshal([]byte(event), &typ)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", typ.Type, event)
+		}
+	})
+
+	var content, reasoning, arguments strings.Builder
+	var toolName string
+	streaming := func(ctx context.Context, delta *openai.ChatCompletionStreamChoiceDelta, _ []MCPToolExecutionResult, _ int) error {
+		content.WriteString(delta.Content)
+		reasoning.WriteString(delta.ReasoningContent)
+		for _, tc := range delta.ToolCalls {
+			toolName += tc.Function.Name
+			arguments.WriteString(tc.Function.Arguments)
+		}
+		return nil
+	}
+	tools := []Tool{{Type: "function", Function: &FunctionDefinition{Name: "weather.forecast"}}}
+	gen, err := client.GenerateContent(context.Background(), []Message{*NewUserMessage("", "weather?")}, WithTools(tools), WithStreamingFunc(streaming))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if content.String() != "Let me check." || reasoning.String() != "hmm" || toolName != "weather.forecast" || arguments.String() != `{"city":"Paris"}` {
+		t.Errorf("streamed content = %q, reasoning = %q, tool = %q, arguments = %q", content.String(), reasoning.String(), toolName, arguments.String())
+	}
+	if gen.Content != "Let me check." || gen.ReasoningContent != "hmm" || gen.StopReason != string(openai.FinishReasonToolCalls) {
+		t.Errorf("generation = %+v", gen)
+	}
+	if len(gen.ToolCalls) != 1 || gen.ToolCalls[0].ID != "toolu_1" || gen.ToolCalls[0].Function.Name != "weather.forecast" || gen.ToolCalls[0].Function.Arguments != `{"city":"Paris"}` {
+		t.Fatalf("tool calls = %+v", gen.ToolCalls)
+	}
+	if gen.Usage == nil || gen.Usage.PromptTokens != 12 || gen.Usage.CompletionTokens != 7 {
+		t.Errorf("usage = %+v", gen.Usage)
+	}
+	if gen.GenerationInfo[GenerationInfoModel] != "claude-test-20250101" {
+		t.Errorf("model = %v", gen.GenerationInfo[GenerationInfoModel])
+	}
+	if thinking := client.cachedThinking("toolu_1"); len(thinking) != 1 || thinking[0].Signature != "sig" {
+		t.Errorf("cached thinking = %+v", thinking)
+	}
+}
+
+func TestAnthropicErrorResponse(t *testing.T) {
+	client := newAnthropicTestClient(t, func(t *testing.T, req anthropicRequest, w http.ResponseWriter) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"type":"error","error":{"type":"invalid_request_error","message":"max_tokens too large"}}`)
+	})
+	_, err := client.GenerateContent(context.Background(), []Message{*NewUserMessage("", "hi")})
+	if err == nil || !strings.Contains(err.Error(), "invalid_request_error: max_tokens too large (status 400)") {
+		t.Errorf("err = %v", err)
+	}
+}
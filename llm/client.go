@@ -8,8 +8,10 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/sashabaranov/go-openai"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // OpenAIClient OpenAI LLM的实现
@@ -17,19 +19,27 @@ type OpenAIClient struct {
 	client         *openai.Client
 	model          string
 	responseFormat *openai.ChatCompletionResponseFormat
+	tracer         trace.Tracer
+	observers      []RequestObserver
+	retryPolicy    RetryPolicy
+	rateLimiter    *RateLimiter
 }
 
 // OpenAIOption OpenAI客户端的配置选项
 type OpenAIOption func(*openAIOptions)
 
 type openAIOptions struct {
-	token        string
-	model        string
-	baseURL      string
-	organization string
-	apiType      openai.APIType
-	httpClient   *http.Client
-	apiVersion   string
+	token          string
+	model          string
+	baseURL        string
+	organization   string
+	apiType        openai.APIType
+	httpClient     *http.Client
+	apiVersion     string
+	tracerProvider trace.TracerProvider
+	observers      []RequestObserver
+	retryPolicy    RetryPolicy
+	rateLimiter    *RateLimiter
 }
 
 var _ LLM = (*OpenAIClient)(nil)
@@ -37,9 +47,10 @@ var _ LLM = (*OpenAIClient)(nil)
 // NewOpenAIClient 创建一个新的OpenAI LLM客户端
 func NewOpenAIClient(opts ...OpenAIOption) (*OpenAIClient, error) {
 	options := &openAIOptions{
-		apiType:    openai.APITypeOpenAI,
-		httpClient: http.DefaultClient,
-		model:      "gpt-4o",
+		apiType:     openai.APITypeOpenAI,
+		httpClient:  http.DefaultClient,
+		model:       "gpt-4o",
+		retryPolicy: DefaultRetryPolicy,
 	}
 
 	if token := os.Getenv("OPENAI_API_KEY"); token != "" {
@@ -76,9 +87,8 @@ func NewOpenAIClient(opts ...OpenAIOption) (*OpenAIClient, error) {
 	if options.organization != "" {
 		config.OrgID = options.organization
 	}
-	if options.httpClient != nil {
-		config.HTTPClient = options.httpClient
-	}
+	// 读取失败响应中的Retry-After用于重试
+	config.HTTPClient = withRetryAfterTransport(options.httpClient)
 	if options.apiVersion != "" {
 		config.APIVersion = options.apiVersion
 	}
@@ -87,8 +97,12 @@ func NewOpenAIClient(opts ...OpenAIOption) (*OpenAIClient, error) {
 	client := openai.NewClientWithConfig(config)
 
 	return &OpenAIClient{
-		client: client,
-		model:  options.model,
+		client:      client,
+		model:       options.model,
+		tracer:      tracerFrom(options.tracerProvider),
+		observers:   options.observers,
+		retryPolicy: options.retryPolicy,
+		rateLimiter: options.rateLimiter,
 	}, nil
 }
 
@@ -98,12 +112,77 @@ func (c *OpenAIClient) Generate(ctx context.Context, messages []Message, options
 }
 
 // GenerateContent 使用消息列表生成回复
-func (c *OpenAIClient) GenerateContent(ctx context.Context, messages []Message, options ...GenerateOption) (*Generation, error) {
+func (c *OpenAIClient) GenerateContent(ctx context.Context, messages []Message, options ...GenerateOption) (gen *Generation, err error) {
 	opts := DefaultGenerateOption()
 	for _, opt := range options {
 		opt(opts)
 	}
 
+	ctx, span := startChatSpan(ctx, c.tracer, "openai", c.model, opts)
+	start := time.Now()
+	defer func() {
+		setGenerationModel(gen, c.model)
+		endChatSpan(span, c.model, gen, err)
+		notifyRequestFinished(c.observers, "openai", c.model, time.Since(start), gen, err)
+	}()
+
+	return c.generateWithRetry(ctx, messages, opts)
+}
+
+// generateWithRetry 按限流等待后发送请求，可重试的错误按重试策略重试。流式请求只在输出第一个增量之前重试
+func (c *OpenAIClient) generateWithRetry(ctx context.Context, messages []Message, opts *GenerateOptions) (*Generation, error) {
+	holder := &retryAfterHolder{}
+	ctx = context.WithValue(ctx, retryAfterKey{}, holder)
+
+	streamed := false
+	if opts.StreamingFunc != nil {
+		streamingFunc := opts.StreamingFunc
+		attemptOpts := *opts
+		attemptOpts.StreamingFunc = func(ctx context.Context, delta *openai.ChatCompletionStreamChoiceDelta, toolResults []MCPToolExecutionResult, flag int) error {
+			streamed = true
+			return streamingFunc(ctx, delta, toolResults, flag)
+		}
+		opts = &attemptOpts
+	}
+
+	for attempt := 0; ; attempt++ {
+		estimated := 0
+		if c.rateLimiter != nil {
+			estimated = estimateTokens(messages, opts)
+			if err := c.rateLimiter.Wait(ctx, estimated); err != nil {
+				return nil, err
+			}
+		}
+
+		gen, err := c.generateContent(ctx, messages, opts)
+		if c.rateLimiter != nil && gen != nil && gen.Usage != nil && gen.Usage.TotalTokens > 0 {
+			c.rateLimiter.Adjust(estimated, gen.Usage.TotalTokens)
+		}
+		if err == nil {
+			if attempt > 0 {
+				if gen.GenerationInfo == nil {
+					gen.GenerationInfo = make(map[string]any)
+				}
+				gen.GenerationInfo[GenerationInfoRetries] = attempt
+			}
+			return gen, nil
+		}
+		if attempt >= c.retryPolicy.MaxRetries || streamed || !IsRetryableError(err) {
+			return gen, err
+		}
+
+		timer := time.NewTimer(c.retryPolicy.backoff(attempt+1, holder.take()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return gen, err
+		case <-timer.C:
+		}
+	}
+}
+
+// generateContent 根据已解析的选项生成回复
+func (c *OpenAIClient) generateContent(ctx context.Context, messages []Message, opts *GenerateOptions) (*Generation, error) {
 	// 转换消息格式
 	msgs := make([]openai.ChatCompletionMessage, 0, len(messages))
 	for _, msg := range messages {
@@ -221,6 +300,7 @@ func (c *OpenAIClient) GenerateContent(ctx context.Context, messages []Message,
 			choice.Message,
 		},
 	}
+	setGenerationModel(gen, resp.Model)
 
 	// 处理工具调用
 	if len(choice.Message.ToolCalls) > 0 {
@@ -277,6 +357,7 @@ func (c *OpenAIClient) handleStreamResponse(ctx context.Context, req openai.Chat
 			}
 			return nil, fmt.Errorf("error receiving from stream: %w", err)
 		}
+		setGenerationModel(gen, resp.Model)
 
 		if len(resp.Choices) == 0 {
 			// 更新使用情况
@@ -317,12 +398,28 @@ func (c *OpenAIClient) handleStreamResponse(ctx context.Context, req openai.Chat
 	}
 	gen.Content = strings.TrimSpace(contentSb.String())
 	gen.ReasoningContent = strings.TrimSpace(reasoningContentSb.String())
-	gen.Messages = append(gen.Messages, openai.ChatCompletionMessage{
+	gen.Messages = append(gen.Messages, assistantMessage(gen))
+	return gen, nil
+}
+
+// assistantMessage 根据生成结果构造助手消息
+func assistantMessage(gen *Generation) openai.ChatCompletionMessage {
+	message := openai.ChatCompletionMessage{
 		Role:             gen.Role,
 		Content:          gen.Content,
 		ReasoningContent: gen.ReasoningContent,
-	})
-	return gen, nil
+	}
+	for _, tc := range gen.ToolCalls {
+		if tc.Function == nil {
+			continue
+		}
+		message.ToolCalls = append(message.ToolCalls, openai.ToolCall{
+			ID:       tc.ID,
+			Type:     openai.ToolType(tc.Type),
+			Function: openai.FunctionCall{Name: tc.Function.Name, Arguments: tc.Function.Arguments},
+		})
+	}
+	return message
 }
 
 // processToolCallsStream 处理流式工具调用
@@ -413,3 +510,38 @@ func WithHTTPClient(client *http.Client) OpenAIOption {
 		opts.httpClient = client
 	}
 }
+
+// WithTracerProvider 设置链路追踪的TracerProvider，默认使用全局TracerProvider
+func WithTracerProvider(provider trace.TracerProvider) OpenAIOption {
+	return func(opts *openAIOptions) {
+		opts.tracerProvider = provider
+	}
+}
+
+// WithRequestObserver 添加LLM请求观察者，可以多次调用添加多个观察者
+func WithRequestObserver(observer RequestObserver) OpenAIOption {
+	return func(opts *openAIOptions) {
+		opts.observers = append(opts.observers, observer)
+	}
+}
+
+// WithRetryPolicy 设置重试策略，默认为DefaultRetryPolicy，RetryPolicy{}表示不重试
+func WithRetryPolicy(policy RetryPolicy) OpenAIOption {
+	return func(opts *openAIOptions) {
+		opts.retryPolicy = policy
+	}
+}
+
+// WithRateLimit 设置客户端限流，requestsPerMinute或tokensPerMinute为0时不限制该项
+func WithRateLimit(requestsPerMinute int, tokensPerMinute int) OpenAIOption {
+	return func(opts *openAIOptions) {
+		opts.rateLimiter = NewRateLimiter(requestsPerMinute, tokensPerMinute)
+	}
+}
+
+// WithRateLimiter 设置限流器，多个客户端可以共享同一个限流器
+func WithRateLimiter(limiter *RateLimiter) OpenAIOption {
+	return func(opts *openAIOptions) {
+		opts.rateLimiter = limiter
+	}
+}
@@ -0,0 +1,425 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// GenerationInfo中记录上下文裁剪情况的键，值为[]ContextTrimReport
+const GenerationInfoContextTrims = "mcp_context_trims"
+
+// 摘要消息的名称
+const ContextSummaryMessageName = "ContextSummary"
+
+// 默认保留的最近消息数量
+const DefaultKeepRecentMessages = 4
+
+// 生成摘要的默认提示词
+const defaultContextSummaryPrompt = `Summarize the earlier part of the conversation below so that it can replace those messages in the context window.
+Keep every fact, tool result, decision and open question that may be needed to continue the task. Omit greetings and repetition.
+Answer with the summary only, in the language of the conversation.`
+
+// ContextStrategy 上下文超出限制时的裁剪策略
+type ContextStrategy string
+
+const (
+	ContextTruncateToolResults ContextStrategy = "truncate_tool_results" // 截断过长的工具结果
+	ContextDropOldest          ContextStrategy = "drop_oldest"           // 删除最早的未固定消息
+	ContextSummarize           ContextStrategy = "summarize"             // 使用LLM将较早的未固定消息合并为摘要
+)
+
+// TokenEstimator 估计消息的令牌数
+type TokenEstimator interface {
+	EstimateTokens(messages []Message) int
+}
+
+// TokenEstimatorFunc 函数形式的TokenEstimator
+type TokenEstimatorFunc func(messages []Message) int
+
+// EstimateTokens 实现TokenEstimator
+func (f TokenEstimatorFunc) EstimateTokens(messages []Message) int {
+	return f(messages)
+}
+
+// EstimateTokens 粗略估计消息的令牌数：ASCII字符约4个一个令牌，其他字符（如中文）约一个字符一个令牌，每条消息另加4个令牌
+func EstimateTokens(messages []Message) int {
+	tokens := 0
+	for _, msg := range messages {
+		tokens += 4 + estimateTextTokens(msg.Content) + estimateTextTokens(msg.ReasoningContent)
+		for _, tc := range msg.ToolCalls {
+			if tc.Function != nil {
+				tokens += estimateTextTokens(tc.Function.Name) + estimateTextTokens(tc.Function.Arguments)
+			}
+		}
+	}
+	return tokens
+}
+
+func estimateTextTokens(s string) int {
+	ascii, other := 0, 0
+	for _, r := range s {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii+3)/4 + other
+}
+
+// truncateToTokens 截取开头约tokens个令牌的内容
+func truncateToTokens(s string, tokens int) string {
+	budget := tokens * 4
+	for i, r := range s {
+		if r < utf8.RuneSelf {
+			budget--
+		} else {
+			budget -= 4
+		}
+		if budget < 0 {
+			return s[:i]
+		}
+	}
+	return s
+}
+
+// ContextTrimReport 一次请求前的上下文裁剪情况
+type ContextTrimReport struct {
+	Round                int    `json:"round"`                            // 执行轮次，0为第一次请求
+	Limit                int    `json:"limit"`                            // 可用于输入的令牌数
+	TokensBefore         int    `json:"tokens_before"`                    // 裁剪前的估计令牌数
+	TokensAfter          int    `json:"tokens_after"`                     // 裁剪后的估计令牌数
+	TruncatedToolResults int    `json:"truncated_tool_results,omitempty"` // 截断的工具结果数量
+	DroppedMessages      int    `json:"dropped_messages,omitempty"`       // 删除的消息数量
+	SummarizedMessages   int    `json:"summarized_messages,omitempty"`    // 合并为摘要的消息数量
+	Summary              string `json:"summary,omitempty"`                // 摘要内容
+	Usage                *Usage `json:"usage,omitempty"`                  // 生成摘要的用量
+	Model                string `json:"model,omitempty"`                  // 生成摘要使用的模型
+	Exceeded             bool   `json:"exceeded,omitempty"`               // 裁剪后仍超出限制
+}
+
+// ContextManager 在每次请求LLM之前将消息控制在上下文窗口内。系统消息、第一条和最后一条用户消息、
+// 设置了Pinned的消息以及最近的消息不会被删除或摘要
+type ContextManager struct {
+	maxTokens           int
+	estimator           TokenEstimator
+	strategies          []ContextStrategy
+	maxToolResultTokens int
+	keepRecent          int
+	summarizer          LLM
+	summaryPrompt       string
+}
+
+// ContextOption ContextManager的配置选项
+type ContextOption func(*ContextManager)
+
+// NewContextManager 创建上下文管理器，maxTokens为模型的上下文窗口大小，请求的MaxTokens会从中预留。
+// 默认依次使用ContextTruncateToolResults和ContextDropOldest策略
+func NewContextManager(maxTokens int, opts ...ContextOption) *ContextManager {
+	m := &ContextManager{
+		maxTokens:     maxTokens,
+		estimator:     TokenEstimatorFunc(EstimateTokens),
+		strategies:    []ContextStrategy{ContextTruncateToolResults, ContextDropOldest},
+		keepRecent:    DefaultKeepRecentMessages,
+		summaryPrompt: defaultContextSummaryPrompt,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.maxToolResultTokens <= 0 {
+		m.maxToolResultTokens = max(maxTokens/8, 256)
+	}
+	return m
+}
+
+// WithTokenEstimator 设置令牌数估计方式，默认为EstimateTokens
+func WithTokenEstimator(estimator TokenEstimator) ContextOption {
+	return func(m *ContextManager) {
+		m.estimator = estimator
+	}
+}
+
+// WithContextStrategies 设置裁剪策略，按顺序使用直到不超出限制
+func WithContextStrategies(strategies ...ContextStrategy) ContextOption {
+	return func(m *ContextManager) {
+		m.strategies = strategies
+	}
+}
+
+// WithMaxToolResultTokens 设置ContextTruncateToolResults策略中单个工具结果的令牌数上限，默认为上下文窗口的1/8
+func WithMaxToolResultTokens(tokens int) ContextOption {
+	return func(m *ContextManager) {
+		m.maxToolResultTokens = tokens
+	}
+}
+
+// WithKeepRecentMessages 设置不会被删除或摘要的最近消息数量，默认为4
+func WithKeepRecentMessages(n int) ContextOption {
+	return func(m *ContextManager) {
+		m.keepRecent = n
+	}
+}
+
+// WithSummarizer 设置ContextSummarize策略使用的LLM，默认使用MCPClient的LLM
+func WithSummarizer(summarizer LLM) ContextOption {
+	return func(m *ContextManager) {
+		m.summarizer = summarizer
+	}
+}
+
+// WithSummaryPrompt 设置生成摘要的提示词
+func WithSummaryPrompt(prompt string) ContextOption {
+	return func(m *ContextManager) {
+		m.summaryPrompt = prompt
+	}
+}
+
+// WithContextManager 设置上下文管理器，每次请求LLM之前裁剪超出上下文窗口的消息
+func WithContextManager(manager *ContextManager) MCPClientOption {
+	return func(c *MCPClient) {
+		c.contextManager = manager
+	}
+}
+
+// Fit 将消息控制在上下文窗口内，没有裁剪时report为nil。summarizer为ContextSummarize策略的默认LLM
+func (m *ContextManager) Fit(ctx context.Context, messages []Message, opts *GenerateOptions, summarizer LLM) ([]Message, *ContextTrimReport, error) {
+	limit := m.maxTokens
+	if opts.MaxTokens > 0 && opts.MaxTokens < limit {
+		limit -= opts.MaxTokens
+	}
+	tokens := m.estimator.EstimateTokens(messages)
+	if tokens <= limit {
+		return messages, nil, nil
+	}
+
+	resultTag := opts.MCPResultTag
+	if resultTag == "" {
+		resultTag = MCP_DEFAULT_RESULT_TAG
+	}
+	openTag := "<" + resultTag + ">"
+	report := &ContextTrimReport{Limit: limit, TokensBefore: tokens}
+	messages = append([]Message(nil), messages...)
+	for _, strategy := range m.strategies {
+		switch strategy {
+		case ContextTruncateToolResults:
+			messages = m.truncateToolResults(messages, resultTag, report)
+		case ContextDropOldest:
+			messages = m.dropOldest(messages, limit, openTag, report)
+		case ContextSummarize:
+			if m.summarizer != nil {
+				summarizer = m.summarizer
+			}
+			var err error
+			if messages, err = m.summarize(ctx, messages, summarizer, openTag, report); err != nil {
+				return nil, nil, err
+			}
+		}
+		if tokens = m.estimator.EstimateTokens(messages); tokens <= limit {
+			break
+		}
+	}
+	report.TokensAfter = tokens
+	report.Exceeded = tokens > limit
+	return messages, report, nil
+}
+
+// truncateToolResults 截断超过上限的工具结果，文本模式的结果保留结果标签
+func (m *ContextManager) truncateToolResults(messages []Message, resultTag string, report *ContextTrimReport) []Message {
+	open, close := "<"+resultTag+">", "</"+resultTag+">"
+	for i, msg := range messages {
+		if msg.Pinned || !isToolResultMessage(msg, open) {
+			continue
+		}
+		content := strings.TrimSpace(msg.Content)
+		tagged := msg.Role != RoleTool && strings.HasPrefix(content, open) && strings.HasSuffix(content, close)
+		if tagged {
+			content = strings.TrimSuffix(strings.TrimPrefix(content, open), close)
+		}
+		if estimateTextTokens(content) <= m.maxToolResultTokens {
+			continue
+		}
+		truncated := truncateToTokens(content, m.maxToolResultTokens)
+		content = fmt.Sprintf("%s\n...[truncated %d characters]", truncated, utf8.RuneCountInString(content)-utf8.RuneCountInString(truncated))
+		if tagged {
+			content = open + content + "\n" + close
+		}
+		messages[i].Content = content
+		report.TruncatedToolResults++
+	}
+	return messages
+}
+
+// isToolResultMessage 判断是否为工具结果：函数调用模式的工具消息或文本模式中以结果标签开头的用户消息
+func isToolResultMessage(msg Message, openTag string) bool {
+	return msg.Role == RoleTool || msg.Name == ToolResponseMessageName ||
+		(msg.Role == RoleUser && strings.HasPrefix(strings.TrimSpace(msg.Content), openTag))
+}
+
+// contextUnit 裁剪时不可分割的一组消息，例如带工具调用的助手消息及其工具结果
+type contextUnit struct {
+	start, end int
+	pinned     bool
+}
+
+// units 将消息分组并标记固定的组
+func (m *ContextManager) units(messages []Message, openTag string) []contextUnit {
+	firstUser, lastUser := -1, -1
+	for i, msg := range messages {
+		if msg.Role == RoleUser && !isToolResultMessage(msg, openTag) {
+			if firstUser < 0 {
+				firstUser = i
+			}
+			lastUser = i
+		}
+	}
+
+	var units []contextUnit
+	for i := 0; i < len(messages); {
+		end := i + 1
+		if messages[i].Role == RoleAssistant && len(messages[i].ToolCalls) > 0 {
+			for end < len(messages) && messages[end].Role == RoleTool {
+				end++
+			}
+		}
+		unit := contextUnit{start: i, end: end}
+		for j := i; j < end; j++ {
+			msg := messages[j]
+			if msg.Pinned || msg.Role == RoleSystem || j == firstUser || j == lastUser || j >= len(messages)-m.keepRecent {
+				unit.pinned = true
+			}
+		}
+		units = append(units, unit)
+		i = end
+	}
+	return units
+}
+
+// dropOldest 从最早的未固定消息开始删除，直到不超出限制
+func (m *ContextManager) dropOldest(messages []Message, limit int, openTag string, report *ContextTrimReport) []Message {
+	units := m.units(messages, openTag)
+	drop := make([]bool, len(messages))
+	total := m.estimator.EstimateTokens(messages)
+	for _, unit := range units {
+		if total <= limit {
+			break
+		}
+		if unit.pinned {
+			continue
+		}
+		total -= m.estimator.EstimateTokens(messages[unit.start:unit.end])
+		for j := unit.start; j < unit.end; j++ {
+			drop[j] = true
+		}
+		report.DroppedMessages += unit.end - unit.start
+	}
+
+	kept := make([]Message, 0, len(messages))
+	for i, msg := range messages {
+		if !drop[i] {
+			kept = append(kept, msg)
+		}
+	}
+	return kept
+}
+
+// summarize 将最早的一段连续未固定消息合并为一条摘要消息
+func (m *ContextManager) summarize(ctx context.Context, messages []Message, summarizer LLM, openTag string, report *ContextTrimReport) ([]Message, error) {
+	if summarizer == nil {
+		return messages, nil
+	}
+	start, end := -1, -1
+	for _, unit := range m.units(messages, openTag) {
+		if unit.pinned {
+			if start >= 0 {
+				break
+			}
+			continue
+		}
+		if start < 0 {
+			start = unit.start
+		}
+		end = unit.end
+	}
+	if start < 0 {
+		return messages, nil
+	}
+
+	var transcript strings.Builder
+	for _, msg := range messages[start:end] {
+		fmt.Fprintf(&transcript, "[%s]", msg.Role)
+		if msg.Content != "" {
+			fmt.Fprintf(&transcript, " %s", msg.Content)
+		}
+		for _, tc := range msg.ToolCalls {
+			if tc.Function != nil {
+				fmt.Fprintf(&transcript, " (call %s %s)", tc.Function.Name, tc.Function.Arguments)
+			}
+		}
+		transcript.WriteString("\n")
+	}
+	gen, err := summarizer.GenerateContent(ctx, []Message{
+		{Role: RoleSystem, Content: m.summaryPrompt},
+		{Role: RoleUser, Content: transcript.String()},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize context: %w", err)
+	}
+
+	summary := Message{
+		Role:    RoleSystem,
+		Name:    ContextSummaryMessageName,
+		Content: "Summary of earlier conversation:\n" + strings.TrimSpace(gen.Content),
+	}
+	result := make([]Message, 0, len(messages)-(end-start)+1)
+	result = append(result, messages[:start]...)
+	result = append(result, summary)
+	result = append(result, messages[end:]...)
+
+	report.SummarizedMessages += end - start
+	report.Summary = summary.Content
+	report.Usage = gen.Usage
+	report.Model = generationModel(gen)
+	return result, nil
+}
+
+// fitContext 使用上下文管理器裁剪消息并通知裁剪情况，没有裁剪时report为nil
+func (c *MCPClient) fitContext(ctx context.Context, messages []Message, opts *GenerateOptions, round int) ([]Message, *ContextTrimReport, error) {
+	if c.contextManager == nil {
+		return messages, nil, nil
+	}
+	fitted, report, err := c.contextManager.Fit(ctx, messages, opts, c.llm)
+	if err != nil || report == nil {
+		return fitted, nil, err
+	}
+	report.Round = round
+	if opts.StateNotifyFunc != nil {
+		_ = opts.StateNotifyFunc(ctx, MCPExecutionState{
+			Type:  "context_trim",
+			Stage: "complete",
+			Data: map[string]any{
+				"round":                  round,
+				"tokens_before":          report.TokensBefore,
+				"tokens_after":           report.TokensAfter,
+				"dropped_messages":       report.DroppedMessages,
+				"truncated_tool_results": report.TruncatedToolResults,
+				"summarized_messages":    report.SummarizedMessages,
+			},
+		})
+	}
+	return fitted, report, nil
+}
+
+// recordContextTrim 在GenerationInfo中追加裁剪情况，并记录生成摘要的用量
+func (c *MCPClient) recordContextTrim(gen *Generation, opts *GenerateOptions, report *ContextTrimReport) {
+	if report == nil {
+		return
+	}
+	if gen.GenerationInfo == nil {
+		gen.GenerationInfo = make(map[string]any)
+	}
+	trims, _ := gen.GenerationInfo[GenerationInfoContextTrims].([]ContextTrimReport)
+	gen.GenerationInfo[GenerationInfoContextTrims] = append(trims, *report)
+	c.recordUsage(gen, opts, UsageRecord{Phase: UsagePhaseSummary, Round: report.Round, Model: report.Model}, report.Usage)
+}
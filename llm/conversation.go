@@ -0,0 +1,215 @@
+package llm
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Conversation 保存历史的多轮对话。每次Send发送一条用户消息，并将回复以及其中的工具调用和工具结果追加到历史中，
+// 历史通过ConversationStore持久化
+type Conversation struct {
+	id           string
+	client       *MCPClient
+	store        ConversationStore
+	options      []GenerateOption
+	systemPrompt string
+
+	history []Message
+	mutex   sync.Mutex
+}
+
+// ConversationOption Conversation的配置选项
+type ConversationOption func(*Conversation)
+
+// WithConversationStore 设置保存历史的存储，默认保存在内存中
+func WithConversationStore(store ConversationStore) ConversationOption {
+	return func(c *Conversation) {
+		c.store = store
+	}
+}
+
+// WithConversationOptions 设置每次Send都使用的生成选项，Send传入的选项在其后应用
+func WithConversationOptions(options ...GenerateOption) ConversationOption {
+	return func(c *Conversation) {
+		c.options = append(c.options, options...)
+	}
+}
+
+// WithConversationSystemPrompt 设置新对话的系统消息，该消息在上下文管理时始终保留
+func WithConversationSystemPrompt(prompt string) ConversationOption {
+	return func(c *Conversation) {
+		c.systemPrompt = prompt
+	}
+}
+
+// NewConversation 创建或恢复对话，id为空时生成新的id，存储中已有该id的历史时继续该对话
+func NewConversation(ctx context.Context, client *MCPClient, id string, opts ...ConversationOption) (*Conversation, error) {
+	c := &Conversation{
+		id:     id,
+		client: client,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.store == nil {
+		c.store = NewMemoryConversationStore()
+	}
+	if c.id == "" {
+		c.id = newConversationID()
+	}
+
+	history, err := c.store.Load(ctx, c.id)
+	if err != nil {
+		return nil, fmt.Errorf("load conversation %s: %w", c.id, err)
+	}
+	c.history = history
+	if len(c.history) == 0 {
+		if err := c.start(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// ID 对话的id，用于之后恢复对话
+func (c *Conversation) ID() string {
+	return c.id
+}
+
+// History 返回对话历史的副本
+func (c *Conversation) History() []Message {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return slices.Clone(c.history)
+}
+
+// Send 发送用户消息并返回回复，回复内容在Generation.Content中
+func (c *Conversation) Send(ctx context.Context, userText string, options ...GenerateOption) (*Generation, error) {
+	return c.SendMessage(ctx, *NewUserMessage("", userText), options...)
+}
+
+// SendMessage 发送消息并返回回复。请求失败时历史不变，回复生成后保存失败时同时返回回复和错误
+func (c *Conversation) SendMessage(ctx context.Context, message Message, options ...GenerateOption) (*Generation, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	messages := append(slices.Clone(c.history), message)
+	gen, err := c.client.GenerateContent(ctx, messages, slices.Concat(c.options, options)...)
+	if err != nil {
+		return nil, err
+	}
+
+	reply := HistoryFromGeneration(gen)
+	if gen.Content == "" {
+		for i := len(reply) - 1; i >= 0; i-- {
+			if reply[i].Role == RoleAssistant && len(reply[i].ToolCalls) == 0 {
+				gen.Content = reply[i].Content
+				break
+			}
+		}
+	}
+
+	added := append([]Message{message}, reply...)
+	if err := c.store.Append(ctx, c.id, added...); err != nil {
+		return gen, fmt.Errorf("save conversation %s: %w", c.id, err)
+	}
+	c.history = append(c.history, added...)
+	return gen, nil
+}
+
+// Reset 清空对话历史，保留系统消息
+func (c *Conversation) Reset(ctx context.Context) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.store.Delete(ctx, c.id); err != nil {
+		return fmt.Errorf("delete conversation %s: %w", c.id, err)
+	}
+	c.history = nil
+	return c.start(ctx)
+}
+
+// start 为新对话写入系统消息
+func (c *Conversation) start(ctx context.Context) error {
+	if c.systemPrompt == "" {
+		return nil
+	}
+	system := *NewSystemMessage("", c.systemPrompt)
+	system.Pinned = true
+	if err := c.store.Append(ctx, c.id, system); err != nil {
+		return fmt.Errorf("save conversation %s: %w", c.id, err)
+	}
+	c.history = append(c.history, system)
+	return nil
+}
+
+// HistoryFromGeneration 将Generation.Messages转换为可以继续对话的消息列表。
+// 工具调用的结果从GenerationInfo中取出并作为工具消息跟在助手消息之后，缺少结果的工具调用（例如未自动执行）不保留；
+// 系统消息和Guard检查的消息不包含在内
+func HistoryFromGeneration(gen *Generation) []Message {
+	messages := make([]Message, 0, len(gen.Messages))
+	for _, message := range gen.Messages {
+		if message.Role == openai.ChatMessageRoleSystem || message.Name == GuardMessageName {
+			continue
+		}
+		msg := Message{
+			Role:             MessageRole(message.Role),
+			Content:          message.Content,
+			ReasoningContent: message.ReasoningContent,
+			ToolCallId:       message.ToolCallID,
+		}
+		if len(message.ToolCalls) == 0 {
+			messages = append(messages, msg)
+			continue
+		}
+
+		toolCalls := make([]ToolCall, 0, len(message.ToolCalls))
+		results := make([]Message, 0, len(message.ToolCalls))
+		for _, tc := range message.ToolCalls {
+			content, ok := toolCallResultContent(gen.GenerationInfo, tc.ID)
+			if !ok {
+				break
+			}
+			toolCalls = append(toolCalls, ToolCall{
+				ID:       tc.ID,
+				Type:     string(tc.Type),
+				Function: &FunctionCall{Name: tc.Function.Name, Arguments: tc.Function.Arguments},
+			})
+			results = append(results, *NewToolMessage(tc.ID, content))
+		}
+		if len(results) < len(message.ToolCalls) {
+			if msg.Content != "" {
+				messages = append(messages, msg)
+			}
+			continue
+		}
+		msg.ToolCalls = toolCalls
+		messages = append(messages, msg)
+		messages = append(messages, results...)
+	}
+	return messages
+}
+
+// toolCallResultContent 函数调用模式下发送给模型的工具结果内容
+func toolCallResultContent(info map[string]any, callID string) (string, bool) {
+	if errStr, ok := info["tool_error_"+callID].(string); ok && errStr != "" {
+		return fmt.Sprintf("Error: %s", errStr), true
+	}
+	if result, ok := info["tool_result_"+callID]; ok {
+		return functionCallResultText(result, info["tool_structured_"+callID]), true
+	}
+	return "", false
+}
+
+func newConversationID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,292 @@
+package llm
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ConversationStore 对话历史的存储
+type ConversationStore interface {
+	// Load 读取对话的全部消息，对话不存在时返回空列表
+	Load(ctx context.Context, id string) ([]Message, error)
+	// Append 在对话末尾追加消息，对话不存在时创建
+	Append(ctx context.Context, id string, messages ...Message) error
+	// Delete 删除对话，对话不存在时不返回错误
+	Delete(ctx context.Context, id string) error
+}
+
+var (
+	_ ConversationStore = (*MemoryConversationStore)(nil)
+	_ ConversationStore = (*FileConversationStore)(nil)
+	_ ConversationStore = (*SQLConversationStore)(nil)
+)
+
+// MemoryConversationStore 保存在内存中的对话历史，进程退出后丢失
+type MemoryConversationStore struct {
+	conversations map[string][]Message
+	mutex         sync.RWMutex
+}
+
+// NewMemoryConversationStore 创建内存存储
+func NewMemoryConversationStore() *MemoryConversationStore {
+	return &MemoryConversationStore{conversations: make(map[string][]Message)}
+}
+
+func (s *MemoryConversationStore) Load(ctx context.Context, id string) ([]Message, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return slices.Clone(s.conversations[id]), nil
+}
+
+func (s *MemoryConversationStore) Append(ctx context.Context, id string, messages ...Message) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.conversations[id] = append(s.conversations[id], messages...)
+	return nil
+}
+
+func (s *MemoryConversationStore) Delete(ctx context.Context, id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.conversations, id)
+	return nil
+}
+
+// FileConversationStore 每个对话保存为目录下的一个JSON文件，文件名为转义后的对话id
+type FileConversationStore struct {
+	dir   string
+	mutex sync.Mutex
+}
+
+// NewFileConversationStore 创建JSON文件存储，目录不存在时创建
+func NewFileConversationStore(dir string) (*FileConversationStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileConversationStore{dir: dir}, nil
+}
+
+func (s *FileConversationStore) path(id string) string {
+	return filepath.Join(s.dir, url.PathEscape(id)+".json")
+}
+
+func (s *FileConversationStore) Load(ctx context.Context, id string) ([]Message, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.load(id)
+}
+
+func (s *FileConversationStore) load(id string) ([]Message, error) {
+	byteSlice, err := os.ReadFile(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var messages []Message
+	if err := json.Unmarshal(byteSlice, &messages); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", s.path(id), err)
+	}
+	return messages, nil
+}
+
+// Append 读取整个文件后写入临时文件再替换，写入过程中出错不会损坏原文件
+func (s *FileConversationStore) Append(ctx context.Context, id string, messages ...Message) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	history, err := s.load(id)
+	if err != nil {
+		return err
+	}
+	byteSlice, err := json.MarshalIndent(append(history, messages...), "", "    ")
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(s.dir, ".conversation-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(byteSlice); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), s.path(id))
+}
+
+func (s *FileConversationStore) Delete(ctx context.Context, id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := os.Remove(s.path(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// SQLPlaceholder SQL语句中参数占位符的风格
+type SQLPlaceholder string
+
+const (
+	SQLPlaceholderQuestion SQLPlaceholder = "?" // MySQL、SQLite等使用的 ?
+	SQLPlaceholderDollar   SQLPlaceholder = "$" // PostgreSQL使用的 $1、$2
+)
+
+// DefaultConversationTable SQLConversationStore默认使用的表名
+const DefaultConversationTable = "mcp_conversation_messages"
+
+var sqlIdentifierRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// SQLConversationStore 通过database/sql保存对话历史，每条消息为一行，消息内容以JSON保存。
+// 不依赖具体的数据库驱动，由调用方导入驱动并打开*sql.DB
+type SQLConversationStore struct {
+	db          *sql.DB
+	table       string
+	placeholder SQLPlaceholder
+}
+
+// SQLConversationStoreOption SQLConversationStore的配置选项
+type SQLConversationStoreOption func(*SQLConversationStore)
+
+// WithSQLTable 设置表名，可以带schema前缀，例如 "chat.messages"
+func WithSQLTable(table string) SQLConversationStoreOption {
+	return func(s *SQLConversationStore) {
+		s.table = table
+	}
+}
+
+// WithSQLPlaceholder 设置参数占位符的风格，默认为SQLPlaceholderQuestion
+func WithSQLPlaceholder(placeholder SQLPlaceholder) SQLConversationStoreOption {
+	return func(s *SQLConversationStore) {
+		s.placeholder = placeholder
+	}
+}
+
+// NewSQLConversationStore 创建SQL存储，表需要已存在或通过CreateTable创建
+func NewSQLConversationStore(db *sql.DB, opts ...SQLConversationStoreOption) (*SQLConversationStore, error) {
+	s := &SQLConversationStore{
+		db:          db,
+		table:       DefaultConversationTable,
+		placeholder: SQLPlaceholderQuestion,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if !sqlIdentifierRegex.MatchString(s.table) {
+		return nil, fmt.Errorf("invalid table name %q", s.table)
+	}
+	if s.placeholder != SQLPlaceholderQuestion && s.placeholder != SQLPlaceholderDollar {
+		return nil, fmt.Errorf("unsupported placeholder %q", s.placeholder)
+	}
+	return s, nil
+}
+
+// CreateTable 创建保存消息的表，表已存在时不做任何操作
+func (s *SQLConversationStore) CreateTable(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	conversation_id VARCHAR(255) NOT NULL,
+	seq INTEGER NOT NULL,
+	message TEXT NOT NULL,
+	PRIMARY KEY (conversation_id, seq)
+)`, s.table))
+	return err
+}
+
+// bind 将语句中的 ? 替换为所用数据库的占位符
+func (s *SQLConversationStore) bind(query string) string {
+	if s.placeholder != SQLPlaceholderDollar {
+		return query
+	}
+	var sb strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			sb.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+func (s *SQLConversationStore) Load(ctx context.Context, id string) ([]Message, error) {
+	rows, err := s.db.QueryContext(ctx, s.bind(fmt.Sprintf("SELECT message FROM %s WHERE conversation_id = ? ORDER BY seq", s.table)), id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []Message
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var message Message
+		if err := json.Unmarshal([]byte(data), &message); err != nil {
+			return nil, fmt.Errorf("decode message: %w", err)
+		}
+		messages = append(messages, message)
+	}
+	return messages, rows.Err()
+}
+
+// Append 在一个事务中追加消息，序号接在对话已有的最大序号之后
+func (s *SQLConversationStore) Append(ctx context.Context, id string, messages ...Message) (err error) {
+	if len(messages) == 0 {
+		return nil
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var seq int64
+	if err = tx.QueryRowContext(ctx, s.bind(fmt.Sprintf("SELECT COALESCE(MAX(seq), 0) FROM %s WHERE conversation_id = ?", s.table)), id).Scan(&seq); err != nil {
+		return err
+	}
+	insert := s.bind(fmt.Sprintf("INSERT INTO %s (conversation_id, seq, message) VALUES (?, ?, ?)", s.table))
+	for _, message := range messages {
+		var byteSlice []byte
+		if byteSlice, err = json.Marshal(message); err != nil {
+			return err
+		}
+		seq++
+		if _, err = tx.ExecContext(ctx, insert, id, seq, string(byteSlice)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLConversationStore) Delete(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, s.bind(fmt.Sprintf("DELETE FROM %s WHERE conversation_id = ?", s.table)), id)
+	return err
+}
@@ -7,7 +7,7 @@ import (
 	"os"
 	"strings"
 
-	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/longdexin/MCP_Host"
 	"github.com/sashabaranov/go-openai"
 )
 
@@ -76,31 +76,42 @@ func (c *MCPClient) executeToolsLoop(ctx context.Context, state *ExecutionState)
 	// 多轮工具执行循环
 	for state.executionRound < maxRounds {
 		state.executionRound++
-		c.notifyRoundStart(ctx, state)
-		hasExecutedTools, err := c.executeRound(ctx, state)
+		done, err := c.runRound(ctx, state, maxRounds)
 		if err != nil {
 			return err
 		}
-
-		if !hasExecutedTools {
-			break
-		}
-
-		if state.executionRound >= maxRounds {
-			if err := c.getFinalResult(ctx, state); err != nil {
-				return err
-			}
+		if done {
 			break
 		}
-		// 准备下一轮执行
-		if err := c.prepareNextRound(ctx, state); err != nil {
-			return err
-		}
 	}
 
 	return nil
 }
 
+// runRound 执行一轮工具调用并生成下一轮回复，返回是否结束循环
+func (c *MCPClient) runRound(ctx context.Context, state *ExecutionState, maxRounds int) (done bool, err error) {
+	ctx, span := c.startRoundSpan(ctx, state)
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	c.notifyRoundStart(ctx, state)
+	hasExecutedTools, err := c.executeRound(ctx, state)
+	if err != nil {
+		return true, err
+	}
+
+	if !hasExecutedTools {
+		return true, nil
+	}
+
+	if state.executionRound >= maxRounds {
+		return true, c.getFinalResult(ctx, state)
+	}
+	// 准备下一轮执行
+	return false, c.prepareNextRound(ctx, state)
+}
+
 // notifyRoundStart 通知开始新一轮
 func (c *MCPClient) notifyRoundStart(ctx context.Context, state *ExecutionState) {
 	if state.opts.StateNotifyFunc != nil {
@@ -117,6 +128,7 @@ func (c *MCPClient) notifyRoundStart(ctx context.Context, state *ExecutionState)
 
 // executeRound 执行单轮工具调用
 func (c *MCPClient) executeRound(ctx context.Context, state *ExecutionState) (bool, error) {
+	ctx = MCP_Host.ContextWithRound(ctx, state.executionRound)
 	if state.currentGen.MCPWorkMode == TextMode {
 		return c.executeTextModeRound(ctx, state)
 	} else {
@@ -149,16 +161,9 @@ func (c *MCPClient) executeTextModeRound(ctx context.Context, state *ExecutionSt
 				state.gen.Messages = append(state.gen.Messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: content})
 				continue RESULT_LOOP
 			}
-			if result, ok := roundTaskResults[i].Result.([]mcp.Content); ok {
-				texts := make([]string, 0, len(result))
-				for j := range result {
-					if textContent, ok := result[j].(mcp.TextContent); ok {
-						texts = append(texts, textContent.Text)
-					}
-				}
-				content := fmt.Sprintf(state.opts.ToolResultMsgTemplate, state.opts.MCPResultTag, strings.Join(texts, "\n\n"), state.opts.MCPResultTag)
-				state.gen.Messages = append(state.gen.Messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: content})
-			}
+			resultText := toolResultText(roundTaskResults[i].Result, roundTaskResults[i].StructuredContent)
+			content := fmt.Sprintf(state.opts.ToolResultMsgTemplate, state.opts.MCPResultTag, resultText, state.opts.MCPResultTag)
+			state.gen.Messages = append(state.gen.Messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: content})
 		}
 	}
 
@@ -174,7 +179,7 @@ func (c *MCPClient) executeTextModeRound(ctx context.Context, state *ExecutionSt
 func (c *MCPClient) executeFunctionCallRound(ctx context.Context, state *ExecutionState) (bool, error) {
 	// 通知开始处理工具调用
 	c.notifyProcessingToolCalls(ctx, state, "start")
-	if err := c.processToolCalls(ctx, state.currentGen); err != nil {
+	if err := c.processToolCalls(ctx, state.currentGen, state.opts); err != nil {
 		return false, err
 	}
 
@@ -182,6 +187,17 @@ func (c *MCPClient) executeFunctionCallRound(ctx context.Context, state *Executi
 	if len(state.currentGen.ToolCalls) == 0 {
 		return false, nil
 	}
+	// 后续轮次的结果也记录到最初的生成结果中，最终结果包含所有轮次的工具结果
+	if state.currentGen != state.gen {
+		if state.gen.GenerationInfo == nil {
+			state.gen.GenerationInfo = make(map[string]any)
+		}
+		for k, v := range state.currentGen.GenerationInfo {
+			if strings.HasPrefix(k, "tool_result_") || strings.HasPrefix(k, "tool_error_") || strings.HasPrefix(k, "tool_structured_") {
+				state.gen.GenerationInfo[k] = v
+			}
+		}
+	}
 
 	// 输出结果
 	if state.opts.StreamingFunc != nil {
@@ -227,9 +243,9 @@ func (c *MCPClient) notifyProcessingToolCalls(ctx context.Context, state *Execut
 func (c *MCPClient) streamTextModeResults(ctx context.Context, state *ExecutionState, results []TaskResult) {
 	resultInfos := make([]MCPToolExecutionResult, 0, len(results))
 	for _, result := range results {
-		c.notifyToolCall(ctx, state, result.Task.Server, result.Task.Tool, "start", result.Task.Args)
+		c.notifyToolCall(ctx, state, result.Task.Server, result.Task.Tool, "start", c.redactor(state.opts).RedactArgs(result.Task.Args))
 		resultInfo := c.createToolExecutionResult(result)
-		resultInfos = append(resultInfos, resultInfo)
+		resultInfos = append(resultInfos, c.redactExecutionResult(state.opts, resultInfo))
 		c.notifyToolResult(ctx, state, result)
 	}
 	if len(resultInfos) > 0 {
@@ -251,6 +267,7 @@ func (c *MCPClient) createToolExecutionResult(result TaskResult) MCPToolExecutio
 	} else {
 		resultInfo.Status = "success"
 		resultInfo.Result = result.Result
+		resultInfo.StructuredContent = result.StructuredContent
 	}
 
 	return resultInfo
@@ -268,8 +285,8 @@ func (c *MCPClient) streamFunctionCallResults(ctx context.Context, state *Execut
 			Args:   args,
 			ID:     call.ID,
 		}
-		resultInfos = append(resultInfos, resultInfo)
 		c.fillToolCallResult(state.currentGen, &resultInfo)
+		resultInfos = append(resultInfos, c.redactExecutionResult(state.opts, resultInfo))
 		c.notifyFunctionCallResult(ctx, state, resultInfo)
 	}
 
@@ -305,6 +322,7 @@ func (c *MCPClient) fillToolCallResult(gen *Generation, resultInfo *MCPToolExecu
 	} else if result, ok := gen.GenerationInfo["tool_result_"+resultInfo.ID]; ok {
 		resultInfo.Status = "success"
 		resultInfo.Result = result
+		resultInfo.StructuredContent = gen.GenerationInfo["tool_structured_"+resultInfo.ID]
 	}
 }
 
@@ -324,11 +342,12 @@ func (c *MCPClient) notifyToolCall(ctx context.Context, state *ExecutionState, s
 // notifyToolResult 通知工具结果状态
 func (c *MCPClient) notifyToolResult(ctx context.Context, state *ExecutionState, result TaskResult) {
 	if state.opts.StateNotifyFunc != nil {
+		redactor := c.redactor(state.opts)
 		stateData := map[string]any{}
 		if result.Error != "" {
-			stateData["error"] = result.Error
+			stateData["error"] = redactor.RedactString(result.Error)
 		} else {
-			stateData["result"] = result.Result
+			stateData["result"] = redactor.RedactValue(result.Result)
 		}
 
 		_ = state.opts.StateNotifyFunc(ctx, MCPExecutionState{
@@ -344,11 +363,12 @@ func (c *MCPClient) notifyToolResult(ctx context.Context, state *ExecutionState,
 // notifyFunctionCallResult 通知函数调用结果状态
 func (c *MCPClient) notifyFunctionCallResult(ctx context.Context, state *ExecutionState, resultInfo MCPToolExecutionResult) {
 	if state.opts.StateNotifyFunc != nil {
+		redactor := c.redactor(state.opts)
 		stateData := map[string]any{"call_id": resultInfo.ID}
 		if resultInfo.Error != "" {
-			stateData["error"] = resultInfo.Error
+			stateData["error"] = redactor.RedactString(resultInfo.Error)
 		} else {
-			stateData["result"] = resultInfo.Result
+			stateData["result"] = redactor.RedactValue(resultInfo.Result)
 		}
 
 		_ = state.opts.StateNotifyFunc(ctx, MCPExecutionState{
@@ -363,13 +383,15 @@ func (c *MCPClient) notifyFunctionCallResult(ctx context.Context, state *Executi
 
 // prepareNextRound 准备下一轮执行
 func (c *MCPClient) prepareNextRound(ctx context.Context, state *ExecutionState) error {
-	intermediateMessages := c.buildIntermediateMessages(state)
+	intermediateMessages, trim, err := c.fitContext(ctx, c.buildIntermediateMessages(state), state.opts, state.executionRound)
+	if err != nil {
+		return err
+	}
+	c.recordContextTrim(state.gen, state.opts, trim)
 	c.notifyIntermediateGeneration(ctx, state, "start")
 
 	if state.opts.EnableDebug {
-		if byteSlice, err := json.MarshalIndent(intermediateMessages, "", "    "); err == nil {
-			_ = os.WriteFile(fmt.Sprintf("%d.json", state.executionRound), byteSlice, 0644)
-		}
+		c.writeDebugDump(state, intermediateMessages)
 	}
 	nextGen, err := c.llm.GenerateContent(ctx, intermediateMessages, state.originalOptions...)
 	if err != nil {
@@ -383,7 +405,7 @@ func (c *MCPClient) prepareNextRound(ctx context.Context, state *ExecutionState)
 	nextGen.MCPResultTag = state.gen.MCPResultTag
 	nextGen.MCPSystemPrompt = state.gen.MCPSystemPrompt
 	state.gen.Messages = append(state.gen.Messages, nextGen.Messages...)
-	state.gen.Usage = nextGen.Usage
+	c.recordUsage(state.gen, state.opts, UsageRecord{Phase: UsagePhaseRound, Round: state.executionRound, Model: generationModel(nextGen)}, nextGen.Usage)
 	nextGen.Messages = state.gen.Messages
 	state.currentGen = nextGen
 
@@ -391,13 +413,15 @@ func (c *MCPClient) prepareNextRound(ctx context.Context, state *ExecutionState)
 }
 
 func (c *MCPClient) getFinalResult(ctx context.Context, state *ExecutionState) error {
-	intermediateMessages := c.buildFinalResultMessages(state)
+	intermediateMessages, trim, err := c.fitContext(ctx, c.buildFinalResultMessages(state), state.opts, state.executionRound)
+	if err != nil {
+		return err
+	}
+	c.recordContextTrim(state.gen, state.opts, trim)
 
 	c.notifyIntermediateGeneration(ctx, state, "start")
 	if state.opts.EnableDebug {
-		if byteSlice, err := json.MarshalIndent(intermediateMessages, "", "    "); err == nil {
-			_ = os.WriteFile(fmt.Sprintf("%d.json", state.executionRound), byteSlice, 0644)
-		}
+		c.writeDebugDump(state, intermediateMessages)
 	}
 	nextGen, err := c.llm.GenerateContent(ctx, intermediateMessages, state.originalOptions...)
 	if err != nil {
@@ -411,13 +435,39 @@ func (c *MCPClient) getFinalResult(ctx context.Context, state *ExecutionState) e
 	nextGen.MCPResultTag = state.gen.MCPResultTag
 	nextGen.MCPSystemPrompt = state.gen.MCPSystemPrompt
 	state.gen.Messages = append(state.gen.Messages, nextGen.Messages...)
-	state.gen.Usage = nextGen.Usage
+	c.recordUsage(state.gen, state.opts, UsageRecord{Phase: UsagePhaseFinal, Round: state.executionRound, Model: generationModel(nextGen)}, nextGen.Usage)
 	nextGen.Messages = state.gen.Messages
 	state.currentGen = nextGen
 
 	return nil
 }
 
+// writeDebugDump 将即将发送的消息脱敏后写入 "<round>.json"
+func (c *MCPClient) writeDebugDump(state *ExecutionState, messages []Message) {
+	redactor := c.redactor(state.opts)
+	dump := make([]Message, len(messages))
+	for i, message := range messages {
+		message.Content = redactor.RedactString(message.Content)
+		message.ReasoningContent = redactor.RedactString(message.ReasoningContent)
+		if len(message.ToolCalls) > 0 {
+			toolCalls := make([]ToolCall, len(message.ToolCalls))
+			for j, call := range message.ToolCalls {
+				if call.Function != nil {
+					function := *call.Function
+					function.Arguments = redactor.RedactString(function.Arguments)
+					call.Function = &function
+				}
+				toolCalls[j] = call
+			}
+			message.ToolCalls = toolCalls
+		}
+		dump[i] = message
+	}
+	if byteSlice, err := json.MarshalIndent(dump, "", "    "); err == nil {
+		_ = os.WriteFile(fmt.Sprintf("%d.json", state.executionRound), byteSlice, 0o600)
+	}
+}
+
 // buildIntermediateMessages 构建中间消息
 func (c *MCPClient) buildIntermediateMessages(state *ExecutionState) []Message {
 	if state.currentGen.MCPWorkMode == TextMode {
@@ -502,17 +552,9 @@ func (c *MCPClient) buildFunctionCallIntermediateMessages(state *ExecutionState)
 
 	// 添加工具结果
 	for _, call := range state.currentGen.ToolCalls {
-		var resultContent string
-		if errStr, ok := state.currentGen.GenerationInfo["tool_error_"+call.ID].(string); ok && errStr != "" {
-			resultContent = fmt.Sprintf("Error: %s", errStr)
-		} else if result, ok := state.currentGen.GenerationInfo["tool_result_"+call.ID]; ok {
-			resultJSON, _ := json.Marshal(result)
-			resultContent = string(resultJSON)
-		} else {
-			continue
+		if resultContent, ok := toolCallResultContent(state.currentGen.GenerationInfo, call.ID); ok {
+			messages = append(messages, *NewToolMessage(call.ID, resultContent))
 		}
-
-		messages = append(messages, *NewToolMessage(call.ID, resultContent))
 	}
 
 	// 添加额外指导
@@ -536,17 +578,9 @@ func (c *MCPClient) buildFunctionCallFinalResultMessages(state *ExecutionState)
 
 	// 添加工具结果
 	for _, call := range state.currentGen.ToolCalls {
-		var resultContent string
-		if errStr, ok := state.currentGen.GenerationInfo["tool_error_"+call.ID].(string); ok && errStr != "" {
-			resultContent = fmt.Sprintf("Error: %s", errStr)
-		} else if result, ok := state.currentGen.GenerationInfo["tool_result_"+call.ID]; ok {
-			resultJSON, _ := json.Marshal(result)
-			resultContent = string(resultJSON)
-		} else {
-			continue
+		if resultContent, ok := toolCallResultContent(state.currentGen.GenerationInfo, call.ID); ok {
+			messages = append(messages, *NewToolMessage(call.ID, resultContent))
 		}
-
-		messages = append(messages, *NewToolMessage(call.ID, resultContent))
 	}
 
 	// 添加额外指导
@@ -583,12 +617,17 @@ func (c *MCPClient) mergeGenerationInfo(finalGen *Generation, state *ExecutionSt
 		finalGen.GenerationInfo = make(map[string]any)
 	}
 
+	for _, k := range []string{GenerationInfoOfferedTools, GenerationInfoToolSelectionError, GenerationInfoContextTrims, GenerationInfoUsage, GenerationInfoCost} {
+		if v, ok := state.gen.GenerationInfo[k]; ok {
+			finalGen.GenerationInfo[k] = v
+		}
+	}
 	if len(state.allTaskResults) > 0 {
 		finalGen.GenerationInfo["mcp_task_results"] = state.allTaskResults
 		finalGen.GenerationInfo["mcp_execution_rounds"] = state.executionRound
 	} else {
 		for k, v := range state.gen.GenerationInfo {
-			if strings.HasPrefix(k, "tool_result_") || strings.HasPrefix(k, "tool_error_") {
+			if strings.HasPrefix(k, "tool_result_") || strings.HasPrefix(k, "tool_error_") || strings.HasPrefix(k, "tool_structured_") {
 				finalGen.GenerationInfo[k] = v
 			}
 		}
@@ -0,0 +1,289 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// ErrFakeScriptExhausted FakeLLM的脚本已全部使用
+var ErrFakeScriptExhausted = errors.New("fake llm script exhausted")
+
+// FakeResponse FakeLLM脚本中的一次回复
+type FakeResponse struct {
+	Generation *Generation                                                          // 返回的生成结果
+	Deltas     []openai.ChatCompletionStreamChoiceDelta                             // 流式输出时依次传给StreamingFunc的增量，为空时由Generation生成一个增量
+	Err        error                                                                // 返回的错误
+	Respond    func(messages []Message, opts *GenerateOptions) (*Generation, error) // 根据请求动态生成回复，设置后忽略Generation和Err
+}
+
+// FakeCall FakeLLM收到的一次调用
+type FakeCall struct {
+	Messages []Message
+	Options  GenerateOptions
+}
+
+// TestingT testing.T中断言辅助函数使用的部分
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...any)
+}
+
+// FakeLLM 按脚本依次返回回复并记录收到的调用的LLM，用于离线测试文本模式和函数调用模式的多轮执行
+type FakeLLM struct {
+	script []FakeResponse
+	calls  []FakeCall
+	mutex  sync.Mutex
+}
+
+var _ LLM = (*FakeLLM)(nil)
+
+// NewFakeLLM 创建FakeLLM，每次调用依次使用script中的一个回复
+func NewFakeLLM(script ...FakeResponse) *FakeLLM {
+	return &FakeLLM{script: script}
+}
+
+// FakeText 返回文本内容的回复
+func FakeText(content string) FakeResponse {
+	return FakeResponse{Generation: &Generation{Role: openai.ChatMessageRoleAssistant, Content: content, StopReason: string(openai.FinishReasonStop)}}
+}
+
+// FakeToolCalls 返回工具调用的回复
+func FakeToolCalls(toolCalls ...ToolCall) FakeResponse {
+	return FakeResponse{Generation: &Generation{Role: openai.ChatMessageRoleAssistant, ToolCalls: toolCalls, StopReason: string(openai.FinishReasonToolCalls)}}
+}
+
+// FakeToolCall 创建工具调用，name为 "服务器ID.工具名"，arguments为JSON字符串
+func FakeToolCall(id string, name string, arguments string) ToolCall {
+	return ToolCall{ID: id, Type: string(openai.ToolTypeFunction), Function: &FunctionCall{Name: name, Arguments: arguments}}
+}
+
+// FakeTask 返回文本模式下包含工具调用任务的回复，name为 "服务器ID.工具名"，arguments为JSON对象字符串
+func FakeTask(name string, arguments string) FakeResponse {
+	content := fmt.Sprintf("<%s>{\"name\": %q, \"arguments\": %s}</%s>", MCP_DEFAULT_TASK_TAG, name, arguments, MCP_DEFAULT_TASK_TAG)
+	return FakeText(content)
+}
+
+// FakeError 返回错误的回复
+func FakeError(err error) FakeResponse {
+	return FakeResponse{Err: err}
+}
+
+// Append 在脚本末尾追加回复
+func (f *FakeLLM) Append(script ...FakeResponse) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.script = append(f.script, script...)
+}
+
+// Generate 实现LLM
+func (f *FakeLLM) Generate(ctx context.Context, messages []Message, options ...GenerateOption) (*Generation, error) {
+	return f.GenerateContent(ctx, messages, options...)
+}
+
+// GenerateContent 实现LLM，记录调用并返回脚本中的下一个回复
+func (f *FakeLLM) GenerateContent(ctx context.Context, messages []Message, options ...GenerateOption) (*Generation, error) {
+	opts := DefaultGenerateOption()
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	f.mutex.Lock()
+	f.calls = append(f.calls, FakeCall{Messages: append([]Message(nil), messages...), Options: *opts})
+	index := len(f.calls) - 1
+	if index >= len(f.script) {
+		f.mutex.Unlock()
+		return nil, fmt.Errorf("%w: call %d", ErrFakeScriptExhausted, index+1)
+	}
+	response := f.script[index]
+	f.mutex.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	gen, err := response.Generation, response.Err
+	if response.Respond != nil {
+		gen, err = response.Respond(messages, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if gen == nil {
+		gen = &Generation{}
+	}
+	gen = cloneGeneration(gen)
+
+	if opts.StreamingFunc != nil && !opts.DisableStreamingFunc {
+		deltas := response.Deltas
+		if len(deltas) == 0 {
+			deltas = []openai.ChatCompletionStreamChoiceDelta{generationDelta(gen)}
+		}
+		for i := range deltas {
+			if err := opts.StreamingFunc(ctx, &deltas[i], nil, 0); err != nil {
+				return gen, fmt.Errorf("streaming function returned error: %w", err)
+			}
+		}
+	}
+	return gen, nil
+}
+
+// cloneGeneration 复制脚本中的Generation，并与OpenAIClient一样补充Messages
+func cloneGeneration(gen *Generation) *Generation {
+	clone := *gen
+	if clone.Role == "" {
+		clone.Role = openai.ChatMessageRoleAssistant
+	}
+	clone.ToolCalls = make([]ToolCall, 0, len(gen.ToolCalls))
+	for _, tc := range gen.ToolCalls {
+		if tc.Function != nil {
+			function := *tc.Function
+			tc.Function = &function
+		}
+		clone.ToolCalls = append(clone.ToolCalls, tc)
+	}
+	if len(clone.ToolCalls) == 0 {
+		clone.ToolCalls = nil
+	}
+	clone.GenerationInfo = make(map[string]any, len(gen.GenerationInfo))
+	for k, v := range gen.GenerationInfo {
+		clone.GenerationInfo[k] = v
+	}
+	if gen.Usage != nil {
+		usage := *gen.Usage
+		clone.Usage = &usage
+	}
+	if len(gen.Messages) > 0 {
+		clone.Messages = append([]openai.ChatCompletionMessage(nil), gen.Messages...)
+	} else {
+		clone.Messages = []openai.ChatCompletionMessage{assistantMessage(&clone)}
+	}
+	return &clone
+}
+
+// generationDelta 将整个Generation作为一个流式增量
+func generationDelta(gen *Generation) openai.ChatCompletionStreamChoiceDelta {
+	delta := openai.ChatCompletionStreamChoiceDelta{
+		Role:             gen.Role,
+		Content:          gen.Content,
+		ReasoningContent: gen.ReasoningContent,
+	}
+	for i, tc := range gen.ToolCalls {
+		if tc.Function == nil {
+			continue
+		}
+		index := i
+		delta.ToolCalls = append(delta.ToolCalls, openai.ToolCall{
+			Index:    &index,
+			ID:       tc.ID,
+			Type:     openai.ToolType(tc.Type),
+			Function: openai.FunctionCall{Name: tc.Function.Name, Arguments: tc.Function.Arguments},
+		})
+	}
+	return delta
+}
+
+// Calls 返回收到的所有调用
+func (f *FakeLLM) Calls() []FakeCall {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return append([]FakeCall(nil), f.calls...)
+}
+
+// Remaining 返回脚本中尚未使用的回复数量
+func (f *FakeLLM) Remaining() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return max(len(f.script)-len(f.calls), 0)
+}
+
+// AssertCallCount 断言调用次数
+func (f *FakeLLM) AssertCallCount(t TestingT, n int) bool {
+	t.Helper()
+	if calls := len(f.Calls()); calls != n {
+		t.Errorf("fake llm: expected %d calls, got %d", n, calls)
+		return false
+	}
+	return true
+}
+
+// AssertExhausted 断言脚本中的回复已全部使用
+func (f *FakeLLM) AssertExhausted(t TestingT) bool {
+	t.Helper()
+	if remaining := f.Remaining(); remaining > 0 {
+		t.Errorf("fake llm: %d scripted responses were not used", remaining)
+		return false
+	}
+	return true
+}
+
+// AssertMessageContains 断言第index次调用（从0开始）中有角色为role且内容包含substr的消息，role为空时不限角色
+func (f *FakeLLM) AssertMessageContains(t TestingT, index int, role MessageRole, substr string) bool {
+	t.Helper()
+	calls := f.Calls()
+	if index < 0 || index >= len(calls) {
+		t.Errorf("fake llm: call %d not found, got %d calls", index, len(calls))
+		return false
+	}
+	if !calls[index].ContainsMessage(role, substr) {
+		t.Errorf("fake llm: call %d has no %s message containing %q", index, role, substr)
+		return false
+	}
+	return true
+}
+
+// AssertToolsOffered 断言第index次调用（从0开始）向模型提供了这些工具
+func (f *FakeLLM) AssertToolsOffered(t TestingT, index int, names ...string) bool {
+	t.Helper()
+	calls := f.Calls()
+	if index < 0 || index >= len(calls) {
+		t.Errorf("fake llm: call %d not found, got %d calls", index, len(calls))
+		return false
+	}
+	offered := calls[index].ToolNames()
+	ok := true
+	for _, name := range names {
+		if !slices.Contains(offered, name) {
+			t.Errorf("fake llm: call %d did not offer tool %s, offered %v", index, name, offered)
+			ok = false
+		}
+	}
+	return ok
+}
+
+// LastMessage 返回调用中的最后一条消息
+func (c FakeCall) LastMessage() Message {
+	if len(c.Messages) == 0 {
+		return Message{}
+	}
+	return c.Messages[len(c.Messages)-1]
+}
+
+// ContainsMessage 判断调用中是否有角色为role且内容包含substr的消息，role为空时不限角色
+func (c FakeCall) ContainsMessage(role MessageRole, substr string) bool {
+	for _, message := range c.Messages {
+		if (role == "" || message.Role == role) && strings.Contains(message.Content, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ToolNames 返回调用中通过Tools提供的工具名称
+func (c FakeCall) ToolNames() []string {
+	names := make([]string, 0, len(c.Options.Tools))
+	for _, tool := range c.Options.Tools {
+		if tool.Function != nil {
+			names = append(names, tool.Function.Name)
+		}
+	}
+	return names
+}
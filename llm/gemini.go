@@ -0,0 +1,906 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	DefaultGeminiBaseURL    = "https://generativelanguage.googleapis.com" // 默认的Gemini API地址
+	DefaultGeminiAPIVersion = "v1beta"                                    // 默认的API版本
+	DefaultGeminiModel      = "gemini-2.5-flash"                          // 默认模型
+)
+
+// GenerationInfo中记录思考令牌数的键
+const GenerationInfoThoughtsTokens = "thoughts_token_count"
+
+// 缓存的思考签名数量上限，用于在后续请求中回传函数调用的签名
+const geminiSignatureCacheSize = 256
+
+// GeminiClient Google Gemini generateContent API的LLM实现，支持流式输出、函数调用、思考输出和响应MIME类型
+type GeminiClient struct {
+	httpClient      *http.Client
+	apiKey          string
+	baseURL         string
+	apiVersion      string
+	model           string
+	thinkingBudget  *int
+	includeThoughts bool
+	tracer          trace.Tracer
+	observers       []RequestObserver
+
+	// 思考模型的函数调用带有签名，回传函数调用时必须同时回传签名，按工具调用ID缓存
+	signatures     map[string]string
+	signatureOrder []string
+	signatureMutex sync.Mutex
+}
+
+// GeminiOption Gemini客户端的配置选项
+type GeminiOption func(*geminiOptions)
+
+type geminiOptions struct {
+	apiKey          string
+	baseURL         string
+	apiVersion      string
+	model           string
+	thinkingBudget  *int
+	includeThoughts bool
+	httpClient      *http.Client
+	tracerProvider  trace.TracerProvider
+	observers       []RequestObserver
+}
+
+var _ LLM = (*GeminiClient)(nil)
+
+// NewGeminiClient 创建Gemini客户端，默认从GEMINI_API_KEY（或GOOGLE_API_KEY）、GEMINI_MODEL和GEMINI_BASE_URL读取配置
+func NewGeminiClient(opts ...GeminiOption) (*GeminiClient, error) {
+	options := &geminiOptions{
+		baseURL:    DefaultGeminiBaseURL,
+		apiVersion: DefaultGeminiAPIVersion,
+		model:      DefaultGeminiModel,
+		httpClient: http.DefaultClient,
+	}
+	if apiKey := os.Getenv("GEMINI_API_KEY"); apiKey != "" {
+		options.apiKey = apiKey
+	} else if apiKey := os.Getenv("GOOGLE_API_KEY"); apiKey != "" {
+		options.apiKey = apiKey
+	}
+	if model := os.Getenv("GEMINI_MODEL"); model != "" {
+		options.model = model
+	}
+	if baseURL := os.Getenv("GEMINI_BASE_URL"); baseURL != "" {
+		options.baseURL = baseURL
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	if options.apiKey == "" {
+		return nil, errors.New("missing Gemini API key")
+	}
+
+	return &GeminiClient{
+		httpClient:      options.httpClient,
+		apiKey:          options.apiKey,
+		baseURL:         strings.TrimSuffix(options.baseURL, "/"),
+		apiVersion:      options.apiVersion,
+		model:           strings.TrimPrefix(options.model, "models/"),
+		thinkingBudget:  options.thinkingBudget,
+		includeThoughts: options.includeThoughts,
+		tracer:          tracerFrom(options.tracerProvider),
+		observers:       options.observers,
+		signatures:      make(map[string]string),
+	}, nil
+}
+
+// WithGeminiAPIKey 设置API密钥
+func WithGeminiAPIKey(apiKey string) GeminiOption {
+	return func(opts *geminiOptions) {
+		opts.apiKey = apiKey
+	}
+}
+
+// WithGeminiModel 设置模型
+func WithGeminiModel(model string) GeminiOption {
+	return func(opts *geminiOptions) {
+		opts.model = model
+	}
+}
+
+// WithGeminiBaseURL 设置API地址
+func WithGeminiBaseURL(baseURL string) GeminiOption {
+	return func(opts *geminiOptions) {
+		opts.baseURL = baseURL
+	}
+}
+
+// WithGeminiAPIVersion 设置API版本，默认为v1beta
+func WithGeminiAPIVersion(version string) GeminiOption {
+	return func(opts *geminiOptions) {
+		opts.apiVersion = version
+	}
+}
+
+// WithGeminiThinking 设置思考预算，0表示关闭思考，-1表示由模型决定。includeThoughts为true时思考摘要映射到ReasoningContent
+func WithGeminiThinking(budgetTokens int, includeThoughts bool) GeminiOption {
+	return func(opts *geminiOptions) {
+		opts.thinkingBudget = &budgetTokens
+		opts.includeThoughts = includeThoughts
+	}
+}
+
+// WithGeminiHTTPClient 设置HTTP客户端
+func WithGeminiHTTPClient(client *http.Client) GeminiOption {
+	return func(opts *geminiOptions) {
+		opts.httpClient = client
+	}
+}
+
+// WithGeminiTracerProvider 设置链路追踪的TracerProvider，默认使用全局TracerProvider
+func WithGeminiTracerProvider(provider trace.TracerProvider) GeminiOption {
+	return func(opts *geminiOptions) {
+		opts.tracerProvider = provider
+	}
+}
+
+// WithGeminiRequestObserver 添加LLM请求观察者
+func WithGeminiRequestObserver(observer RequestObserver) GeminiOption {
+	return func(opts *geminiOptions) {
+		opts.observers = append(opts.observers, observer)
+	}
+}
+
+type geminiPart struct {
+	Text             string                  `json:"text,omitempty"`
+	Thought          bool                    `json:"thought,omitempty"`
+	ThoughtSignature string                  `json:"thoughtSignature,omitempty"`
+	FunctionCall     *geminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *geminiFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+type geminiFunctionCall struct {
+	ID   string          `json:"id,omitempty"`
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+type geminiFunctionResponse struct {
+	ID       string         `json:"id,omitempty"`
+	Name     string         `json:"name"`
+	Response map[string]any `json:"response"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiFunctionDeclaration struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Parameters  any    `json:"parameters,omitempty"`
+}
+
+type geminiTool struct {
+	FunctionDeclarations []geminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+type geminiToolConfig struct {
+	FunctionCallingConfig struct {
+		Mode                 string   `json:"mode"`
+		AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
+	} `json:"functionCallingConfig"`
+}
+
+type geminiThinkingConfig struct {
+	ThinkingBudget  *int `json:"thinkingBudget,omitempty"`
+	IncludeThoughts bool `json:"includeThoughts,omitempty"`
+}
+
+type geminiGenerationConfig struct {
+	Temperature      *float32              `json:"temperature,omitempty"`
+	TopP             *float32              `json:"topP,omitempty"`
+	TopK             int                   `json:"topK,omitempty"`
+	MaxOutputTokens  int                   `json:"maxOutputTokens,omitempty"`
+	StopSequences    []string              `json:"stopSequences,omitempty"`
+	Seed             *int                  `json:"seed,omitempty"`
+	PresencePenalty  *float32              `json:"presencePenalty,omitempty"`
+	FrequencyPenalty *float32              `json:"frequencyPenalty,omitempty"`
+	ResponseMIMEType string                `json:"responseMimeType,omitempty"`
+	ThinkingConfig   *geminiThinkingConfig `json:"thinkingConfig,omitempty"`
+}
+
+type geminiRequest struct {
+	Contents          []geminiContent         `json:"contents"`
+	SystemInstruction *geminiContent          `json:"systemInstruction,omitempty"`
+	Tools             []geminiTool            `json:"tools,omitempty"`
+	ToolConfig        *geminiToolConfig       `json:"toolConfig,omitempty"`
+	GenerationConfig  *geminiGenerationConfig `json:"generationConfig,omitempty"`
+}
+
+type geminiUsage struct {
+	PromptTokenCount        int `json:"promptTokenCount"`
+	CandidatesTokenCount    int `json:"candidatesTokenCount"`
+	ThoughtsTokenCount      int `json:"thoughtsTokenCount"`
+	CachedContentTokenCount int `json:"cachedContentTokenCount"`
+	TotalTokenCount         int `json:"totalTokenCount"`
+}
+
+type geminiResponse struct {
+	Candidates []struct {
+		Content      geminiContent `json:"content"`
+		FinishReason string        `json:"finishReason"`
+	} `json:"candidates"`
+	PromptFeedback *struct {
+		BlockReason string `json:"blockReason"`
+	} `json:"promptFeedback,omitempty"`
+	UsageMetadata *geminiUsage `json:"usageMetadata,omitempty"`
+	ModelVersion  string       `json:"modelVersion,omitempty"`
+}
+
+type geminiError struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	} `json:"error"`
+}
+
+// Generate 生成文本回复
+func (c *GeminiClient) Generate(ctx context.Context, messages []Message, options ...GenerateOption) (*Generation, error) {
+	return c.GenerateContent(ctx, messages, options...)
+}
+
+// GenerateContent 使用消息列表生成回复
+func (c *GeminiClient) GenerateContent(ctx context.Context, messages []Message, options ...GenerateOption) (gen *Generation, err error) {
+	opts := DefaultGenerateOption()
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	ctx, span := startChatSpan(ctx, c.tracer, "gemini", c.model, opts)
+	start := time.Now()
+	defer func() {
+		setGenerationModel(gen, c.model)
+		endChatSpan(span, c.model, gen, err)
+		notifyRequestFinished(c.observers, "gemini", c.model, time.Since(start), gen, err)
+	}()
+
+	req := c.buildRequest(messages, opts)
+	stream := opts.StreamingFunc != nil
+	resp, err := c.do(ctx, req, stream)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if stream {
+		return c.handleStreamResponse(ctx, resp.Body, opts)
+	}
+	var result geminiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode gemini response: %w", err)
+	}
+	acc := &geminiAccumulator{}
+	if err := acc.add(result, nil); err != nil {
+		return nil, err
+	}
+	return c.finishGeneration(acc), nil
+}
+
+// buildRequest 转换为generateContent请求
+func (c *GeminiClient) buildRequest(messages []Message, opts *GenerateOptions) *geminiRequest {
+	req := &geminiRequest{}
+	config := &geminiGenerationConfig{
+		TopK:             opts.TopK,
+		MaxOutputTokens:  opts.MaxTokens,
+		StopSequences:    opts.StopWords,
+		ResponseMIMEType: opts.ResponseMIMEType,
+	}
+	if opts.Temperature > 0 {
+		config.Temperature = &opts.Temperature
+	}
+	if opts.TopP > 0 {
+		config.TopP = &opts.TopP
+	}
+	if opts.Seed != 0 {
+		config.Seed = &opts.Seed
+	}
+	if opts.PresencePenalty != 0 {
+		config.PresencePenalty = &opts.PresencePenalty
+	}
+	if opts.FrequencyPenalty != 0 {
+		config.FrequencyPenalty = &opts.FrequencyPenalty
+	}
+	if config.ResponseMIMEType == "" && opts.JSONMode {
+		config.ResponseMIMEType = "application/json"
+	}
+	if c.thinkingBudget != nil {
+		config.ThinkingConfig = &geminiThinkingConfig{ThinkingBudget: c.thinkingBudget, IncludeThoughts: c.includeThoughts && *c.thinkingBudget != 0}
+	}
+	req.GenerationConfig = config
+
+	var declarations []geminiFunctionDeclaration
+	for _, tool := range opts.Tools {
+		if tool.Function == nil {
+			continue
+		}
+		declarations = append(declarations, geminiFunctionDeclaration{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			Parameters:  GeminiSchema(tool.Function.Parameters),
+		})
+	}
+	if len(declarations) > 0 {
+		req.Tools = []geminiTool{{FunctionDeclarations: declarations}}
+		req.ToolConfig = geminiChoice(opts.ToolChoice)
+	}
+
+	// functionResponse需要函数名称，从之前的工具调用中查找
+	toolNames := make(map[string]string)
+	for _, msg := range messages {
+		switch msg.Role {
+		case RoleSystem:
+			if strings.TrimSpace(msg.Content) == "" {
+				continue
+			}
+			if req.SystemInstruction == nil {
+				req.SystemInstruction = &geminiContent{}
+			}
+			req.SystemInstruction.Parts = append(req.SystemInstruction.Parts, geminiPart{Text: msg.Content})
+		case RoleTool:
+			req.Contents = appendGeminiContent(req.Contents, "user", geminiPart{FunctionResponse: &geminiFunctionResponse{
+				ID:       msg.ToolCallId,
+				Name:     toolNames[msg.ToolCallId],
+				Response: geminiFunctionOutput(msg.Content),
+			}})
+		case RoleAssistant:
+			var parts []geminiPart
+			if strings.TrimSpace(msg.Content) != "" {
+				parts = append(parts, geminiPart{Text: msg.Content})
+			}
+			for _, tc := range msg.ToolCalls {
+				if tc.Function == nil {
+					continue
+				}
+				toolNames[tc.ID] = tc.Function.Name
+				args := json.RawMessage(tc.Function.Arguments)
+				if !json.Valid(args) {
+					args = json.RawMessage("{}")
+				}
+				parts = append(parts, geminiPart{
+					FunctionCall:     &geminiFunctionCall{ID: tc.ID, Name: tc.Function.Name, Args: args},
+					ThoughtSignature: c.cachedSignature(tc.ID),
+				})
+			}
+			req.Contents = appendGeminiContent(req.Contents, "model", parts...)
+		default:
+			if strings.TrimSpace(msg.Content) != "" {
+				req.Contents = appendGeminiContent(req.Contents, "user", geminiPart{Text: msg.Content})
+			}
+		}
+	}
+	return req
+}
+
+// appendGeminiContent 追加部分，与上一条内容角色相同时合并，例如多个函数结果需要放在同一条内容中
+func appendGeminiContent(contents []geminiContent, role string, parts ...geminiPart) []geminiContent {
+	if len(parts) == 0 {
+		return contents
+	}
+	if n := len(contents); n > 0 && contents[n-1].Role == role {
+		contents[n-1].Parts = append(contents[n-1].Parts, parts...)
+		return contents
+	}
+	return append(contents, geminiContent{Role: role, Parts: parts})
+}
+
+// geminiFunctionOutput 函数结果必须是JSON对象，不是对象时放在output字段中
+func geminiFunctionOutput(content string) map[string]any {
+	var object map[string]any
+	if err := json.Unmarshal([]byte(content), &object); err == nil && object != nil {
+		return object
+	}
+	return map[string]any{"output": content}
+}
+
+// geminiChoice 将OpenAI风格的ToolChoice转换为Gemini的函数调用配置
+func geminiChoice(choice any) *geminiToolConfig {
+	config := &geminiToolConfig{}
+	switch v := choice.(type) {
+	case string:
+		switch v {
+		case "none":
+			config.FunctionCallingConfig.Mode = "NONE"
+		case "required", "any":
+			config.FunctionCallingConfig.Mode = "ANY"
+		case "auto":
+			config.FunctionCallingConfig.Mode = "AUTO"
+		default:
+			return nil
+		}
+	case ToolChoice:
+		if v.Function == nil {
+			return nil
+		}
+		config.FunctionCallingConfig.Mode = "ANY"
+		config.FunctionCallingConfig.AllowedFunctionNames = []string{v.Function.Name}
+	case *ToolChoice:
+		if v == nil || v.Function == nil {
+			return nil
+		}
+		config.FunctionCallingConfig.Mode = "ANY"
+		config.FunctionCallingConfig.AllowedFunctionNames = []string{v.Function.Name}
+	default:
+		return nil
+	}
+	return config
+}
+
+// do 发送请求，非2xx响应转换为错误
+func (c *GeminiClient) do(ctx context.Context, req *geminiRequest, stream bool) (*http.Response, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal gemini request: %w", err)
+	}
+	method := "generateContent"
+	if stream {
+		method = "streamGenerateContent?alt=sse"
+	}
+	endpoint := fmt.Sprintf("%s/%s/models/%s:%s", c.baseURL, c.apiVersion, url.PathEscape(c.model), method)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-goog-api-key", c.apiKey)
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send gemini request: %w", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		bs, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		var apiErr geminiError
+		if json.Unmarshal(bs, &apiErr) == nil && apiErr.Error.Message != "" {
+			return nil, fmt.Errorf("gemini: %s: %s (status %d)", apiErr.Error.Status, apiErr.Error.Message, resp.StatusCode)
+		}
+		return nil, fmt.Errorf("gemini: unexpected status code %d: %s", resp.StatusCode, strings.TrimSpace(string(bs)))
+	}
+	return resp, nil
+}
+
+// geminiAccumulator 合并响应（流式时为多个分块）中的内容
+type geminiAccumulator struct {
+	content    strings.Builder
+	reasoning  strings.Builder
+	toolCalls  []ToolCall
+	signatures map[string]string
+	stopReason string
+	usage      *geminiUsage
+	model      string
+}
+
+// add 合并一个响应，emit不为空时以OpenAI的格式输出增量
+func (a *geminiAccumulator) add(resp geminiResponse, emit func(openai.ChatCompletionStreamChoiceDelta) error) error {
+	if resp.UsageMetadata != nil {
+		a.usage = resp.UsageMetadata
+	}
+	if resp.ModelVersion != "" {
+		a.model = resp.ModelVersion
+	}
+	if len(resp.Candidates) == 0 {
+		if resp.PromptFeedback != nil && resp.PromptFeedback.BlockReason != "" {
+			return fmt.Errorf("gemini: prompt blocked: %s", resp.PromptFeedback.BlockReason)
+		}
+		return nil
+	}
+
+	candidate := resp.Candidates[0]
+	if candidate.FinishReason != "" {
+		a.stopReason = geminiStopReason(candidate.FinishReason)
+	}
+	var delta openai.ChatCompletionStreamChoiceDelta
+	for _, part := range candidate.Content.Parts {
+		switch {
+		case part.FunctionCall != nil:
+			args := string(part.FunctionCall.Args)
+			if args == "" || args == "null" {
+				args = "{}"
+			}
+			toolCall := ToolCall{
+				ID:       part.FunctionCall.ID,
+				Type:     string(openai.ToolTypeFunction),
+				Function: &FunctionCall{Name: part.FunctionCall.Name, Arguments: args},
+			}
+			if toolCall.ID == "" {
+				toolCall.ID = newToolCallID()
+			}
+			if part.ThoughtSignature != "" {
+				if a.signatures == nil {
+					a.signatures = make(map[string]string)
+				}
+				a.signatures[toolCall.ID] = part.ThoughtSignature
+			}
+			index := len(a.toolCalls)
+			a.toolCalls = append(a.toolCalls, toolCall)
+			delta.ToolCalls = append(delta.ToolCalls, openai.ToolCall{
+				Index:    &index,
+				ID:       toolCall.ID,
+				Type:     openai.ToolTypeFunction,
+				Function: openai.FunctionCall{Name: toolCall.Function.Name, Arguments: args},
+			})
+		case part.Thought:
+			a.reasoning.WriteString(part.Text)
+			delta.ReasoningContent += part.Text
+		default:
+			a.content.WriteString(part.Text)
+			delta.Content += part.Text
+		}
+	}
+	if emit != nil && (delta.Content != "" || delta.ReasoningContent != "" || len(delta.ToolCalls) > 0) {
+		return emit(delta)
+	}
+	return nil
+}
+
+// finishGeneration 生成Generation，并缓存函数调用的思考签名
+func (c *GeminiClient) finishGeneration(acc *geminiAccumulator) *Generation {
+	gen := &Generation{
+		Role:             openai.ChatMessageRoleAssistant,
+		Content:          strings.TrimSpace(acc.content.String()),
+		ReasoningContent: strings.TrimSpace(acc.reasoning.String()),
+		StopReason:       acc.stopReason,
+		ToolCalls:        acc.toolCalls,
+		GenerationInfo:   make(map[string]any),
+	}
+	setGenerationModel(gen, acc.model)
+	if len(gen.ToolCalls) > 0 {
+		// Gemini对函数调用也返回STOP
+		gen.StopReason = string(openai.FinishReasonToolCalls)
+	}
+	if acc.usage != nil {
+		gen.Usage = &Usage{
+			PromptTokens:     acc.usage.PromptTokenCount,
+			CompletionTokens: acc.usage.CandidatesTokenCount + acc.usage.ThoughtsTokenCount,
+			TotalTokens:      acc.usage.TotalTokenCount,
+		}
+		if gen.Usage.TotalTokens == 0 {
+			gen.Usage.TotalTokens = gen.Usage.PromptTokens + gen.Usage.CompletionTokens
+		}
+		if acc.usage.CachedContentTokenCount > 0 {
+			gen.GenerationInfo[GenerationInfoCacheReadTokens] = acc.usage.CachedContentTokenCount
+		}
+		if acc.usage.ThoughtsTokenCount > 0 {
+			gen.GenerationInfo[GenerationInfoThoughtsTokens] = acc.usage.ThoughtsTokenCount
+		}
+	}
+
+	gen.Messages = append(gen.Messages, assistantMessage(gen))
+
+	for id, signature := range acc.signatures {
+		c.cacheSignature(id, signature)
+	}
+	return gen
+}
+
+// handleStreamResponse 处理SSE流式响应，每个事件都是一个完整的响应分块
+func (c *GeminiClient) handleStreamResponse(ctx context.Context, body io.Reader, opts *GenerateOptions) (*Generation, error) {
+	emit := func(delta openai.ChatCompletionStreamChoiceDelta) error {
+		if opts.DisableStreamingFunc {
+			return nil
+		}
+		if err := opts.StreamingFunc(ctx, &delta, nil, 0); err != nil {
+			return fmt.Errorf("streaming function returned error: %w", err)
+		}
+		return nil
+	}
+
+	acc := &geminiAccumulator{}
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		var chunk geminiResponse
+		if err := json.Unmarshal([]byte(strings.TrimSpace(data)), &chunk); err != nil {
+			return nil, fmt.Errorf("failed to decode gemini stream chunk: %w", err)
+		}
+		if err := acc.add(chunk, emit); err != nil {
+			return c.finishGeneration(acc), err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, context.Canceled) {
+			return c.finishGeneration(acc), nil
+		}
+		return nil, fmt.Errorf("error receiving from stream: %w", err)
+	}
+	return c.finishGeneration(acc), nil
+}
+
+// geminiStopReason 转换为OpenAI的结束原因
+func geminiStopReason(reason string) string {
+	switch reason {
+	case "STOP":
+		return string(openai.FinishReasonStop)
+	case "MAX_TOKENS":
+		return string(openai.FinishReasonLength)
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII":
+		return string(openai.FinishReasonContentFilter)
+	default:
+		return strings.ToLower(reason)
+	}
+}
+
+func (c *GeminiClient) cacheSignature(toolCallID string, signature string) {
+	c.signatureMutex.Lock()
+	defer c.signatureMutex.Unlock()
+
+	if _, exists := c.signatures[toolCallID]; !exists {
+		c.signatureOrder = append(c.signatureOrder, toolCallID)
+	}
+	c.signatures[toolCallID] = signature
+	for len(c.signatureOrder) > geminiSignatureCacheSize {
+		delete(c.signatures, c.signatureOrder[0])
+		c.signatureOrder = c.signatureOrder[1:]
+	}
+}
+
+func (c *GeminiClient) cachedSignature(toolCallID string) string {
+	c.signatureMutex.Lock()
+	defer c.signatureMutex.Unlock()
+
+	return c.signatures[toolCallID]
+}
+
+// Gemini函数声明支持的Schema关键字（OpenAPI 3.0的子集）
+var geminiSchemaKeys = map[string]bool{
+	"type": true, "format": true, "title": true, "description": true, "nullable": true, "enum": true,
+	"properties": true, "required": true, "items": true, "minItems": true, "maxItems": true,
+	"minimum": true, "maximum": true, "minLength": true, "maxLength": true, "pattern": true,
+	"anyOf": true, "propertyOrdering": true, "minProperties": true, "maxProperties": true, "default": true,
+}
+
+// GeminiSchema 将JSON Schema降级为Gemini函数声明支持的子集：展开本地$ref，将类型数组转换为nullable，
+// const转换为enum，oneOf转换为anyOf，合并allOf，并去除不支持的关键字。没有参数时返回nil
+func GeminiSchema(schema any) any {
+	if schema == nil {
+		return nil
+	}
+	var root any
+	bs, err := json.Marshal(schema)
+	if err != nil || json.Unmarshal(bs, &root) != nil {
+		return nil
+	}
+	object, ok := root.(map[string]any)
+	if !ok {
+		return nil
+	}
+	converted := (&geminiSchemaConverter{resolver: &schemaValidator{root: root}}).convert(object, 0)
+	// 没有属性的对象类型参数会被拒绝
+	if properties, _ := converted["properties"].(map[string]any); converted["type"] == "object" && len(properties) == 0 {
+		return nil
+	}
+	return converted
+}
+
+type geminiSchemaConverter struct {
+	resolver *schemaValidator
+}
+
+func (g *geminiSchemaConverter) convert(schema map[string]any, depth int) map[string]any {
+	result := make(map[string]any)
+	if depth > 32 {
+		// 循环引用时截断
+		result["type"] = "object"
+		return result
+	}
+
+	if ref, ok := schema["$ref"].(string); ok {
+		if target, err := g.resolver.resolveRef(ref); err == nil {
+			if object, ok := target.(map[string]any); ok {
+				merged := make(map[string]any, len(object)+len(schema))
+				for k, v := range object {
+					merged[k] = v
+				}
+				for k, v := range schema {
+					if k != "$ref" {
+						merged[k] = v
+					}
+				}
+				return g.convert(merged, depth+1)
+			}
+		}
+	}
+
+	if allOf, ok := schema["allOf"].([]any); ok {
+		merged := make(map[string]any, len(schema))
+		for k, v := range schema {
+			if k != "allOf" {
+				merged[k] = v
+			}
+		}
+		for _, branch := range allOf {
+			if object, ok := branch.(map[string]any); ok {
+				mergeGeminiSchema(merged, g.convert(object, depth+1))
+			}
+		}
+		return g.convert(merged, depth+1)
+	}
+
+	for key, value := range schema {
+		switch key {
+		case "type":
+			types := schemaTypes(value)
+			var nonNull []string
+			for _, t := range types {
+				if t == "null" {
+					result["nullable"] = true
+				} else {
+					nonNull = append(nonNull, t)
+				}
+			}
+			if len(nonNull) == 1 {
+				result["type"] = nonNull[0]
+			} else if len(nonNull) > 1 {
+				var anyOf []any
+				for _, t := range nonNull {
+					anyOf = append(anyOf, map[string]any{"type": t})
+				}
+				result["anyOf"] = anyOf
+			}
+		case "const":
+			if s, ok := value.(string); ok {
+				result["enum"] = []any{s}
+			}
+		case "enum":
+			if enum, ok := geminiEnum(value); ok {
+				result["enum"] = enum
+			} else if bs, err := json.Marshal(value); err == nil {
+				// 非字符串的枚举值不被支持，写入描述中
+				description, _ := schema["description"].(string)
+				result["description"] = strings.TrimSpace(description + " Allowed values: " + string(bs))
+			}
+		case "properties":
+			if properties, ok := value.(map[string]any); ok {
+				converted := make(map[string]any, len(properties))
+				for name, property := range properties {
+					if object, ok := property.(map[string]any); ok {
+						converted[name] = g.convert(object, depth+1)
+					}
+				}
+				result["properties"] = converted
+			}
+		case "items":
+			if object, ok := value.(map[string]any); ok {
+				result["items"] = g.convert(object, depth+1)
+			}
+		case "anyOf", "oneOf":
+			if branches, ok := value.([]any); ok {
+				var anyOf []any
+				for _, branch := range branches {
+					if object, ok := branch.(map[string]any); ok {
+						if object["type"] == "null" {
+							result["nullable"] = true
+							continue
+						}
+						anyOf = append(anyOf, g.convert(object, depth+1))
+					}
+				}
+				if len(anyOf) == 1 {
+					for k, v := range anyOf[0].(map[string]any) {
+						if _, exists := result[k]; !exists {
+							result[k] = v
+						}
+					}
+				} else if len(anyOf) > 1 {
+					result["anyOf"] = anyOf
+				}
+			}
+		case "format":
+			// 字符串只支持enum和date-time格式
+			if format, ok := value.(string); ok && (format == "enum" || format == "date-time" || schema["type"] != "string") {
+				result["format"] = format
+			}
+		case "exclusiveMinimum":
+			if _, exists := schema["minimum"]; !exists {
+				result["minimum"] = value
+			}
+		case "exclusiveMaximum":
+			if _, exists := schema["maximum"]; !exists {
+				result["maximum"] = value
+			}
+		case "description":
+			if _, exists := result["description"]; !exists {
+				result["description"] = value
+			}
+		default:
+			if geminiSchemaKeys[key] {
+				result[key] = value
+			}
+		}
+	}
+
+	if _, ok := result["enum"]; ok {
+		result["type"] = "string"
+	}
+	if required, ok := result["required"].([]any); ok {
+		// required中的属性必须存在
+		properties, _ := result["properties"].(map[string]any)
+		var filtered []any
+		for _, name := range required {
+			if s, ok := name.(string); ok && properties[s] != nil {
+				filtered = append(filtered, s)
+			}
+		}
+		if len(filtered) == 0 {
+			delete(result, "required")
+		} else {
+			result["required"] = filtered
+		}
+	}
+	return result
+}
+
+// mergeGeminiSchema 合并allOf中的分支
+func mergeGeminiSchema(dst map[string]any, src map[string]any) {
+	for k, v := range src {
+		switch k {
+		case "properties":
+			properties, _ := dst["properties"].(map[string]any)
+			if properties == nil {
+				properties = make(map[string]any)
+			}
+			for name, property := range v.(map[string]any) {
+				properties[name] = property
+			}
+			dst["properties"] = properties
+		case "required":
+			existing, _ := dst["required"].([]any)
+			dst["required"] = append(existing, v.([]any)...)
+		default:
+			if _, exists := dst[k]; !exists {
+				dst[k] = v
+			}
+		}
+	}
+}
+
+// geminiEnum enum只支持字符串值，null表示可为空
+func geminiEnum(value any) ([]any, bool) {
+	values, ok := value.([]any)
+	if !ok {
+		return nil, false
+	}
+	enum := make([]any, 0, len(values))
+	for _, v := range values {
+		switch x := v.(type) {
+		case nil:
+			continue
+		case string:
+			enum = append(enum, x)
+		default:
+			return nil, false
+		}
+	}
+	return enum, len(enum) > 0
+}
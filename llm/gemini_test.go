@@ -0,0 +1,269 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// newGeminiTestClient 启动模拟generateContent API的服务器，handle收到请求路径和解码后的请求并写入响应
+func newGeminiTestClient(t *testing.T, handle func(t *testing.T, path string, req geminiRequest, w http.ResponseWriter), opts ...GeminiOption) *GeminiClient {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("x-goog-api-key"); got != "test-key" {
+			t.Errorf("x-goog-api-key = %q", got)
+		}
+		var req geminiRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		handle(t, r.URL.RequestURI(), req, w)
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := NewGeminiClient(append([]GeminiOption{
+		WithGeminiAPIKey("test-key"),
+		WithGeminiBaseURL(server.URL),
+		WithGeminiModel("gemini-test"),
+	}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestGeminiGenerateContent(t *testing.T) {
+	requests := 0
+	client := newGeminiTestClient(t, func(t *testing.T, path string, req geminiRequest, w http.ResponseWriter) {
+		requests++
+		if path != "/v1beta/models/gemini-test:generateContent" {
+			t.Errorf("path = %s", path)
+		}
+		if req.SystemInstruction == nil || len(req.SystemInstruction.Parts) != 1 || req.SystemInstruction.Parts[0].Text != "be brief" {
+			t.Errorf("system instruction = %+v", req.SystemInstruction)
+		}
+		if len(req.Tools) != 1 || len(req.Tools[0].FunctionDeclarations) != 1 || req.Tools[0].FunctionDeclarations[0].Name != "weather.forecast" {
+			t.Fatalf("tools = %+v", req.Tools)
+		}
+		if req.ToolConfig == nil || req.ToolConfig.FunctionCallingConfig.Mode != "ANY" {
+			t.Errorf("tool config = %+v", req.ToolConfig)
+		}
+
+		if requests == 1 {
+			if req.GenerationConfig == nil || req.GenerationConfig.ResponseMIMEType != "application/json" {
+				t.Errorf("generation config = %+v", req.GenerationConfig)
+			}
+			fmt.Fprint(w, `{"modelVersion":"gemini-test-001","candidates":[{"finishReason":"STOP","content":{"role":"model","parts":[
+				{"text":"checking"},
+				{"functionCall":{"id":"fc_1","name":"weather.forecast","args":{"city":"Paris"}},"thoughtSignature":"sig-1"}]}}],
+				"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":4,"thoughtsTokenCount":6,"totalTokenCount":20}}`)
+			return
+		}
+
+		// user, model(text + functionCall x2), user(functionResponse x2)
+		if len(req.Contents) != 3 {
+			t.Fatalf("contents = %+v", req.Contents)
+		}
+		model := req.Contents[1]
+		if model.Role != "model" || len(model.Parts) != 3 || model.Parts[1].FunctionCall == nil || model.Parts[1].ThoughtSignature != "sig-1" || model.Parts[2].ThoughtSignature != "" {
+			t.Errorf("function call should be sent back with its signature: %+v", model)
+		}
+		responses := req.Contents[2]
+		if responses.Role != "user" || len(responses.Parts) != 2 {
+			t.Fatalf("function responses should be merged into one content: %+v", responses)
+		}
+		first, second := responses.Parts[0].FunctionResponse, responses.Parts[1].FunctionResponse
+		if first == nil || first.Name != "weather.forecast" || !reflect.DeepEqual(first.Response, map[string]any{"temp": float64(21)}) {
+			t.Errorf("first response = %+v", first)
+		}
+		if second == nil || second.Name != "weather.forecast" || !reflect.DeepEqual(second.Response, map[string]any{"output": "sunny"}) {
+			t.Errorf("non-object output should be wrapped: %+v", second)
+		}
+		fmt.Fprint(w, `{"candidates":[{"finishReason":"STOP","content":{"role":"model","parts":[{"text":"21 and sunny"}]}}]}`)
+	})
+
+	tools := []Tool{{Type: "function", Function: &FunctionDefinition{Name: "weather.forecast", Parameters: map[string]any{
+		"type":       "object",
+		"properties": map[string]any{"city": map[string]any{"type": "string"}},
+	}}}}
+	messages := []Message{*NewSystemMessage("", "be brief"), *NewUserMessage("", "weather?")}
+	gen, err := client.GenerateContent(context.Background(), messages, WithTools(tools), func(o *GenerateOptions) {
+		o.ToolChoice = "required"
+		o.JSONMode = true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gen.Content != "checking" || gen.StopReason != string(openai.FinishReasonToolCalls) {
+		t.Errorf("content = %q, stop reason = %q", gen.Content, gen.StopReason)
+	}
+	if len(gen.ToolCalls) != 1 || gen.ToolCalls[0].ID != "fc_1" || gen.ToolCalls[0].Function.Arguments != `{"city":"Paris"}` {
+		t.Fatalf("tool calls = %+v", gen.ToolCalls)
+	}
+	if gen.Usage == nil || gen.Usage.PromptTokens != 10 || gen.Usage.CompletionTokens != 10 || gen.Usage.TotalTokens != 20 {
+		t.Errorf("usage = %+v", gen.Usage)
+	}
+	if gen.GenerationInfo[GenerationInfoThoughtsTokens] != 6 || gen.GenerationInfo[GenerationInfoModel] != "gemini-test-001" {
+		t.Errorf("generation info = %+v", gen.GenerationInfo)
+	}
+
+	toolCalls := append(gen.ToolCalls, ToolCall{ID: "fc_2", Type: "function", Function: &FunctionCall{Name: "weather.forecast", Arguments: `{}`}})
+	messages = append(messages,
+		*NewAssistantMessage("", gen.Content, toolCalls),
+		*NewToolMessage("fc_1", `{"temp":21}`),
+		*NewToolMessage("fc_2", "sunny"),
+	)
+	gen, err = client.GenerateContent(context.Background(), messages, WithTools(tools), func(o *GenerateOptions) {
+		o.ToolChoice = "required"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gen.Content != "21 and sunny" || gen.StopReason != string(openai.FinishReasonStop) {
+		t.Errorf("content = %q, stop reason = %q", gen.Content, gen.StopReason)
+	}
+}
+
+func TestGeminiStream(t *testing.T) {
+	client := newGeminiTestClient(t, func(t *testing.T, path string, req geminiRequest, w http.ResponseWriter) {
+		if path != "/v1beta/models/gemini-test:streamGenerateContent?alt=sse" {
+			t.Errorf("path = %s", path)
+		}
+		if config := req.GenerationConfig; config == nil || config.ThinkingConfig == nil || *config.ThinkingConfig.ThinkingBudget != 512 || !config.ThinkingConfig.IncludeThoughts {
+			t.Errorf("generation config = %+v", req.GenerationConfig)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range []string{
+			`{"candidates":[{"content":{"role":"model","parts":[{"text":"weighing options","thought":true}]}}]}`,
+			`{"candidates":[{"content":{"role":"model","parts":[{"text":"Hello "}]}}]}`,
+			`{"candidates":[{"content":{"role":"model","parts":[{"text":"world"},{"functionCall":{"name":"files.list"}}]},"finishReason":"STOP"}],` +
+				`"usageMetadata":{"promptTokenCount":3,"candidatesTokenCount":2}}`,
+		} {
+			fmt.Fprintf(w, "data: %s\n\n", chunk)
+		}
+	}, WithGeminiThinking(512, true))
+
+	var content, reasoning strings.Builder
+	var toolCalls []openai.ToolCall
+	streaming := func(ctx context.Context, delta *openai.ChatCompletionStreamChoiceDelta, _ []MCPToolExecutionResult, _ int) error {
+		content.WriteString(delta.Content)
+		reasoning.WriteString(delta.ReasoningContent)
+		toolCalls = append(toolCalls, delta.ToolCalls...)
+		return nil
+	}
+	gen, err := client.GenerateContent(context.Background(), []Message{*NewUserMessage("", "hi")}, WithStreamingFunc(streaming))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content.String() != "Hello world" || reasoning.String() != "weighing options" {
+		t.Errorf("streamed content = %q, reasoning = %q", content.String(), reasoning.String())
+	}
+	if len(toolCalls) != 1 || toolCalls[0].Function.Name != "files.list" || toolCalls[0].Function.Arguments != "{}" {
+		t.Errorf("streamed tool calls = %+v", toolCalls)
+	}
+	if gen.Content != "Hello world" || gen.ReasoningContent != "weighing options" || gen.StopReason != string(openai.FinishReasonToolCalls) {
+		t.Errorf("generation = %+v", gen)
+	}
+	if len(gen.ToolCalls) != 1 || !strings.HasPrefix(gen.ToolCalls[0].ID, "call_") || gen.ToolCalls[0].ID != toolCalls[0].ID {
+		t.Errorf("tool call without id should get the same generated id in the stream and the result: %+v", gen.ToolCalls)
+	}
+	if gen.Usage == nil || gen.Usage.TotalTokens != 5 {
+		t.Errorf("usage = %+v", gen.Usage)
+	}
+	if gen.GenerationInfo[GenerationInfoModel] != "gemini-test" {
+		t.Errorf("model should fall back to the configured model, got %v", gen.GenerationInfo[GenerationInfoModel])
+	}
+}
+
+func TestGeminiErrorResponse(t *testing.T) {
+	client := newGeminiTestClient(t, func(t *testing.T, path string, req geminiRequest, w http.ResponseWriter) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"error":{"code":400,"status":"INVALID_ARGUMENT","message":"bad schema"}}`)
+	})
+	_, err := client.GenerateContent(context.Background(), []Message{*NewUserMessage("", "hi")})
+	if err == nil || !strings.Contains(err.Error(), "INVALID_ARGUMENT: bad schema (status 400)") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestGeminiSchema(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		want   string
+	}{
+		{
+			name:   "empty object",
+			schema: `{"type":"object","properties":{}}`,
+			want:   `null`,
+		},
+		{
+			name: "unsupported keywords and required",
+			schema: `{"$schema":"http://json-schema.org/draft-07/schema#","type":"object","additionalProperties":false,
+				"properties":{"q":{"type":"string","format":"uri","minLength":1}},"required":["q","missing"]}`,
+			want: `{"type":"object","properties":{"q":{"type":"string","minLength":1}},"required":["q"]}`,
+		},
+		{
+			name: "nullable types, const and oneOf",
+			schema: `{"type":"object","properties":{
+				"a":{"type":["integer","null"]},
+				"b":{"const":"fixed"},
+				"c":{"oneOf":[{"type":"string"},{"type":"null"}]},
+				"d":{"anyOf":[{"type":"string"},{"type":"number"}]},
+				"e":{"type":["string","integer"]}}}`,
+			want: `{"type":"object","properties":{
+				"a":{"type":"integer","nullable":true},
+				"b":{"type":"string","enum":["fixed"]},
+				"c":{"type":"string","nullable":true},
+				"d":{"anyOf":[{"type":"string"},{"type":"number"}]},
+				"e":{"anyOf":[{"type":"string"},{"type":"integer"}]}}}`,
+		},
+		{
+			name:   "non-string enum",
+			schema: `{"type":"object","properties":{"n":{"type":"integer","enum":[1,2],"description":"level"}}}`,
+			want:   `{"type":"object","properties":{"n":{"type":"integer","description":"level Allowed values: [1,2]"}}}`,
+		},
+		{
+			name: "refs and allOf",
+			schema: `{"type":"object","$defs":{"city":{"type":"string","description":"city name"}},
+				"properties":{"from":{"$ref":"#/$defs/city"},"range":{"allOf":[
+					{"type":"object","properties":{"min":{"type":"number","exclusiveMinimum":0}},"required":["min"]},
+					{"properties":{"max":{"type":"number"}},"required":["max"]}]}}}`,
+			want: `{"type":"object","properties":{
+				"from":{"type":"string","description":"city name"},
+				"range":{"type":"object","properties":{"min":{"type":"number","minimum":0},"max":{"type":"number"}},"required":["min","max"]}}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var schema, want any
+			if err := json.Unmarshal([]byte(tt.schema), &schema); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			got := GeminiSchema(schema)
+			if want == nil {
+				if got != nil {
+					t.Errorf("GeminiSchema() = %v, want nil", got)
+				}
+				return
+			}
+			// 统一为JSON值后比较
+			bs, _ := json.Marshal(got)
+			var normalized any
+			json.Unmarshal(bs, &normalized)
+			if !reflect.DeepEqual(normalized, want) {
+				t.Errorf("GeminiSchema() = %s\nwant %s", bs, tt.want)
+			}
+		})
+	}
+}
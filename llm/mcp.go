@@ -12,6 +12,7 @@ import (
 	"github.com/longdexin/MCP_Host"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/sashabaranov/go-openai"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // MCPTask MCP任务
@@ -40,28 +41,52 @@ type QwenTool struct {
 
 // TaskResult 任务执行的结果
 type TaskResult struct {
-	Task   MCPTask `json:"task"`            // 执行的任务
-	Result any     `json:"result"`          // 执行结果
-	Error  string  `json:"error,omitempty"` // 错误信息，如果有的话
+	Task              MCPTask `json:"task"`                         // 执行的任务
+	Result            any     `json:"result"`                       // 执行结果
+	StructuredContent any     `json:"structured_content,omitempty"` // 结构化执行结果
+	Error             string  `json:"error,omitempty"`              // 错误信息，如果有的话
 }
 
 // MCPClient MCP的LLM客户端包装
 type MCPClient struct {
-	llm  LLM               // 底层LLM客户端
-	host *MCP_Host.MCPHost // MCP主机
+	llm            LLM                  // 底层LLM客户端
+	host           *MCP_Host.MCPHost    // MCP主机
+	tracerProvider trace.TracerProvider // 链路追踪
+	toolSelector   ToolSelector         // 工具选择器
+	contextManager *ContextManager      // 上下文管理器
+	pricing        PricingTable         // 价格表
+	validateArgs   bool                 // 直接执行任务或工具调用时校验参数
+	coerceArgs     bool                 // 直接执行时校验参数并进行安全的类型转换
+}
+
+// MCPClientOption MCPClient的配置选项
+type MCPClientOption func(*MCPClient)
+
+// WithMCPTracerProvider 设置链路追踪的TracerProvider，默认使用全局TracerProvider
+func WithMCPTracerProvider(provider trace.TracerProvider) MCPClientOption {
+	return func(c *MCPClient) {
+		c.tracerProvider = provider
+	}
 }
 
 // NewMCPClient 创建一个新的MCPClient
-func NewMCPClient(llm LLM, host *MCP_Host.MCPHost) *MCPClient {
-	return &MCPClient{
+func NewMCPClient(llm LLM, host *MCP_Host.MCPHost, opts ...MCPClientOption) *MCPClient {
+	c := &MCPClient{
 		llm:  llm,
 		host: host,
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
 // Generate 生成回复并处理MCP任务
 func (c *MCPClient) Generate(ctx context.Context, messages []Message, options ...GenerateOption) (*Generation, error) {
 	opts := c.prepareOptions(options)
+	if opts.MCPWorkMode == PlanMode {
+		return c.generatePlanned(ctx, messages, opts, options)
+	}
 
 	// 在文本模式下添加MCP提示
 	if opts.MCPWorkMode == TextMode {
@@ -69,7 +94,7 @@ func (c *MCPClient) Generate(ctx context.Context, messages []Message, options ..
 		if systemPrompt == "" {
 			return nil, errors.New("system prompt template is blank")
 		}
-		tools := c.createOrderedMCPTools(ctx, opts.MCPTools, opts.MCPDisabledTools)
+		tools, selectionInfo := c.selectTools(ctx, messages, opts, c.createOrderedMCPTools(ctx, opts.MCPTools, opts.MCPDisabledTools))
 		if len(tools) == 0 {
 			return nil, errors.New("no available tools")
 		}
@@ -90,12 +115,19 @@ func (c *MCPClient) Generate(ctx context.Context, messages []Message, options ..
 		allMessages := make([]Message, 0, len(messages)+1)
 		allMessages = append(allMessages, *NewSystemMessage("", systemPrompt))
 		allMessages = append(allMessages, messages...)
+		allMessages, trim, err := c.fitContext(ctx, allMessages, opts, 0)
+		if err != nil {
+			return nil, err
+		}
 		gen, err := c.llm.GenerateContent(ctx, allMessages, options...)
 		if err != nil {
 			return nil, err
 		}
 
 		// 存储MCP相关信息，以便在后续处理中使用
+		applySelectionInfo(gen, selectionInfo)
+		c.startUsage(gen, opts)
+		c.recordContextTrim(gen, opts, trim)
 		gen.MCPWorkMode = opts.MCPWorkMode
 		gen.MCPTaskTag = opts.MCPTaskTag
 		gen.MCPResultTag = opts.MCPResultTag
@@ -109,15 +141,22 @@ func (c *MCPClient) Generate(ctx context.Context, messages []Message, options ..
 		return gen, nil
 	} else {
 		// 函数调用模式
-		tools := c.createMCPTools(ctx, opts.MCPDisabledTools)
+		tools, selectionInfo := c.selectTools(ctx, messages, opts, c.createMCPTools(ctx, opts.MCPDisabledTools))
 
 		toolsOption := WithTools(tools)
-		gen, err := c.llm.Generate(ctx, messages, append(options, toolsOption)...)
+		fitted, trim, err := c.fitContext(ctx, messages, opts, 0)
+		if err != nil {
+			return nil, err
+		}
+		gen, err := c.llm.Generate(ctx, fitted, append(options, toolsOption)...)
 		if err != nil {
 			return nil, err
 		}
 
 		// 存储MCP相关信息
+		applySelectionInfo(gen, selectionInfo)
+		c.startUsage(gen, opts)
+		c.recordContextTrim(gen, opts, trim)
 		gen.MCPWorkMode = opts.MCPWorkMode
 		gen.MCPTaskTag = opts.MCPTaskTag
 
@@ -134,6 +173,9 @@ func (c *MCPClient) Generate(ctx context.Context, messages []Message, options ..
 // GenerateContent 生成回复并处理MCP任务
 func (c *MCPClient) GenerateContent(ctx context.Context, messages []Message, options ...GenerateOption) (*Generation, error) {
 	opts := c.prepareOptions(options)
+	if opts.MCPWorkMode == PlanMode {
+		return c.generatePlanned(ctx, messages, opts, options)
+	}
 
 	// 在文本模式下添加MCP提示
 	if opts.MCPWorkMode == TextMode {
@@ -142,7 +184,7 @@ func (c *MCPClient) GenerateContent(ctx context.Context, messages []Message, opt
 			return nil, errors.New("system prompt template is blank")
 		}
 
-		tools := c.createOrderedMCPTools(ctx, opts.MCPTools, opts.MCPDisabledTools)
+		tools, selectionInfo := c.selectTools(ctx, messages, opts, c.createOrderedMCPTools(ctx, opts.MCPTools, opts.MCPDisabledTools))
 		if len(tools) == 0 {
 			return nil, errors.New("no available tools")
 		}
@@ -164,6 +206,10 @@ func (c *MCPClient) GenerateContent(ctx context.Context, messages []Message, opt
 		allMessages := make([]Message, 0, len(messages)+1)
 		allMessages = append(allMessages, *NewSystemMessage("", systemPrompt))
 		allMessages = append(allMessages, messages...)
+		allMessages, trim, err := c.fitContext(ctx, allMessages, opts, 0)
+		if err != nil {
+			return nil, err
+		}
 
 		gen, err := c.llm.GenerateContent(ctx, allMessages, options...)
 		if err != nil {
@@ -171,6 +217,9 @@ func (c *MCPClient) GenerateContent(ctx context.Context, messages []Message, opt
 		}
 
 		// 存储MCP相关信息
+		applySelectionInfo(gen, selectionInfo)
+		c.startUsage(gen, opts)
+		c.recordContextTrim(gen, opts, trim)
 		gen.MCPWorkMode = opts.MCPWorkMode
 		gen.MCPTaskTag = opts.MCPTaskTag
 		gen.MCPResultTag = opts.MCPResultTag
@@ -183,15 +232,22 @@ func (c *MCPClient) GenerateContent(ctx context.Context, messages []Message, opt
 		return gen, nil
 	} else {
 		// 函数调用模式
-		tools := c.createMCPTools(ctx, opts.MCPDisabledTools)
+		tools, selectionInfo := c.selectTools(ctx, messages, opts, c.createMCPTools(ctx, opts.MCPDisabledTools))
 		toolsOption := WithTools(tools)
+		fitted, trim, err := c.fitContext(ctx, messages, opts, 0)
+		if err != nil {
+			return nil, err
+		}
 
-		gen, err := c.llm.GenerateContent(ctx, messages, append(options, toolsOption)...)
+		gen, err := c.llm.GenerateContent(ctx, fitted, append(options, toolsOption)...)
 		if err != nil {
 			return nil, err
 		}
 
 		// 存储MCP相关信息
+		applySelectionInfo(gen, selectionInfo)
+		c.startUsage(gen, opts)
+		c.recordContextTrim(gen, opts, trim)
 		gen.MCPWorkMode = opts.MCPWorkMode
 		gen.MCPTaskTag = opts.MCPTaskTag
 
@@ -215,7 +271,7 @@ func (c *MCPClient) GenerateContentWithGuard(ctx context.Context, messages []Mes
 	allGenMessages = append(allGenMessages, gen.Messages...)
 	if opts.EnableGuard {
 	REG_LOOP:
-		for range opts.RegenerationLimit {
+		for attempt := range opts.RegenerationLimit {
 			allMessages := make([]Message, 0, 2+len(messages)+len(gen.Messages))
 			systemMsg := NewSystemMessage("", opts.GuardSystemPromptTemplate)
 			allMessages = append(allMessages, *systemMsg)
@@ -248,10 +304,16 @@ func (c *MCPClient) GenerateContentWithGuard(ctx context.Context, messages []Mes
 					o.MCPTools = []string{}
 				})
 			}
+			allMessages, trim, err := c.fitContext(ctx, allMessages, opts, 0)
+			if err != nil {
+				return nil, err
+			}
+			c.recordContextTrim(gen, opts, trim)
 			nextGen, err := c.llm.GenerateContent(ctx, allMessages, allOptions...)
 			if err != nil {
 				return nil, err
 			}
+			c.recordUsage(gen, opts, UsageRecord{Phase: UsagePhaseGuard, Attempt: attempt, Model: generationModel(nextGen)}, nextGen.Usage)
 			genMessages := nextGen.Messages
 			for i := range genMessages {
 				genMessages[i].Name = GuardMessageName
@@ -311,6 +373,7 @@ func (c *MCPClient) GenerateContentWithGuard(ctx context.Context, messages []Mes
 					if err != nil {
 						return nil, err
 					}
+					c.carryUsage(nextGen, gen, attempt+1)
 					gen = nextGen
 					allGenMessages = append(allGenMessages, gen.Messages...)
 				}
@@ -347,27 +410,29 @@ func (c *MCPClient) processMCPTasksWithResults(ctx context.Context, state *Execu
 		return tasks, nil, nil
 	}
 
+	// 如果已经执行过了，就跳过
 	var results []TaskResult
-
-	// 执行任务
-TASK_LOOP:
+	var calls []toolExecution
 	for _, task := range tasks {
-		// 如果已经执行过了，就跳过
 		if _, ok := executedTaskTextMap[task.Text]; ok {
-			continue TASK_LOOP
-		}
-		taskResult := TaskResult{
-			Task: task,
+			continue
 		}
-		result, err := c.host.ExecuteTool(ctx, task.Server, task.Tool, task.Args)
+		results = append(results, TaskResult{Task: task})
+		calls = append(calls, toolExecution{Server: task.Server, Tool: task.Tool})
+	}
+
+	// 执行任务
+	c.executeTools(ctx, state.opts, calls, func(ctx context.Context, i int) {
+		taskResult := &results[i]
+		args, err := c.validateToolArgs(ctx, state.opts, taskResult.Task.Server, taskResult.Task.Tool, taskResult.Task.Args)
 		if err != nil {
 			taskResult.Error = err.Error()
-		} else {
-			taskResult.Result = result.Content
+			return
 		}
-
-		results = append(results, taskResult)
-	}
+		taskResult.Task.Args = args
+		result, err := c.host.ExecuteTool(ctx, taskResult.Task.Server, taskResult.Task.Tool, args)
+		c.fillTaskResult(taskResult, c.interpretToolResult(ctx, taskResult.Task.Server, taskResult.Task.Tool, result, err))
+	})
 
 	return tasks, results, nil
 }
@@ -397,12 +462,7 @@ func (c *MCPClient) ExecuteMCPTasksWithResults(ctx context.Context, content stri
 			Task: task,
 		}
 
-		result, err := c.host.ExecuteTool(ctx, task.Server, task.Tool, task.Args)
-		if err != nil {
-			taskResult.Error = err.Error()
-		} else {
-			taskResult.Result = result.Content
-		}
+		c.fillTaskResult(&taskResult, c.executeValidated(ctx, task.Server, task.Tool, task.Args))
 
 		results = append(results, taskResult)
 	}
@@ -430,18 +490,23 @@ func (c *MCPClient) ExecuteMCPTasks(ctx context.Context, content string, taskTag
 	// 执行任务并替换结果
 	updatedContent := content
 	for _, task := range tasks {
-		result, err := c.host.ExecuteTool(ctx, task.Server, task.Tool, task.Args)
-		if err != nil {
+		outcome := c.executeValidated(ctx, task.Server, task.Tool, task.Args)
+		if outcome.Error != "" {
 			updatedContent = strings.Replace(
 				updatedContent,
 				fmt.Sprintf("<%s>\n%s\n</%s>", tag, taskToString(task), tag),
-				fmt.Sprintf("<%s>\n%s\n[ERROR] %v\n</%s>", tag, taskToString(task), err, tag),
+				fmt.Sprintf("<%s>\n%s\n[ERROR] %v\n</%s>", tag, taskToString(task), outcome.Error, tag),
 				1,
 			)
 			continue
 		}
 
-		resultStr, _ := json.Marshal(result.Content)
+		var resultStr []byte
+		if outcome.Structured != nil {
+			resultStr, _ = json.Marshal(outcome.Structured)
+		} else {
+			resultStr, _ = json.Marshal(outcome.Content)
+		}
 		updatedContent = strings.Replace(
 			updatedContent,
 			fmt.Sprintf("<%s>\n%s\n</%s>", tag, taskToString(task), tag),
@@ -517,17 +582,14 @@ func (c *MCPClient) ExecuteToolCalls(ctx context.Context, gen *Generation) error
 		// 解析参数
 		var args map[string]any
 		if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil {
+			if c.validateArgs {
+				gen.GenerationInfo["tool_error_"+call.ID] = fmt.Sprintf("invalid arguments for tool %s: %v", call.Function.Name, err)
+			}
 			continue
 		}
 
 		// 执行工具
-		result, err := c.host.ExecuteTool(ctx, serverID, toolName, args)
-		if err != nil {
-			gen.GenerationInfo["tool_error_"+call.ID] = err.Error()
-			continue
-		}
-
-		gen.GenerationInfo["tool_result_"+call.ID] = result.Content
+		c.fillToolCallInfo(gen, call.ID, c.executeValidated(ctx, serverID, toolName, args))
 	}
 
 	return nil
@@ -535,8 +597,6 @@ func (c *MCPClient) ExecuteToolCalls(ctx context.Context, gen *Generation) error
 
 // formatMCPToolsAsText 将MCP工具信息格式化为文本形式
 func (c *MCPClient) formatMCPToolsAsJSON(ctx context.Context, disabledTools ...string) string {
-	connections := c.host.GetAllConnections()
-
 	hasTools := false
 
 	// 创建禁用工具的快速查找表
@@ -545,12 +605,12 @@ func (c *MCPClient) formatMCPToolsAsJSON(ctx context.Context, disabledTools ...s
 		disabledToolsMap[dt] = true
 	}
 	tools := make([]string, 0, 100)
-	for serverID := range connections {
-		toolsResult, err := c.host.ListTools(ctx, serverID)
+	for _, serverID := range c.host.ServerIDs() {
+		toolsResult, err := c.host.CatalogTools(ctx, serverID)
 		if err != nil {
 			toolsResult, err = c.host.ListTools(ctx, serverID)
 			if err != nil {
-				fmt.Println(err)
+				fmt.Println(c.host.Redactor().RedactString(err.Error()))
 				continue
 			}
 		}
@@ -558,7 +618,7 @@ func (c *MCPClient) formatMCPToolsAsJSON(ctx context.Context, disabledTools ...s
 		if len(toolsResult.Tools) < 1 {
 			toolsResult, err = c.host.ListTools(ctx, serverID)
 			if err != nil {
-				fmt.Println(err)
+				fmt.Println(c.host.Redactor().RedactString(err.Error()))
 				continue
 			}
 		}
@@ -612,8 +672,6 @@ func (c *MCPClient) formatMCPToolsAsText(ctx context.Context, disabledTools ...s
 	var builder strings.Builder
 	builder.WriteString("Available tools:\n\n")
 
-	connections := c.host.GetAllConnections()
-
 	hasTools := false
 
 	// 创建禁用工具的快速查找表
@@ -622,12 +680,12 @@ func (c *MCPClient) formatMCPToolsAsText(ctx context.Context, disabledTools ...s
 		disabledToolsMap[dt] = true
 	}
 
-	for serverID := range connections {
-		toolsResult, err := c.host.ListTools(ctx, serverID)
+	for _, serverID := range c.host.ServerIDs() {
+		toolsResult, err := c.host.CatalogTools(ctx, serverID)
 		if err != nil {
 			toolsResult, err = c.host.ListTools(ctx, serverID)
 			if err != nil {
-				fmt.Println(err)
+				fmt.Println(c.host.Redactor().RedactString(err.Error()))
 				continue
 			}
 		}
@@ -635,7 +693,7 @@ func (c *MCPClient) formatMCPToolsAsText(ctx context.Context, disabledTools ...s
 		if len(toolsResult.Tools) < 1 {
 			toolsResult, err = c.host.ListTools(ctx, serverID)
 			if err != nil {
-				fmt.Println(err)
+				fmt.Println(c.host.Redactor().RedactString(err.Error()))
 				continue
 			}
 		}
@@ -720,7 +778,7 @@ func (c *MCPClient) formatMCPToolsAsText(ctx context.Context, disabledTools ...s
 }
 
 // processToolCalls处理函数调用模式下的工具调用
-func (c *MCPClient) processToolCalls(ctx context.Context, gen *Generation) error {
+func (c *MCPClient) processToolCalls(ctx context.Context, gen *Generation, opts *GenerateOptions) error {
 	if len(gen.ToolCalls) == 0 {
 		return nil
 	}
@@ -729,27 +787,38 @@ func (c *MCPClient) processToolCalls(ctx context.Context, gen *Generation) error
 		gen.GenerationInfo = make(map[string]any)
 	}
 
+	var calls []toolExecution
+	var argsList []map[string]any
 	for _, call := range gen.ToolCalls {
 		parts := strings.Split(call.Function.Name, ".")
 		if len(parts) != 2 {
 			continue
 		}
 
-		serverID := parts[0]
-		toolName := parts[1]
-
 		var args map[string]any
 		if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil {
+			if opts.MCPValidateArgs {
+				gen.GenerationInfo["tool_error_"+call.ID] = fmt.Sprintf("invalid arguments for tool %s: %v", call.Function.Name, err)
+			}
 			continue
 		}
+		calls = append(calls, toolExecution{Server: parts[0], Tool: parts[1], CallID: call.ID})
+		argsList = append(argsList, args)
+	}
 
-		result, err := c.host.ExecuteTool(ctx, serverID, toolName, args)
+	// 并行执行时结果先按下标保存，全部完成后再依次写入GenerationInfo
+	outcomes := make([]toolOutcome, len(calls))
+	c.executeTools(ctx, opts, calls, func(ctx context.Context, i int) {
+		args, err := c.validateToolArgs(ctx, opts, calls[i].Server, calls[i].Tool, argsList[i])
 		if err != nil {
-			gen.GenerationInfo["tool_error_"+call.ID] = err.Error()
-			continue
+			outcomes[i] = toolOutcome{Error: err.Error()}
+			return
 		}
-
-		gen.GenerationInfo["tool_result_"+call.ID] = result.Content
+		result, err := c.host.ExecuteTool(ctx, calls[i].Server, calls[i].Tool, args)
+		outcomes[i] = c.interpretToolResult(ctx, calls[i].Server, calls[i].Tool, result, err)
+	})
+	for i, call := range calls {
+		c.fillToolCallInfo(gen, call.CallID, outcomes[i])
 	}
 
 	return nil
@@ -758,15 +827,14 @@ func (c *MCPClient) processToolCalls(ctx context.Context, gen *Generation) error
 // createMCPTools创建MCP工具定义
 func (c *MCPClient) createMCPTools(ctx context.Context, disabledTools []string) []Tool {
 	var tools []Tool
-	connections := c.host.GetAllConnections()
 
 	disabledToolsMap := make(map[string]bool)
 	for _, dt := range disabledTools {
 		disabledToolsMap[dt] = true
 	}
 
-	for serverID := range connections {
-		toolsResult, err := c.host.ListTools(ctx, serverID)
+	for _, serverID := range c.host.ServerIDs() {
+		toolsResult, err := c.host.CatalogTools(ctx, serverID)
 		if err != nil {
 			continue
 		}
@@ -804,15 +872,14 @@ func (c *MCPClient) createOrderedMCPTools(ctx context.Context, tools []string, d
 		}
 	}
 	var name2Tool = make(map[string]Tool, len(distinctTools))
-	connections := c.host.GetAllConnections()
 
 	disabledToolsMap := make(map[string]bool)
 	for _, dt := range disabledTools {
 		disabledToolsMap[dt] = true
 	}
 
-	for serverID := range connections {
-		toolsResult, err := c.host.ListTools(ctx, serverID)
+	for _, serverID := range c.host.ServerIDs() {
+		toolsResult, err := c.host.CatalogTools(ctx, serverID)
 		if err != nil {
 			continue
 		}
@@ -911,6 +978,8 @@ type MCPToolExecutionResult struct {
 	Result any            `json:"result,omitempty"` // 执行结果，如果成功
 	Error  string         `json:"error,omitempty"`  // 错误信息，如果失败
 	ID     string         `json:"id,omitempty"`     // 工具调用ID（函数调用模式）
+
+	StructuredContent any `json:"structured_content,omitempty"` // 结构化执行结果，如果有
 }
 
 // ExecuteAndFeedback 执行工具调用并将结果反馈给LLM生成最终回复
@@ -943,6 +1012,28 @@ func (c *MCPClient) ExecuteAndFeedback(ctx context.Context, gen *Generation, mes
 	return finalGen, nil
 }
 
+// fillTaskResult 将解析后的工具执行结果写入任务结果
+func (c *MCPClient) fillTaskResult(taskResult *TaskResult, outcome toolOutcome) {
+	if outcome.Error != "" {
+		taskResult.Error = outcome.Error
+		return
+	}
+	taskResult.Result = outcome.Content
+	taskResult.StructuredContent = outcome.Structured
+}
+
+// fillToolCallInfo 将解析后的工具执行结果写入GenerationInfo
+func (c *MCPClient) fillToolCallInfo(gen *Generation, callID string, outcome toolOutcome) {
+	if outcome.Error != "" {
+		gen.GenerationInfo["tool_error_"+callID] = outcome.Error
+		return
+	}
+	gen.GenerationInfo["tool_result_"+callID] = outcome.Content
+	if outcome.Structured != nil {
+		gen.GenerationInfo["tool_structured_"+callID] = outcome.Structured
+	}
+}
+
 // taskToString 将任务转换为字符串
 func taskToString(task MCPTask) string {
 	bytes, _ := json.Marshal(task)
@@ -0,0 +1,193 @@
+package llm
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	MCP_Host "github.com/longdexin/MCP_Host"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/sashabaranov/go-openai"
+)
+
+// newFakeMCPClient 创建连接进程内weather服务器的MCPClient，forecast工具返回 "sunny in <city>"
+func newFakeMCPClient(t *testing.T, fake *FakeLLM, opts ...MCPClientOption) *MCPClient {
+	t.Helper()
+	s := server.NewMCPServer("weather", "1.0.0", server.WithToolCapabilities(false))
+	s.AddTool(mcp.NewTool("forecast",
+		mcp.WithDescription("Get the weather forecast"),
+		mcp.WithString("city", mcp.Required()),
+	), func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		city, err := request.RequireString("city")
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		return mcp.NewToolResultText("sunny in " + city), nil
+	})
+	s.AddTool(mcp.NewTool("alerts", mcp.WithDescription("List weather alerts")), func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("no alerts"), nil
+	})
+
+	host := MCP_Host.NewMCPHost()
+	t.Cleanup(host.DisconnectAll)
+	if _, err := host.ConnectInProcess(context.Background(), "weather", s); err != nil {
+		t.Fatal(err)
+	}
+	return NewMCPClient(fake, host, opts...)
+}
+
+func TestMCPClientTextMode(t *testing.T) {
+	fake := NewFakeLLM(
+		FakeTask("weather.forecast", `{"city": "Paris"}`),
+		FakeText("It is sunny in Paris."),
+	)
+	client := newFakeMCPClient(t, fake)
+
+	gen, err := client.GenerateContent(context.Background(), []Message{*NewUserMessage("", "weather in Paris?")},
+		WithMCPWorkMode(TextMode),
+		WithMCPAutoExecute(true),
+		func(o *GenerateOptions) {
+			o.MCPTools = []string{"weather.forecast", "weather.alerts"}
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake.AssertCallCount(t, 2)
+	fake.AssertExhausted(t)
+	fake.AssertToolsOffered(t, 0, "weather.forecast", "weather.alerts")
+	fake.AssertMessageContains(t, 0, RoleSystem, "<"+MCP_DEFAULT_TASK_TAG+">")
+	fake.AssertMessageContains(t, 0, RoleUser, "weather in Paris?")
+	fake.AssertMessageContains(t, 1, RoleAssistant, `"name": "weather.forecast"`)
+	fake.AssertMessageContains(t, 1, RoleUser, "<"+MCP_DEFAULT_RESULT_TAG+">")
+	fake.AssertMessageContains(t, 1, RoleUser, "sunny in Paris")
+
+	if gen.MCPWorkMode != TextMode {
+		t.Errorf("work mode = %q", gen.MCPWorkMode)
+	}
+	roles := make([]string, 0, len(gen.Messages))
+	for _, message := range gen.Messages {
+		roles = append(roles, message.Role)
+	}
+	if strings.Join(roles, ",") != "assistant,user,assistant" {
+		t.Fatalf("message roles = %v", roles)
+	}
+	if last := gen.Messages[2]; last.Content != "It is sunny in Paris." || len(last.ToolCalls) != 0 {
+		t.Errorf("final message = %+v", last)
+	}
+	results, ok := gen.GenerationInfo["mcp_task_results"].([]TaskResult)
+	if !ok || len(results) != 1 || results[0].Task.Server != "weather" || results[0].Task.Tool != "forecast" || results[0].Error != "" {
+		t.Fatalf("task results = %+v", gen.GenerationInfo["mcp_task_results"])
+	}
+	if !strings.Contains(toolResultText(results[0].Result, results[0].StructuredContent), "sunny in Paris") {
+		t.Errorf("task result = %+v", results[0].Result)
+	}
+}
+
+func TestMCPClientExplicitToolsSkipSelector(t *testing.T) {
+	fake := NewFakeLLM(FakeText("no tools needed"), FakeToolCalls())
+	client := newFakeMCPClient(t, fake, WithToolSelector(NewBM25Selector(1)))
+
+	_, err := client.GenerateContent(context.Background(), []Message{*NewUserMessage("", "any weather alerts?")}, func(o *GenerateOptions) {
+		o.MCPTools = []string{"weather.forecast", "weather.alerts"}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.AssertToolsOffered(t, 0, "weather.forecast", "weather.alerts")
+
+	_, err = client.GenerateContent(context.Background(), []Message{*NewUserMessage("", "any weather alerts?")}, WithMCPWorkMode(FunctionCallMode))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offered := fake.Calls()[1].ToolNames(); len(offered) != 1 || offered[0] != "weather.alerts" {
+		t.Errorf("selector should pick one tool without MCPTools, offered %v", offered)
+	}
+}
+
+func TestMCPClientFunctionCallMode(t *testing.T) {
+	fake := NewFakeLLM(
+		FakeToolCalls(
+			FakeToolCall("call_1", "weather.forecast", `{"city":"Paris"}`),
+			FakeToolCall("call_2", "weather.forecast", `{"city":"Lyon"}`),
+		),
+		FakeText("Sunny in both."),
+	)
+	client := newFakeMCPClient(t, fake)
+
+	gen, err := client.GenerateContent(context.Background(), []Message{*NewUserMessage("", "weather in Paris and Lyon?")},
+		WithMCPWorkMode(FunctionCallMode),
+		WithMCPAutoExecute(true),
+		WithMCPDisabledTools([]string{"weather.alerts"}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake.AssertCallCount(t, 2)
+	fake.AssertExhausted(t)
+	fake.AssertToolsOffered(t, 0, "weather.forecast")
+	if offered := fake.Calls()[0].ToolNames(); len(offered) != 1 {
+		t.Errorf("disabled tool should not be offered, offered %v", offered)
+	}
+	fake.AssertMessageContains(t, 1, RoleTool, "sunny in Paris")
+	fake.AssertMessageContains(t, 1, RoleTool, "sunny in Lyon")
+
+	// 第二次调用与OpenAIClient一样，先是带工具调用的assistant消息，再是按ID对应的tool消息
+	second := fake.Calls()[1].Messages
+	var assistant *Message
+	toolCallIDs := make([]string, 0, 2)
+	for i := range second {
+		switch second[i].Role {
+		case RoleAssistant:
+			assistant = &second[i]
+		case RoleTool:
+			toolCallIDs = append(toolCallIDs, second[i].ToolCallId)
+		}
+	}
+	if assistant == nil || len(assistant.ToolCalls) != 2 || assistant.ToolCalls[0].Function.Name != "weather.forecast" {
+		t.Fatalf("assistant message = %+v", assistant)
+	}
+	if strings.Join(toolCallIDs, ",") != "call_1,call_2" {
+		t.Errorf("tool message ids = %v", toolCallIDs)
+	}
+
+	if gen.MCPWorkMode != FunctionCallMode {
+		t.Errorf("work mode = %q", gen.MCPWorkMode)
+	}
+	if len(gen.Messages) != 2 {
+		t.Fatalf("messages = %+v", gen.Messages)
+	}
+	first := gen.Messages[0]
+	if first.Role != openai.ChatMessageRoleAssistant || len(first.ToolCalls) != 2 {
+		t.Fatalf("first message = %+v", first)
+	}
+	if call := first.ToolCalls[1]; call.ID != "call_2" || call.Type != openai.ToolTypeFunction || call.Function.Name != "weather.forecast" || call.Function.Arguments != `{"city":"Lyon"}` {
+		t.Errorf("tool call = %+v", call)
+	}
+	if last := gen.Messages[1]; last.Role != openai.ChatMessageRoleAssistant || last.Content != "Sunny in both." {
+		t.Errorf("final message = %+v", last)
+	}
+	if gen.GenerationInfo["tool_result_call_1"] == nil || gen.GenerationInfo["tool_result_call_2"] == nil {
+		t.Errorf("generation info = %+v", gen.GenerationInfo)
+	}
+}
+
+func TestMCPClientFunctionCallModeWithoutAutoExecute(t *testing.T) {
+	fake := NewFakeLLM(FakeToolCalls(FakeToolCall("call_1", "weather.forecast", `{"city":"Paris"}`)))
+	client := newFakeMCPClient(t, fake)
+
+	gen, err := client.GenerateContent(context.Background(), []Message{*NewUserMessage("", "weather in Paris?")}, WithMCPWorkMode(FunctionCallMode))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.AssertCallCount(t, 1)
+	if len(gen.ToolCalls) != 1 || gen.ToolCalls[0].ID != "call_1" {
+		t.Errorf("tool calls = %+v", gen.ToolCalls)
+	}
+	if !strings.Contains(gen.Content, "<"+MCP_DEFAULT_TASK_TAG+">") || !strings.Contains(gen.Content, `"tool":"forecast"`) {
+		t.Errorf("tool calls should be appended to content as tasks: %q", gen.Content)
+	}
+}
@@ -0,0 +1,20 @@
+package llm
+
+import "time"
+
+// RequestObserver 观察LLM请求事件，用于指标采集等场景
+type RequestObserver interface {
+	// RequestFinished LLM请求结束，usage可能为空
+	RequestFinished(provider string, model string, latency time.Duration, usage *Usage, err error)
+}
+
+// notifyRequestFinished 通知所有观察者LLM请求结束
+func notifyRequestFinished(observers []RequestObserver, provider string, model string, latency time.Duration, gen *Generation, err error) {
+	var usage *Usage
+	if gen != nil {
+		usage = gen.Usage
+	}
+	for _, observer := range observers {
+		observer.RequestFinished(provider, model, latency, usage, err)
+	}
+}
@@ -0,0 +1,419 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	DefaultOllamaBaseURL = "http://localhost:11434" // 默认的Ollama地址
+	DefaultOllamaModel   = "llama3.1"               // 默认模型
+)
+
+// OllamaClient Ollama原生 /api/chat 接口的LLM实现，支持流式输出、工具调用、思考输出和模型参数
+type OllamaClient struct {
+	httpClient *http.Client
+	baseURL    string
+	model      string
+	numCtx     int
+	keepAlive  string
+	think      *bool
+	options    map[string]any
+	tracer     trace.Tracer
+	observers  []RequestObserver
+}
+
+// OllamaOption Ollama客户端的配置选项
+type OllamaOption func(*ollamaOptions)
+
+type ollamaOptions struct {
+	baseURL        string
+	model          string
+	numCtx         int
+	keepAlive      string
+	think          *bool
+	options        map[string]any
+	httpClient     *http.Client
+	tracerProvider trace.TracerProvider
+	observers      []RequestObserver
+}
+
+var _ LLM = (*OllamaClient)(nil)
+
+// NewOllamaClient 创建Ollama客户端，默认从OLLAMA_HOST和OLLAMA_MODEL读取配置
+func NewOllamaClient(opts ...OllamaOption) (*OllamaClient, error) {
+	options := &ollamaOptions{
+		baseURL:    DefaultOllamaBaseURL,
+		model:      DefaultOllamaModel,
+		httpClient: http.DefaultClient,
+		options:    make(map[string]any),
+	}
+	if host := os.Getenv("OLLAMA_HOST"); host != "" {
+		if !strings.Contains(host, "://") {
+			host = "http://" + host
+		}
+		options.baseURL = host
+	}
+	if model := os.Getenv("OLLAMA_MODEL"); model != "" {
+		options.model = model
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	if options.model == "" {
+		return nil, errors.New("missing Ollama model")
+	}
+
+	return &OllamaClient{
+		httpClient: options.httpClient,
+		baseURL:    strings.TrimSuffix(options.baseURL, "/"),
+		model:      options.model,
+		numCtx:     options.numCtx,
+		keepAlive:  options.keepAlive,
+		think:      options.think,
+		options:    options.options,
+		tracer:     tracerFrom(options.tracerProvider),
+		observers:  options.observers,
+	}, nil
+}
+
+// WithOllamaBaseURL 设置Ollama地址
+func WithOllamaBaseURL(baseURL string) OllamaOption {
+	return func(opts *ollamaOptions) {
+		opts.baseURL = baseURL
+	}
+}
+
+// WithOllamaModel 设置模型
+func WithOllamaModel(model string) OllamaOption {
+	return func(opts *ollamaOptions) {
+		opts.model = model
+	}
+}
+
+// WithOllamaNumCtx 设置上下文窗口大小（num_ctx）
+func WithOllamaNumCtx(numCtx int) OllamaOption {
+	return func(opts *ollamaOptions) {
+		opts.numCtx = numCtx
+	}
+}
+
+// WithOllamaKeepAlive 设置请求结束后模型在内存中保留的时间，负数表示一直保留
+func WithOllamaKeepAlive(keepAlive time.Duration) OllamaOption {
+	return func(opts *ollamaOptions) {
+		opts.keepAlive = keepAlive.String()
+	}
+}
+
+// WithOllamaThink 设置是否启用思考，思考内容映射到ReasoningContent。未设置时由模型决定
+func WithOllamaThink(think bool) OllamaOption {
+	return func(opts *ollamaOptions) {
+		opts.think = &think
+	}
+}
+
+// WithOllamaOption 设置其他模型参数，例如 "num_gpu"、"mirostat"，优先级低于GenerateOptions
+func WithOllamaOption(name string, value any) OllamaOption {
+	return func(opts *ollamaOptions) {
+		opts.options[name] = value
+	}
+}
+
+// WithOllamaHTTPClient 设置HTTP客户端
+func WithOllamaHTTPClient(client *http.Client) OllamaOption {
+	return func(opts *ollamaOptions) {
+		opts.httpClient = client
+	}
+}
+
+// WithOllamaTracerProvider 设置链路追踪的TracerProvider，默认使用全局TracerProvider
+func WithOllamaTracerProvider(provider trace.TracerProvider) OllamaOption {
+	return func(opts *ollamaOptions) {
+		opts.tracerProvider = provider
+	}
+}
+
+// WithOllamaRequestObserver 添加LLM请求观察者
+func WithOllamaRequestObserver(observer RequestObserver) OllamaOption {
+	return func(opts *ollamaOptions) {
+		opts.observers = append(opts.observers, observer)
+	}
+}
+
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Thinking  string           `json:"thinking,omitempty"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+}
+
+type ollamaToolCall struct {
+	ID       string `json:"id,omitempty"`
+	Function struct {
+		Index     int             `json:"index,omitempty"`
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+type ollamaTool struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string `json:"name"`
+		Description string `json:"description,omitempty"`
+		Parameters  any    `json:"parameters,omitempty"`
+	} `json:"function"`
+}
+
+type ollamaRequest struct {
+	Model     string          `json:"model"`
+	Messages  []ollamaMessage `json:"messages"`
+	Tools     []ollamaTool    `json:"tools,omitempty"`
+	Stream    bool            `json:"stream"`
+	Think     *bool           `json:"think,omitempty"`
+	Format    string          `json:"format,omitempty"`
+	KeepAlive string          `json:"keep_alive,omitempty"`
+	Options   map[string]any  `json:"options,omitempty"`
+}
+
+type ollamaResponse struct {
+	Model           string        `json:"model"`
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+	Error           string        `json:"error,omitempty"`
+}
+
+// Generate 生成文本回复
+func (c *OllamaClient) Generate(ctx context.Context, messages []Message, options ...GenerateOption) (*Generation, error) {
+	return c.GenerateContent(ctx, messages, options...)
+}
+
+// GenerateContent 使用消息列表生成回复
+func (c *OllamaClient) GenerateContent(ctx context.Context, messages []Message, options ...GenerateOption) (gen *Generation, err error) {
+	opts := DefaultGenerateOption()
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	ctx, span := startChatSpan(ctx, c.tracer, "ollama", c.model, opts)
+	start := time.Now()
+	defer func() {
+		setGenerationModel(gen, c.model)
+		endChatSpan(span, c.model, gen, err)
+		notifyRequestFinished(c.observers, "ollama", c.model, time.Since(start), gen, err)
+	}()
+
+	return c.generateContent(ctx, c.buildRequest(messages, opts), opts)
+}
+
+// buildRequest 转换为 /api/chat 请求
+func (c *OllamaClient) buildRequest(messages []Message, opts *GenerateOptions) *ollamaRequest {
+	req := &ollamaRequest{
+		Model:     c.model,
+		Stream:    opts.StreamingFunc != nil,
+		Think:     c.think,
+		KeepAlive: c.keepAlive,
+		Options:   make(map[string]any, len(c.options)+8),
+	}
+	if opts.JSONMode {
+		req.Format = "json"
+	}
+
+	for k, v := range c.options {
+		req.Options[k] = v
+	}
+	if c.numCtx > 0 {
+		req.Options["num_ctx"] = c.numCtx
+	}
+	setOption := func(name string, set bool, value any) {
+		if set {
+			req.Options[name] = value
+		}
+	}
+	setOption("temperature", opts.Temperature > 0, opts.Temperature)
+	setOption("top_p", opts.TopP > 0, opts.TopP)
+	setOption("top_k", opts.TopK > 0, opts.TopK)
+	setOption("repeat_penalty", opts.RepetitionPenalty > 0, opts.RepetitionPenalty)
+	setOption("frequency_penalty", opts.FrequencyPenalty != 0, opts.FrequencyPenalty)
+	setOption("presence_penalty", opts.PresencePenalty != 0, opts.PresencePenalty)
+	setOption("seed", opts.Seed != 0, opts.Seed)
+	setOption("num_predict", opts.MaxTokens > 0, opts.MaxTokens)
+	setOption("stop", len(opts.StopWords) > 0, opts.StopWords)
+
+	for _, tool := range opts.Tools {
+		if tool.Function == nil {
+			continue
+		}
+		var t ollamaTool
+		t.Type = "function"
+		t.Function.Name = tool.Function.Name
+		t.Function.Description = tool.Function.Description
+		t.Function.Parameters = tool.Function.Parameters
+		req.Tools = append(req.Tools, t)
+	}
+
+	// 工具结果消息需要工具名称，从之前的工具调用中查找
+	toolNames := make(map[string]string)
+	for _, msg := range messages {
+		message := ollamaMessage{
+			Role:     string(msg.Role),
+			Content:  msg.Content,
+			Thinking: msg.ReasoningContent,
+		}
+		for _, tc := range msg.ToolCalls {
+			if tc.Function == nil {
+				continue
+			}
+			toolNames[tc.ID] = tc.Function.Name
+			var call ollamaToolCall
+			call.Function.Name = tc.Function.Name
+			call.Function.Arguments = json.RawMessage(tc.Function.Arguments)
+			if !json.Valid(call.Function.Arguments) {
+				call.Function.Arguments = json.RawMessage("{}")
+			}
+			message.ToolCalls = append(message.ToolCalls, call)
+		}
+		if msg.Role == RoleTool {
+			message.ToolName = toolNames[msg.ToolCallId]
+		}
+		req.Messages = append(req.Messages, message)
+	}
+	return req
+}
+
+// generateContent 发送请求，流式请求逐行读取响应
+func (c *OllamaClient) generateContent(ctx context.Context, req *ollamaRequest, opts *GenerateOptions) (*Generation, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal ollama request: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/api/chat", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send ollama request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		bs, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		var apiErr ollamaResponse
+		if json.Unmarshal(bs, &apiErr) == nil && apiErr.Error != "" {
+			return nil, fmt.Errorf("ollama: %s (status %d)", apiErr.Error, resp.StatusCode)
+		}
+		return nil, fmt.Errorf("ollama: unexpected status code %d: %s", resp.StatusCode, strings.TrimSpace(string(bs)))
+	}
+
+	gen := &Generation{
+		Role:           openai.ChatMessageRoleAssistant,
+		GenerationInfo: make(map[string]any),
+	}
+	var content, thinking strings.Builder
+	// finish 根据已接收的分块完成生成结果，流被取消或中断时也返回已接收的部分
+	finish := func() *Generation {
+		gen.Content = strings.TrimSpace(content.String())
+		gen.ReasoningContent = strings.TrimSpace(thinking.String())
+		gen.Messages = append(gen.Messages, assistantMessage(gen))
+		return gen
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var chunk ollamaResponse
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return nil, fmt.Errorf("failed to decode ollama response: %w", err)
+		}
+		if chunk.Error != "" {
+			return nil, fmt.Errorf("ollama: %s", chunk.Error)
+		}
+		setGenerationModel(gen, chunk.Model)
+
+		content.WriteString(chunk.Message.Content)
+		thinking.WriteString(chunk.Message.Thinking)
+		delta := openai.ChatCompletionStreamChoiceDelta{
+			Content:          chunk.Message.Content,
+			ReasoningContent: chunk.Message.Thinking,
+		}
+		for _, call := range chunk.Message.ToolCalls {
+			toolCall := ToolCall{
+				ID:       call.ID,
+				Type:     string(openai.ToolTypeFunction),
+				Function: &FunctionCall{Name: call.Function.Name, Arguments: string(call.Function.Arguments)},
+			}
+			if toolCall.ID == "" {
+				toolCall.ID = newToolCallID()
+			}
+			if toolCall.Function.Arguments == "" || toolCall.Function.Arguments == "null" {
+				toolCall.Function.Arguments = "{}"
+			}
+			index := len(gen.ToolCalls)
+			gen.ToolCalls = append(gen.ToolCalls, toolCall)
+			delta.ToolCalls = append(delta.ToolCalls, openai.ToolCall{
+				Index:    &index,
+				ID:       toolCall.ID,
+				Type:     openai.ToolTypeFunction,
+				Function: openai.FunctionCall{Name: toolCall.Function.Name, Arguments: toolCall.Function.Arguments},
+			})
+		}
+
+		if req.Stream && opts.StreamingFunc != nil && !opts.DisableStreamingFunc &&
+			(delta.Content != "" || delta.ReasoningContent != "" || len(delta.ToolCalls) > 0) {
+			if err := opts.StreamingFunc(ctx, &delta, nil, 0); err != nil {
+				return finish(), fmt.Errorf("streaming function returned error: %w", err)
+			}
+		}
+
+		if chunk.Done {
+			gen.StopReason = chunk.DoneReason
+			if len(gen.ToolCalls) > 0 {
+				gen.StopReason = string(openai.FinishReasonToolCalls)
+			}
+			gen.Usage = &Usage{
+				PromptTokens:     chunk.PromptEvalCount,
+				CompletionTokens: chunk.EvalCount,
+				TotalTokens:      chunk.PromptEvalCount + chunk.EvalCount,
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, context.Canceled) {
+			return finish(), nil
+		}
+		return nil, fmt.Errorf("error receiving from stream: %w", err)
+	}
+	return finish(), nil
+}
+
+// newToolCallID 为没有ID的工具调用生成ID
+func newToolCallID() string {
+	var b [12]byte
+	_, _ = rand.Read(b[:])
+	return "call_" + hex.EncodeToString(b[:])
+}
@@ -0,0 +1,152 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// newOllamaTestClient 启动模拟 /api/chat 的服务器，handle收到解码后的请求并写入响应
+func newOllamaTestClient(t *testing.T, handle func(t *testing.T, req ollamaRequest, w http.ResponseWriter), opts ...OllamaOption) *OllamaClient {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		var req ollamaRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		handle(t, req, w)
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := NewOllamaClient(append([]OllamaOption{
+		WithOllamaBaseURL(server.URL),
+		WithOllamaModel("qwen-test"),
+	}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestOllamaGenerateContent(t *testing.T) {
+	client := newOllamaTestClient(t, func(t *testing.T, req ollamaRequest, w http.ResponseWriter) {
+		if req.Model != "qwen-test" || req.Stream || req.Format != "json" {
+			t.Errorf("model = %q, stream = %v, format = %q", req.Model, req.Stream, req.Format)
+		}
+		if req.Options["num_ctx"] != float64(8192) || req.Options["temperature"] != 0.5 || req.Options["num_predict"] != float64(100) {
+			t.Errorf("options = %+v", req.Options)
+		}
+		if len(req.Tools) != 1 || req.Tools[0].Function.Name != "weather.forecast" {
+			t.Errorf("tools = %+v", req.Tools)
+		}
+		if len(req.Messages) != 3 {
+			t.Fatalf("messages = %+v", req.Messages)
+		}
+		if calls := req.Messages[1].ToolCalls; len(calls) != 1 || string(calls[0].Function.Arguments) != `{"city":"Paris"}` {
+			t.Errorf("assistant tool calls = %+v", calls)
+		}
+		if tool := req.Messages[2]; tool.Role != "tool" || tool.ToolName != "weather.forecast" || tool.Content != "sunny" {
+			t.Errorf("tool result should carry the tool name: %+v", tool)
+		}
+
+		fmt.Fprintln(w, `{"model":"qwen-test:7b","message":{"role":"assistant","content":"","tool_calls":[`+
+			`{"function":{"name":"weather.forecast","arguments":{"city":"Lyon"}}},`+
+			`{"id":"call_x","function":{"name":"files.list","arguments":null}}]},`+
+			`"done":true,"done_reason":"stop","prompt_eval_count":30,"eval_count":8}`)
+	}, WithOllamaNumCtx(8192))
+
+	messages := []Message{
+		*NewUserMessage("", "weather?"),
+		*NewAssistantMessage("", "", []ToolCall{{ID: "call_1", Type: "function", Function: &FunctionCall{Name: "weather.forecast", Arguments: `{"city":"Paris"}`}}}),
+		*NewToolMessage("call_1", "sunny"),
+	}
+	tools := []Tool{{Type: "function", Function: &FunctionDefinition{Name: "weather.forecast"}}}
+	gen, err := client.GenerateContent(context.Background(), messages, WithTools(tools), WithTemperature(0.5), WithMaxTokens(100), func(o *GenerateOptions) {
+		o.JSONMode = true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(gen.ToolCalls) != 2 {
+		t.Fatalf("tool calls = %+v", gen.ToolCalls)
+	}
+	if first := gen.ToolCalls[0]; !strings.HasPrefix(first.ID, "call_") || first.Function.Arguments != `{"city":"Lyon"}` {
+		t.Errorf("tool call without id should get a generated id: %+v", first)
+	}
+	if second := gen.ToolCalls[1]; second.ID != "call_x" || second.Function.Arguments != "{}" {
+		t.Errorf("null arguments should become {}: %+v", second)
+	}
+	if gen.StopReason != string(openai.FinishReasonToolCalls) {
+		t.Errorf("stop reason = %q", gen.StopReason)
+	}
+	if gen.Usage == nil || gen.Usage.PromptTokens != 30 || gen.Usage.CompletionTokens != 8 || gen.Usage.TotalTokens != 38 {
+		t.Errorf("usage = %+v", gen.Usage)
+	}
+	if gen.GenerationInfo[GenerationInfoModel] != "qwen-test:7b" {
+		t.Errorf("model = %v", gen.GenerationInfo[GenerationInfoModel])
+	}
+	if len(gen.Messages) != 1 || len(gen.Messages[0].ToolCalls) != 2 {
+		t.Errorf("messages = %+v", gen.Messages)
+	}
+}
+
+func TestOllamaStream(t *testing.T) {
+	client := newOllamaTestClient(t, func(t *testing.T, req ollamaRequest, w http.ResponseWriter) {
+		if !req.Stream || req.Think == nil || !*req.Think {
+			t.Errorf("stream = %v, think = %v", req.Stream, req.Think)
+		}
+		for _, chunk := range []string{
+			`{"message":{"role":"assistant","content":"","thinking":"let me think"}}`,
+			`{"message":{"role":"assistant","content":"Hello "}}`,
+			``,
+			`{"message":{"role":"assistant","content":"world"}}`,
+			`{"message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","prompt_eval_count":4,"eval_count":2}`,
+		} {
+			fmt.Fprintln(w, chunk)
+		}
+	}, WithOllamaThink(true))
+
+	var content, reasoning strings.Builder
+	streaming := func(ctx context.Context, delta *openai.ChatCompletionStreamChoiceDelta, _ []MCPToolExecutionResult, _ int) error {
+		content.WriteString(delta.Content)
+		reasoning.WriteString(delta.ReasoningContent)
+		return nil
+	}
+	gen, err := client.GenerateContent(context.Background(), []Message{*NewUserMessage("", "hi")}, WithStreamingFunc(streaming))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content.String() != "Hello world" || reasoning.String() != "let me think" {
+		t.Errorf("streamed content = %q, reasoning = %q", content.String(), reasoning.String())
+	}
+	if gen.Content != "Hello world" || gen.ReasoningContent != "let me think" || gen.StopReason != "stop" {
+		t.Errorf("generation = %+v", gen)
+	}
+	if gen.Usage == nil || gen.Usage.TotalTokens != 6 {
+		t.Errorf("usage = %+v", gen.Usage)
+	}
+	if gen.GenerationInfo[GenerationInfoModel] != "qwen-test" {
+		t.Errorf("model should fall back to the configured model, got %v", gen.GenerationInfo[GenerationInfoModel])
+	}
+}
+
+func TestOllamaErrorResponse(t *testing.T) {
+	client := newOllamaTestClient(t, func(t *testing.T, req ollamaRequest, w http.ResponseWriter) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"error":"model \"qwen-test\" not found"}`)
+	})
+	_, err := client.GenerateContent(context.Background(), []Message{*NewUserMessage("", "hi")})
+	if err == nil || !strings.Contains(err.Error(), `model "qwen-test" not found (status 404)`) {
+		t.Errorf("err = %v", err)
+	}
+}
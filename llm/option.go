@@ -3,6 +3,7 @@ package llm
 import (
 	"context"
 
+	"github.com/longdexin/MCP_Host"
 	"github.com/sashabaranov/go-openai"
 )
 
@@ -44,6 +45,13 @@ type GenerateOptions struct {
 	MCPResultTag              string      `json:"-"` // MCP结果标签，默认为 MCP_HOST_RESULT
 	MCPDisabledTools          []string    `json:"-"` // 禁用的工具列表，格式为 "serverID.toolName"
 	MCPMaxToolExecutionRounds int         `json:"-"` // 最大工具执行轮次
+	MCPValidateArgs           bool        `json:"-"` // 执行前根据工具的输入Schema校验参数
+	MCPCoerceArgs             bool        `json:"-"` // 校验时进行安全的类型转换，例如将"5"转换为5
+	MCPToolConcurrency        int         `json:"-"` // 每轮并行执行的工具调用数量上限，1表示依次执行
+	MCPSequentialTools        []string    `json:"-"` // 需要单独依次执行的工具，格式为 "serverID.toolName"，支持通配符
+	MCPMaxReplans             int         `json:"-"` // 计划执行模式下有步骤失败时重新计划的最大次数
+
+	Redactor *MCP_Host.Redactor `json:"-"` // 对调试输出和通知中的数据脱敏，默认使用MCPHost的Redactor
 
 	StateNotifyFunc           StateNotifyFunc `json:"-"` // 状态通知回调
 	EnableDebug               bool            // 启用调试，主要用来打印即将发送的消息
@@ -55,6 +63,8 @@ type GenerateOptions struct {
 	ToolResultMsgTemplate     string          // 工具结果消息模板
 	NextRoundMsgTemplate      string          // 下一轮分析消息模板
 	FinalResultMsgTemplate    string          // 最终答案消息模板
+	PlanSystemPromptTemplate  string          // 计划执行模式的系统提示，{tool_descs}替换为可用工具
+	ReplanMsgTemplate         string          // 计划中有步骤失败时请求重新计划的消息模板
 	GuardSystemPromptTemplate string          // Guard使用的系统提示词
 	GuardMessage              string          // Guard消息
 	DisableGuardStreaming     bool            // 禁用guard的流式输出
@@ -139,6 +149,34 @@ func WithStopWords(stopWords []string) GenerateOption {
 	}
 }
 
+// WithTopK 指定Top-K采样的令牌数量
+func WithTopK(topK int) GenerateOption {
+	return func(o *GenerateOptions) {
+		o.TopK = topK
+	}
+}
+
+// WithTopP 指定Top-P采样的累积概率
+func WithTopP(topP float32) GenerateOption {
+	return func(o *GenerateOptions) {
+		o.TopP = topP
+	}
+}
+
+// WithSeed 指定确定性采样的种子
+func WithSeed(seed int) GenerateOption {
+	return func(o *GenerateOptions) {
+		o.Seed = seed
+	}
+}
+
+// WithRepetitionPenalty 指定重复惩罚
+func WithRepetitionPenalty(penalty float32) GenerateOption {
+	return func(o *GenerateOptions) {
+		o.RepetitionPenalty = penalty
+	}
+}
+
 // WithOptions 指定选项
 func WithOptions(options GenerateOptions) GenerateOption {
 	return func(o *GenerateOptions) {
@@ -211,6 +249,53 @@ func WithMCPMaxToolExecutionRounds(rounds int) GenerateOption {
 	}
 }
 
+// WithMCPValidateArgs 指定是否在执行前根据工具的输入Schema校验参数
+func WithMCPValidateArgs(validate bool) GenerateOption {
+	return func(o *GenerateOptions) {
+		o.MCPValidateArgs = validate
+	}
+}
+
+// WithMCPCoerceArgs 指定校验参数时是否进行安全的类型转换，仅在启用参数校验时生效
+func WithMCPCoerceArgs(coerce bool) GenerateOption {
+	return func(o *GenerateOptions) {
+		o.MCPCoerceArgs = coerce
+	}
+}
+
+// WithMCPToolConcurrency 指定每轮并行执行的工具调用数量上限，1表示依次执行
+func WithMCPToolConcurrency(concurrency int) GenerateOption {
+	return func(o *GenerateOptions) {
+		if concurrency > 0 {
+			o.MCPToolConcurrency = concurrency
+		}
+	}
+}
+
+// WithMCPSequentialTools 指定需要单独依次执行的工具，例如有副作用或依赖执行顺序的工具。
+// 这些工具等待之前的调用全部完成后才执行，之后的调用也等待其完成
+func WithMCPSequentialTools(tools ...string) GenerateOption {
+	return func(o *GenerateOptions) {
+		o.MCPSequentialTools = append(o.MCPSequentialTools, tools...)
+	}
+}
+
+// WithMCPMaxReplans 指定计划执行模式下有步骤失败时重新计划的最大次数，0表示不重新计划
+func WithMCPMaxReplans(replans int) GenerateOption {
+	return func(o *GenerateOptions) {
+		if replans >= 0 {
+			o.MCPMaxReplans = replans
+		}
+	}
+}
+
+// WithRedactor 指定对调试输出和通知中的数据脱敏的Redactor
+func WithRedactor(redactor *MCP_Host.Redactor) GenerateOption {
+	return func(o *GenerateOptions) {
+		o.Redactor = redactor
+	}
+}
+
 // DefaultGenerateOption返回默认的生成选项
 func DefaultGenerateOption() *GenerateOptions {
 	return &GenerateOptions{
@@ -220,11 +305,15 @@ func DefaultGenerateOption() *GenerateOptions {
 		MCPTaskTag:                MCP_DEFAULT_TASK_TAG,
 		MCPResultTag:              MCP_DEFAULT_RESULT_TAG,
 		MCPMaxToolExecutionRounds: 5,
+		MCPToolConcurrency:        DefaultMCPToolConcurrency,
+		MCPMaxReplans:             2,
 		SystemPromptTemplate:      defaultSystemPromptTemplate,
 		ToolErrorMsgTemplate:      defaultToolErrorMessageTemplate,
 		ToolResultMsgTemplate:     defaultToolResultMessageTemplate,
 		NextRoundMsgTemplate:      defaultNextRoundMsgTemplate,
 		FinalResultMsgTemplate:    defaultFinalResultMsgTemplate,
+		PlanSystemPromptTemplate:  defaultPlanSystemPromptTemplate,
+		ReplanMsgTemplate:         defaultReplanMsgTemplate,
 	}
 }
 
@@ -0,0 +1,99 @@
+package llm
+
+import (
+	"context"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/longdexin/MCP_Host"
+)
+
+// 每轮工具调用默认的最大并发数，默认依次执行，需要并行时通过WithMCPToolConcurrency开启
+const DefaultMCPToolConcurrency = 1
+
+// toolExecution 一轮中的一次工具调用
+type toolExecution struct {
+	Server string
+	Tool   string
+	CallID string // 函数调用模式下的调用ID
+}
+
+// isSequentialTool 判断工具是否需要单独依次执行
+func isSequentialTool(opts *GenerateOptions, server string, tool string) bool {
+	name := server + "." + tool
+	for _, pattern := range opts.MCPSequentialTools {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// executeTools 执行一轮中的工具调用。相邻的普通调用最多并行MCPToolConcurrency个，顺序工具等待之前的调用全部完成后单独执行，
+// 之后的调用也等待其完成。run将第i个调用的结果写入调用方按下标保存的位置，因此结果顺序与调用顺序一致
+func (c *MCPClient) executeTools(ctx context.Context, opts *GenerateOptions, calls []toolExecution, run func(ctx context.Context, i int)) {
+	var notifyMutex sync.Mutex
+	execute := func(i int) {
+		c.notifyToolExecution(ctx, opts, &notifyMutex, calls[i], i, "start", 0)
+		started := time.Now()
+		run(ctx, i)
+		c.notifyToolExecution(ctx, opts, &notifyMutex, calls[i], i, "complete", time.Since(started))
+	}
+
+	concurrency := max(opts.MCPToolConcurrency, 1)
+	for start := 0; start < len(calls); {
+		if concurrency == 1 || isSequentialTool(opts, calls[start].Server, calls[start].Tool) {
+			execute(start)
+			start++
+			continue
+		}
+		end := start + 1
+		for end < len(calls) && !isSequentialTool(opts, calls[end].Server, calls[end].Tool) {
+			end++
+		}
+
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, concurrency)
+		for i := start; i < end; i++ {
+			sem <- struct{}{}
+			wg.Add(1)
+			go func() {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				execute(i)
+			}()
+		}
+		wg.Wait()
+		start = end
+	}
+}
+
+// notifyToolExecution 通知单个工具调用实际开始和结束执行，并行执行时回调不会被同时调用
+func (c *MCPClient) notifyToolExecution(ctx context.Context, opts *GenerateOptions, mutex *sync.Mutex, call toolExecution, index int, stage string, duration time.Duration) {
+	if opts.StateNotifyFunc == nil {
+		return
+	}
+	data := map[string]any{
+		"round": MCP_Host.RoundFromContext(ctx),
+		"index": index,
+	}
+	if call.CallID != "" {
+		data["call_id"] = call.CallID
+	}
+	if stage == "complete" {
+		data["duration_ms"] = duration.Milliseconds()
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	_ = opts.StateNotifyFunc(ctx, MCPExecutionState{
+		Type:     "tool_execution",
+		ServerID: call.Server,
+		ToolName: call.Tool,
+		Stage:    stage,
+		Data:     data,
+	})
+}
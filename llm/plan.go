@@ -0,0 +1,642 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/longdexin/MCP_Host"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/sashabaranov/go-openai"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// GenerationInfo中记录计划执行模式各步骤执行情况的键，值为[]PlanStepResult
+	GenerationInfoPlan = "mcp_plan"
+	// GenerationInfo中记录未执行计划的键，未启用自动执行时值为*Plan
+	GenerationInfoPendingPlan = "mcp_pending_plan"
+)
+
+// PlanStep 计划中的一个步骤
+type PlanStep struct {
+	ID        string         `json:"id"`
+	Tool      string         `json:"tool"` // 格式为 "serverID.toolName"
+	Args      map[string]any `json:"args,omitempty"`
+	DependsOn []string       `json:"depends_on,omitempty"`
+}
+
+// Plan 模型生成的工具调用计划，步骤之间的依赖关系构成有向无环图
+type Plan struct {
+	Steps []PlanStep `json:"steps"`
+}
+
+// PlanStepStatus 步骤的执行状态
+type PlanStepStatus string
+
+const (
+	PlanStepSucceeded PlanStepStatus = "succeeded"
+	PlanStepFailed    PlanStepStatus = "failed"
+	PlanStepSkipped   PlanStepStatus = "skipped" // 依赖的步骤没有成功，未执行
+)
+
+// PlanStepResult 步骤的执行结果
+type PlanStepResult struct {
+	Step              PlanStep       `json:"step"`
+	Plan              int            `json:"plan"` // 所属计划的序号，从1开始，重新计划后递增
+	Status            PlanStepStatus `json:"status"`
+	Args              map[string]any `json:"args,omitempty"`               // 替换引用后的参数
+	Result            any            `json:"result,omitempty"`             // 执行结果
+	StructuredContent any            `json:"structured_content,omitempty"` // 结构化执行结果
+	Error             string         `json:"error,omitempty"`
+}
+
+var (
+	planStepIDRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	// 整个字符串为引用时替换为引用的值，例如 "$step1.result.items.0.id"
+	planRefRegex = regexp.MustCompile(`^\$([A-Za-z0-9_-]+)\.result((?:\.[^.\s]+)*)$`)
+	// 字符串中的引用替换为文本，例如 "Hello ${step1.result.name}"
+	planInlineRefRegex = regexp.MustCompile(`\$\{([A-Za-z0-9_-]+)\.result((?:\.[^.}\s]+)*)\}`)
+)
+
+// generatePlanned 计划执行模式：模型先生成工具调用计划，按依赖关系执行后再生成最终回复。
+// 有步骤失败或计划无效时将情况反馈给模型，重新计划剩余的步骤，最多MCPMaxReplans次。
+// 未启用自动执行时返回解析后的计划，不执行其中的步骤
+func (c *MCPClient) generatePlanned(ctx context.Context, messages []Message, opts *GenerateOptions, options []GenerateOption) (*Generation, error) {
+	systemPrompt := strings.TrimSpace(opts.PlanSystemPromptTemplate)
+	if systemPrompt == "" {
+		return nil, errors.New("plan system prompt template is blank")
+	}
+	tools, selectionInfo := c.selectTools(ctx, messages, opts, c.planTools(ctx, opts))
+	if len(tools) == 0 {
+		return nil, errors.New("no available tools")
+	}
+	toolNames := make(map[string]bool, len(tools))
+	toolsList := make([]string, 0, len(tools))
+	for _, tool := range tools {
+		if tool.Function == nil {
+			continue
+		}
+		byteSlice, err := json.Marshal(tool.Function)
+		if err != nil {
+			return nil, err
+		}
+		toolNames[tool.Function.Name] = true
+		toolsList = append(toolsList, string(byteSlice))
+	}
+	systemPrompt = strings.ReplaceAll(systemPrompt, "{tool_descs}", strings.Join(toolsList, "\n"))
+
+	result := &Generation{
+		GenerationInfo:  make(map[string]any),
+		MCPWorkMode:     PlanMode,
+		MCPResultTag:    opts.MCPResultTag,
+		MCPSystemPrompt: systemPrompt,
+	}
+	applySelectionInfo(result, selectionInfo)
+
+	// 生成计划时使用JSON模式，不输出流式内容
+	planOptions := append(slices.Clone(options), func(o *GenerateOptions) {
+		o.JSONMode = true
+		o.DisableStreamingFunc = true
+	})
+	planMessages := make([]Message, 0, len(messages)+1)
+	planMessages = append(planMessages, *NewSystemMessage("", systemPrompt))
+	planMessages = append(planMessages, messages...)
+
+	var steps []PlanStepResult
+	var transcript []openai.ChatCompletionMessage
+	previous := make(map[string]PlanStepStatus)
+	values := make(map[string]any)
+	planNumber := 0
+	for {
+		planNumber++
+		fitted, trim, err := c.fitContext(ctx, planMessages, opts, planNumber)
+		if err != nil {
+			return nil, err
+		}
+		c.recordContextTrim(result, opts, trim)
+
+		c.notifyPlan(ctx, opts, planNumber, "start", nil)
+		gen, err := c.llm.GenerateContent(ctx, fitted, planOptions...)
+		if err != nil {
+			c.notifyPlan(ctx, opts, planNumber, "error", map[string]any{"error": err.Error()})
+			return nil, err
+		}
+		c.recordUsage(result, opts, UsageRecord{Phase: UsagePhasePlan, Round: planNumber, Model: generationModel(gen)}, gen.Usage)
+		planMessages = append(planMessages, *NewAssistantMessage("", gen.Content, nil))
+		transcript = append(transcript, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: gen.Content})
+
+		var failures []string
+		var stepResults []PlanStepResult
+		plan, err := parsePlan(gen.Content)
+		if err == nil {
+			err = validatePlan(plan, toolNames, previous)
+		}
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("- invalid plan: %v", err))
+		} else if !opts.MCPAutoExecute {
+			c.notifyPlan(ctx, opts, planNumber, "complete", map[string]any{"steps": 0, "failures": 0})
+			result.Role = gen.Role
+			result.Content = gen.Content
+			result.ReasoningContent = gen.ReasoningContent
+			result.StopReason = gen.StopReason
+			result.Messages = transcript
+			for k, v := range gen.GenerationInfo {
+				if _, ok := result.GenerationInfo[k]; !ok {
+					result.GenerationInfo[k] = v
+				}
+			}
+			result.GenerationInfo[GenerationInfoPendingPlan] = plan
+			return result, nil
+		} else {
+			stepResults = c.executePlan(ctx, opts, plan, planNumber, values)
+		}
+		for _, stepResult := range stepResults {
+			previous[stepResult.Step.ID] = stepResult.Status
+			if stepResult.Status != PlanStepSucceeded {
+				failures = append(failures, fmt.Sprintf("- %s (%s) %s: %s", stepResult.Step.ID, stepResult.Step.Tool, stepResult.Status, stepResult.Error))
+			}
+		}
+		steps = append(steps, stepResults...)
+		if opts.StreamingFunc != nil && len(stepResults) > 0 {
+			c.streamPlanResults(ctx, opts, stepResults)
+		}
+		c.notifyPlan(ctx, opts, planNumber, "complete", map[string]any{"steps": len(stepResults), "failures": len(failures)})
+
+		replan := len(failures) > 0 && planNumber <= opts.MCPMaxReplans
+		if !replan && err != nil && len(steps) == 0 {
+			return nil, fmt.Errorf("invalid plan: %w", err)
+		}
+		var content []string
+		if len(stepResults) > 0 {
+			content = append(content, planResultsMessage(opts, stepResults))
+		}
+		if replan {
+			content = append(content, fmt.Sprintf(opts.ReplanMsgTemplate, strings.Join(failures, "\n")))
+		}
+		if len(content) > 0 {
+			message := NewUserMessage("", strings.Join(content, "\n\n"))
+			planMessages = append(planMessages, *message)
+			transcript = append(transcript, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: message.Content})
+		}
+		if !replan {
+			break
+		}
+	}
+
+	// 没有执行任何步骤时直接回复
+	finalMessages := slices.Clone(messages)
+	if len(steps) > 0 {
+		for _, message := range transcript {
+			finalMessages = append(finalMessages, Message{Role: MessageRole(message.Role), Content: message.Content})
+		}
+		finalMessages = append(finalMessages, *NewUserMessage("", opts.FinalResultMsgTemplate))
+	} else {
+		transcript = nil
+	}
+	fitted, trim, err := c.fitContext(ctx, finalMessages, opts, planNumber)
+	if err != nil {
+		return nil, err
+	}
+	c.recordContextTrim(result, opts, trim)
+	gen, err := c.llm.GenerateContent(ctx, fitted, options...)
+	if err != nil {
+		return nil, err
+	}
+	c.recordUsage(result, opts, UsageRecord{Phase: UsagePhaseFinal, Round: planNumber, Model: generationModel(gen)}, gen.Usage)
+
+	result.Role = gen.Role
+	result.Content = gen.Content
+	result.ReasoningContent = gen.ReasoningContent
+	result.StopReason = gen.StopReason
+	result.LogProbs = gen.LogProbs
+	result.Messages = append(transcript, gen.Messages...)
+	for k, v := range gen.GenerationInfo {
+		if _, ok := result.GenerationInfo[k]; !ok {
+			result.GenerationInfo[k] = v
+		}
+	}
+	result.GenerationInfo[GenerationInfoPlan] = steps
+	return result, nil
+}
+
+// planTools 返回计划可以使用的工具，指定了MCPTools时按其中的顺序只提供列出的工具
+func (c *MCPClient) planTools(ctx context.Context, opts *GenerateOptions) []Tool {
+	if len(opts.MCPTools) > 0 {
+		return c.createOrderedMCPTools(ctx, opts.MCPTools, opts.MCPDisabledTools)
+	}
+	return c.createMCPTools(ctx, opts.MCPDisabledTools)
+}
+
+// ExecutePlan 校验并执行计划，用于执行未启用自动执行时返回的计划，返回的结果与计划中的步骤顺序一致
+func (c *MCPClient) ExecutePlan(ctx context.Context, plan *Plan, options ...GenerateOption) ([]PlanStepResult, error) {
+	opts := c.prepareOptions(options)
+	toolNames := make(map[string]bool)
+	for _, tool := range c.planTools(ctx, opts) {
+		if tool.Function != nil {
+			toolNames[tool.Function.Name] = true
+		}
+	}
+	if err := validatePlan(plan, toolNames, nil); err != nil {
+		return nil, fmt.Errorf("invalid plan: %w", err)
+	}
+	return c.executePlan(ctx, opts, plan, 1, make(map[string]any)), nil
+}
+
+// executePlan 按依赖关系执行计划：依赖的步骤都成功后开始执行，互不依赖的步骤最多并行MCPToolConcurrency个，
+// 顺序工具单独执行；依赖的步骤没有成功时跳过。values为可以引用的步骤结果，执行成功的步骤结果会加入其中。
+// 返回的结果与计划中的步骤顺序一致
+func (c *MCPClient) executePlan(ctx context.Context, opts *GenerateOptions, plan *Plan, planNumber int, values map[string]any) []PlanStepResult {
+	ctx = MCP_Host.ContextWithRound(ctx, planNumber)
+	ctx, span := tracerFrom(c.tracerProvider).Start(ctx, "plan_execution",
+		trace.WithAttributes(
+			attribute.String(AttrMCPWorkMode, string(PlanMode)),
+			attribute.Int(AttrMCPExecutionRound, planNumber),
+			attribute.Int(AttrMCPToolCallCount, len(plan.Steps)),
+		),
+	)
+	defer span.End()
+
+	results := make([]PlanStepResult, len(plan.Steps))
+	dependencies := make([][]string, len(plan.Steps))
+	index := make(map[string]int, len(plan.Steps))
+	for i, step := range plan.Steps {
+		results[i] = PlanStepResult{Step: step, Plan: planNumber}
+		dependencies[i] = planStepDependencies(step)
+		index[step.ID] = i
+	}
+
+	type finished struct {
+		i       int
+		outcome toolOutcome
+	}
+	done := make(chan finished)
+	var notifyMutex sync.Mutex
+	concurrency := max(opts.MCPToolConcurrency, 1)
+	started := make([]bool, len(plan.Steps))
+	remaining := len(plan.Steps)
+	running, sequentialRunning := 0, false
+
+	for remaining > 0 {
+		progressed := false
+		for i := range plan.Steps {
+			if started[i] {
+				continue
+			}
+			ready := true
+			for _, dep := range dependencies[i] {
+				j, ok := index[dep]
+				if !ok {
+					continue
+				}
+				if status := results[j].Status; status == PlanStepFailed || status == PlanStepSkipped {
+					results[i].Status = PlanStepSkipped
+					results[i].Error = fmt.Sprintf("dependency %s did not succeed", dep)
+					started[i] = true
+					remaining--
+					progressed = true
+					ready = false
+					break
+				}
+				if results[j].Status != PlanStepSucceeded {
+					ready = false
+				}
+			}
+			if !ready || running >= concurrency || sequentialRunning {
+				continue
+			}
+
+			step := plan.Steps[i]
+			server, tool, _ := strings.Cut(step.Tool, ".")
+			sequential := isSequentialTool(opts, server, tool)
+			if sequential && running > 0 {
+				continue
+			}
+			started[i] = true
+			progressed = true
+			args, err := resolvePlanArgs(step.Args, values)
+			if err != nil {
+				results[i].Status = PlanStepFailed
+				results[i].Error = err.Error()
+				remaining--
+				continue
+			}
+			results[i].Args = args
+			running++
+			sequentialRunning = sequential
+
+			call := toolExecution{Server: server, Tool: tool, CallID: step.ID}
+			go func() {
+				c.notifyToolExecution(ctx, opts, &notifyMutex, call, i, "start", 0)
+				begin := time.Now()
+				var outcome toolOutcome
+				if validated, err := c.validateToolArgs(ctx, opts, server, tool, args); err != nil {
+					outcome = toolOutcome{Error: err.Error()}
+				} else {
+					result, err := c.host.ExecuteTool(ctx, server, tool, validated)
+					outcome = c.interpretToolResult(ctx, server, tool, result, err)
+				}
+				c.notifyToolExecution(ctx, opts, &notifyMutex, call, i, "complete", time.Since(begin))
+				done <- finished{i: i, outcome: outcome}
+			}()
+		}
+
+		if running == 0 {
+			if progressed {
+				continue
+			}
+			// 校验后的计划不会出现，防御性地跳过无法开始的步骤
+			for i := range plan.Steps {
+				if !started[i] {
+					results[i].Status = PlanStepSkipped
+					results[i].Error = "unresolved dependencies"
+				}
+			}
+			break
+		}
+
+		f := <-done
+		running--
+		if running == 0 {
+			sequentialRunning = false
+		}
+		remaining--
+		if f.outcome.Error != "" {
+			results[f.i].Status = PlanStepFailed
+			results[f.i].Error = f.outcome.Error
+			continue
+		}
+		results[f.i].Status = PlanStepSucceeded
+		results[f.i].Result = f.outcome.Content
+		results[f.i].StructuredContent = f.outcome.Structured
+		values[plan.Steps[f.i].ID] = planStepValue(f.outcome)
+	}
+	return results
+}
+
+// parsePlan 解析模型回复中的计划，忽略JSON之外的内容（例如代码块标记）
+func parsePlan(content string) (*Plan, error) {
+	start, end := strings.Index(content, "{"), strings.LastIndex(content, "}")
+	if start < 0 || end < start {
+		return nil, errors.New("no JSON object in reply")
+	}
+	plan := new(Plan)
+	if err := json.Unmarshal([]byte(content[start:end+1]), plan); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// validatePlan 检查步骤id、工具和依赖关系，依赖只能是本计划中的步骤或之前成功的步骤，且不能有环
+func validatePlan(plan *Plan, tools map[string]bool, previous map[string]PlanStepStatus) error {
+	ids := make(map[string]int, len(plan.Steps))
+	for i, step := range plan.Steps {
+		if !planStepIDRegex.MatchString(step.ID) {
+			return fmt.Errorf("invalid step id %q", step.ID)
+		}
+		if _, ok := ids[step.ID]; ok {
+			return fmt.Errorf("duplicate step id %s", step.ID)
+		}
+		if _, ok := previous[step.ID]; ok {
+			return fmt.Errorf("step id %s is already used by an earlier plan", step.ID)
+		}
+		if !tools[step.Tool] {
+			return fmt.Errorf("step %s uses unknown tool %s", step.ID, step.Tool)
+		}
+		ids[step.ID] = i
+	}
+
+	// 按依赖关系拓扑排序检查环
+	inDegree := make([]int, len(plan.Steps))
+	dependents := make([][]int, len(plan.Steps))
+	for i, step := range plan.Steps {
+		for _, dep := range planStepDependencies(step) {
+			if j, ok := ids[dep]; ok {
+				if j == i {
+					return fmt.Errorf("step %s depends on itself", step.ID)
+				}
+				inDegree[i]++
+				dependents[j] = append(dependents[j], i)
+				continue
+			}
+			status, ok := previous[dep]
+			if !ok {
+				return fmt.Errorf("step %s depends on unknown step %s", step.ID, dep)
+			}
+			if status != PlanStepSucceeded {
+				return fmt.Errorf("step %s depends on step %s which did not succeed", step.ID, dep)
+			}
+		}
+	}
+	queue := make([]int, 0, len(plan.Steps))
+	for i := range plan.Steps {
+		if inDegree[i] == 0 {
+			queue = append(queue, i)
+		}
+	}
+	for visited := 0; visited < len(queue); visited++ {
+		for _, j := range dependents[queue[visited]] {
+			inDegree[j]--
+			if inDegree[j] == 0 {
+				queue = append(queue, j)
+			}
+		}
+	}
+	if len(queue) < len(plan.Steps) {
+		return errors.New("steps have circular dependencies")
+	}
+	return nil
+}
+
+// planStepDependencies 步骤的依赖：depends_on中列出的步骤和参数中引用的步骤
+func planStepDependencies(step PlanStep) []string {
+	deps := slices.Clone(step.DependsOn)
+	var collect func(v any)
+	collect = func(v any) {
+		switch v := v.(type) {
+		case string:
+			if m := planRefRegex.FindStringSubmatch(v); m != nil {
+				deps = append(deps, m[1])
+			}
+			for _, m := range planInlineRefRegex.FindAllStringSubmatch(v, -1) {
+				deps = append(deps, m[1])
+			}
+		case map[string]any:
+			for _, item := range v {
+				collect(item)
+			}
+		case []any:
+			for _, item := range v {
+				collect(item)
+			}
+		}
+	}
+	collect(step.Args)
+	slices.Sort(deps)
+	return slices.Compact(deps)
+}
+
+// resolvePlanArgs 将参数中对之前步骤结果的引用替换为实际的值
+func resolvePlanArgs(args map[string]any, values map[string]any) (map[string]any, error) {
+	resolved, err := resolvePlanValue(args, values)
+	if err != nil {
+		return nil, err
+	}
+	result, _ := resolved.(map[string]any)
+	return result, nil
+}
+
+func resolvePlanValue(v any, values map[string]any) (any, error) {
+	switch v := v.(type) {
+	case string:
+		if m := planRefRegex.FindStringSubmatch(v); m != nil {
+			return lookupPlanRef(values, m[1], m[2])
+		}
+		var firstErr error
+		s := planInlineRefRegex.ReplaceAllStringFunc(v, func(ref string) string {
+			m := planInlineRefRegex.FindStringSubmatch(ref)
+			value, err := lookupPlanRef(values, m[1], m[2])
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return ref
+			}
+			if s, ok := value.(string); ok {
+				return s
+			}
+			byteSlice, _ := json.Marshal(value)
+			return string(byteSlice)
+		})
+		return s, firstErr
+	case map[string]any:
+		if v == nil {
+			return v, nil
+		}
+		result := make(map[string]any, len(v))
+		for k, item := range v {
+			resolved, err := resolvePlanValue(item, values)
+			if err != nil {
+				return nil, err
+			}
+			result[k] = resolved
+		}
+		return result, nil
+	case []any:
+		result := make([]any, len(v))
+		for i, item := range v {
+			resolved, err := resolvePlanValue(item, values)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = resolved
+		}
+		return result, nil
+	}
+	return v, nil
+}
+
+// lookupPlanRef 按路径取出步骤结果中的值，路径中的数字表示数组下标
+func lookupPlanRef(values map[string]any, id string, path string) (any, error) {
+	current, ok := values[id]
+	if !ok {
+		return nil, fmt.Errorf("step %s has no result", id)
+	}
+	if path == "" {
+		return current, nil
+	}
+	for _, key := range strings.Split(path[1:], ".") {
+		switch value := current.(type) {
+		case map[string]any:
+			if current, ok = value[key]; !ok {
+				return nil, fmt.Errorf("$%s.result%s: field %s not found", id, path, key)
+			}
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(value) {
+				return nil, fmt.Errorf("$%s.result%s: index %s out of range", id, path, key)
+			}
+			current = value[i]
+		default:
+			return nil, fmt.Errorf("$%s.result%s: cannot access %s", id, path, key)
+		}
+	}
+	return current, nil
+}
+
+// planStepValue 步骤结果供后续步骤引用的值：优先使用结构化内容，其次将文本内容解析为JSON，否则为文本
+func planStepValue(outcome toolOutcome) any {
+	if outcome.Structured != nil {
+		return outcome.Structured
+	}
+	text := strings.TrimSpace(contentToText(outcome.Content))
+	var value any
+	if err := json.Unmarshal([]byte(text), &value); err == nil {
+		return value
+	}
+	return text
+}
+
+// planResultsMessage 将步骤的执行结果整理为发送给模型的消息
+func planResultsMessage(opts *GenerateOptions, results []PlanStepResult) string {
+	lines := make([]string, 0, len(results))
+	for _, result := range results {
+		if result.Status == PlanStepSucceeded {
+			content, _ := result.Result.([]mcp.Content)
+			lines = append(lines, fmt.Sprintf("[%s] %s succeeded: %s", result.Step.ID, result.Step.Tool, functionCallResultText(content, result.StructuredContent)))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("[%s] %s %s: %s", result.Step.ID, result.Step.Tool, result.Status, result.Error))
+	}
+	return fmt.Sprintf(opts.ToolResultMsgTemplate, opts.MCPResultTag, strings.Join(lines, "\n"), opts.MCPResultTag)
+}
+
+// streamPlanResults 流式输出计划中各步骤的执行结果
+func (c *MCPClient) streamPlanResults(ctx context.Context, opts *GenerateOptions, results []PlanStepResult) {
+	resultInfos := make([]MCPToolExecutionResult, 0, len(results))
+	for _, result := range results {
+		server, tool, _ := strings.Cut(result.Step.Tool, ".")
+		resultInfo := MCPToolExecutionResult{
+			Server: server,
+			Tool:   tool,
+			Args:   result.Args,
+			ID:     result.Step.ID,
+		}
+		if result.Status == PlanStepSucceeded {
+			resultInfo.Status = "success"
+			resultInfo.Result = result.Result
+			resultInfo.StructuredContent = result.StructuredContent
+		} else {
+			resultInfo.Status = "error"
+			resultInfo.Error = result.Error
+		}
+		resultInfos = append(resultInfos, c.redactExecutionResult(opts, resultInfo))
+	}
+	_ = opts.StreamingFunc(ctx, nil, resultInfos, 0)
+}
+
+// notifyPlan 通知计划的生成和执行状态
+func (c *MCPClient) notifyPlan(ctx context.Context, opts *GenerateOptions, planNumber int, stage string, data map[string]any) {
+	if opts.StateNotifyFunc == nil {
+		return
+	}
+	data = maps.Clone(data)
+	if data == nil {
+		data = make(map[string]any)
+	}
+	data["round"] = planNumber
+	_ = opts.StateNotifyFunc(ctx, MCPExecutionState{
+		Type:  "plan",
+		Stage: stage,
+		Data:  data,
+	})
+}
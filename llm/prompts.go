@@ -46,3 +46,24 @@ const defaultNextRoundMsgTemplate = "BASED ON THE ABOVE DATA, ANALYZE IN ENGLISH
 
 // 最终答案消息模板
 const defaultFinalResultMsgTemplate = `Based on these results, use no more tools and give me the final answer.`
+
+// 计划执行模式的提示模板
+const defaultPlanSystemPromptTemplate = `You are an AI assistant that solves tasks by planning all the tool calls first and then executing them.
+Available tools:
+{tool_descs}
+
+Reply with only a JSON object describing the plan, in the following format:
+{"steps":[{"id":"step1","tool":"serverId.toolName","args":{parameters},"depends_on":[]}]}
+
+Rules:
+- Each step calls exactly one tool. Step ids must be unique, for example "step1", "step2".
+- Steps that do not depend on each other are executed in parallel. List in "depends_on" the ids of the steps that must finish first.
+- To use the result of an earlier step as an argument, use a string such as "$step1.result" or "$step1.result.items.0.id". Inside a longer string, use "${step1.result.name}". Referencing a step makes it a dependency automatically.
+- Plan all the tool calls needed to answer the question, so that no more tool calls are needed afterwards.
+- If no tool is needed, reply with {"steps":[]}.`
+
+// 重新计划消息模板
+const defaultReplanMsgTemplate = `Some steps could not be completed:
+%s
+
+Reply with a JSON plan in the same format containing only the steps that are still needed. Results of completed steps can be referenced by their ids, new steps must use new ids. If the remaining work cannot be done, reply with {"steps":[]}.`
@@ -0,0 +1,24 @@
+package llm
+
+import "github.com/longdexin/MCP_Host"
+
+// redactor 返回本次调用使用的Redactor，未指定时使用MCPHost的Redactor
+func (c *MCPClient) redactor(opts *GenerateOptions) *MCP_Host.Redactor {
+	if opts != nil && opts.Redactor != nil {
+		return opts.Redactor
+	}
+	return c.host.Redactor()
+}
+
+// redactExecutionResult 返回脱敏后的工具执行结果副本
+func (c *MCPClient) redactExecutionResult(opts *GenerateOptions, result MCPToolExecutionResult) MCPToolExecutionResult {
+	redactor := c.redactor(opts)
+	if redactor == nil {
+		return result
+	}
+	result.Args = redactor.RedactArgs(result.Args)
+	result.Result = redactor.RedactValue(result.Result)
+	result.StructuredContent = redactor.RedactValue(result.StructuredContent)
+	result.Error = redactor.RedactString(result.Error)
+	return result
+}
@@ -0,0 +1,145 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// toolOutcome 解析后的工具执行结果
+type toolOutcome struct {
+	Content    []mcp.Content // 非结构化内容
+	Structured any           // 解析为JSON的结构化内容
+	Error      string        // 错误信息，包括服务器标记的IsError结果
+}
+
+// interpretToolResult 解析工具执行结果：IsError视为工具错误，结构化内容按outputSchema校验
+func (c *MCPClient) interpretToolResult(ctx context.Context, serverID string, toolName string, result *mcp.CallToolResult, err error) toolOutcome {
+	if err != nil {
+		return toolOutcome{Error: err.Error()}
+	}
+	if result == nil {
+		return toolOutcome{Error: "empty tool result"}
+	}
+
+	outcome := toolOutcome{Content: result.Content}
+	if result.IsError {
+		outcome.Error = strings.TrimSpace(contentToText(result.Content))
+		if outcome.Error == "" {
+			outcome.Error = "tool reported an error"
+		}
+		return outcome
+	}
+
+	if result.StructuredContent != nil {
+		structured, err := normalizeSchema(result.StructuredContent)
+		if err != nil {
+			outcome.Error = fmt.Sprintf("invalid structured content: %v", err)
+			return outcome
+		}
+		outcome.Structured = structured
+	}
+
+	tool, err := c.host.GetTool(ctx, serverID, toolName)
+	if err != nil {
+		return outcome
+	}
+	schema, ok := toolOutputSchema(tool)
+	if !ok {
+		return outcome
+	}
+	if outcome.Structured == nil {
+		outcome.Error = fmt.Sprintf("tool %s.%s declares an output schema but returned no structured content", serverID, toolName)
+		return outcome
+	}
+	if _, violations := ValidateJSON(schema, outcome.Structured, false); len(violations) > 0 {
+		outcome.Error = (&ToolOutputValidationError{Server: serverID, Tool: toolName, Violations: violations}).Error()
+	}
+	return outcome
+}
+
+// ToolOutputValidationError 结构化内容不符合工具的outputSchema
+type ToolOutputValidationError struct {
+	Server     string            `json:"server"`
+	Tool       string            `json:"tool"`
+	Violations []SchemaViolation `json:"violations"`
+}
+
+func (e *ToolOutputValidationError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "structured content of tool %s.%s does not match its output schema:", e.Server, e.Tool)
+	writeViolations(&sb, e.Violations)
+	return sb.String()
+}
+
+// toolOutputSchema 获取工具声明的输出Schema
+func toolOutputSchema(tool *mcp.Tool) (map[string]any, bool) {
+	if len(tool.RawOutputSchema) > 0 {
+		schema, err := normalizeSchemaMap(tool.RawOutputSchema)
+		return schema, err == nil
+	}
+	if tool.OutputSchema.Type == "" {
+		return nil, false
+	}
+	schema, err := normalizeSchemaMap(tool.OutputSchema)
+	return schema, err == nil
+}
+
+// toolResultText 生成反馈给模型的结果文本，优先使用结构化内容
+func toolResultText(content any, structured any) string {
+	if structured != nil {
+		if bs, err := json.Marshal(structured); err == nil {
+			return string(bs)
+		}
+	}
+	if contents, ok := content.([]mcp.Content); ok {
+		return contentToText(contents)
+	}
+	bs, _ := json.Marshal(content)
+	return string(bs)
+}
+
+// contentToText 将工具返回的内容转换为文本，非文本内容以占位符表示
+func contentToText(contents []mcp.Content) string {
+	texts := make([]string, 0, len(contents))
+	for _, content := range contents {
+		switch c := content.(type) {
+		case mcp.TextContent:
+			texts = append(texts, c.Text)
+		case *mcp.TextContent:
+			texts = append(texts, c.Text)
+		case mcp.ImageContent:
+			texts = append(texts, fmt.Sprintf("[image: %s]", c.MIMEType))
+		case mcp.AudioContent:
+			texts = append(texts, fmt.Sprintf("[audio: %s]", c.MIMEType))
+		case mcp.ResourceLink:
+			texts = append(texts, fmt.Sprintf("[resource link: %s %s]", c.Name, c.URI))
+		case mcp.EmbeddedResource:
+			switch r := c.Resource.(type) {
+			case mcp.TextResourceContents:
+				texts = append(texts, r.Text)
+			case *mcp.TextResourceContents:
+				texts = append(texts, r.Text)
+			case mcp.BlobResourceContents:
+				texts = append(texts, fmt.Sprintf("[resource: %s %s]", r.URI, r.MIMEType))
+			case *mcp.BlobResourceContents:
+				texts = append(texts, fmt.Sprintf("[resource: %s %s]", r.URI, r.MIMEType))
+			}
+		}
+	}
+	return strings.Join(texts, "\n\n")
+}
+
+// functionCallResultText 生成函数调用模式下的工具消息内容，优先使用结构化内容
+func functionCallResultText(content any, structured any) string {
+	if structured != nil {
+		if bs, err := json.Marshal(structured); err == nil {
+			return string(bs)
+		}
+	}
+	bs, _ := json.Marshal(content)
+	return string(bs)
+}
@@ -0,0 +1,272 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// GenerationInfo中记录请求重试次数的键
+const GenerationInfoRetries = "retries"
+
+// RetryPolicy 请求失败后的重试策略，MaxRetries为0时不重试
+type RetryPolicy struct {
+	MaxRetries     int           // 最大重试次数
+	InitialBackoff time.Duration // 第一次重试前的等待时间
+	MaxBackoff     time.Duration // 等待时间的上限，也是Retry-After的上限
+	Multiplier     float64       // 每次重试等待时间的倍数
+	Jitter         float64       // 等待时间的随机浮动比例，0到1之间
+}
+
+// DefaultRetryPolicy 默认的重试策略：最多重试2次，等待0.5秒、1秒，上限30秒
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries:     2,
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     30 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// backoff 第attempt次重试（从1开始）前的等待时间，服务器指定了Retry-After时优先使用
+func (p RetryPolicy) backoff(attempt int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		if p.MaxBackoff > 0 && retryAfter > p.MaxBackoff {
+			return p.MaxBackoff
+		}
+		return retryAfter
+	}
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	d := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d *= 1 + p.Jitter*(2*rand.Float64()-1)
+	}
+	return time.Duration(d)
+}
+
+// IsRetryableError 判断请求错误是否可以重试：限流（额度不足除外）、服务器错误、超时和连接错误可以重试，
+// 参数错误、认证失败和上下文取消不重试
+func IsRetryableError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		if apiErr.Code == "insufficient_quota" || apiErr.Type == "insufficient_quota" {
+			return false
+		}
+		return isRetryableStatus(apiErr.HTTPStatusCode)
+	}
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return isRetryableStatus(reqErr.HTTPStatusCode)
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED)
+}
+
+func isRetryableStatus(status int) bool {
+	switch status {
+	case http.StatusRequestTimeout, http.StatusConflict, http.StatusTooManyRequests:
+		return true
+	}
+	return status >= 500
+}
+
+// retryAfterKey 上下文中记录Retry-After的键
+type retryAfterKey struct{}
+
+// retryAfterHolder 记录本次请求响应中的Retry-After
+type retryAfterHolder struct {
+	mutex sync.Mutex
+	delay time.Duration
+}
+
+func (h *retryAfterHolder) take() time.Duration {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	delay := h.delay
+	h.delay = 0
+	return delay
+}
+
+// retryAfterTransport 读取失败响应中的Retry-After（以及retry-after-ms）请求头，go-openai的错误中不包含响应头
+type retryAfterTransport struct {
+	base http.RoundTripper
+}
+
+func (t *retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode < 400 {
+		return resp, err
+	}
+	if holder, ok := req.Context().Value(retryAfterKey{}).(*retryAfterHolder); ok {
+		if delay := parseRetryAfter(resp.Header); delay > 0 {
+			holder.mutex.Lock()
+			holder.delay = delay
+			holder.mutex.Unlock()
+		}
+	}
+	return resp, nil
+}
+
+// parseRetryAfter 解析Retry-After请求头，支持秒数和HTTP日期
+func parseRetryAfter(header http.Header) time.Duration {
+	if ms, err := strconv.ParseFloat(header.Get("retry-after-ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return time.Until(at)
+	}
+	return 0
+}
+
+// withRetryAfterTransport 返回读取Retry-After的HTTP客户端副本
+func withRetryAfterTransport(client *http.Client) *http.Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	wrapped := *client
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	wrapped.Transport = &retryAfterTransport{base: base}
+	return &wrapped
+}
+
+// RateLimiter 客户端的令牌桶限流，分别限制每分钟的请求数和令牌数
+type RateLimiter struct {
+	requests *tokenBucket
+	tokens   *tokenBucket
+}
+
+// NewRateLimiter 创建限流器，requestsPerMinute或tokensPerMinute为0时不限制该项
+func NewRateLimiter(requestsPerMinute int, tokensPerMinute int) *RateLimiter {
+	return &RateLimiter{
+		requests: newTokenBucket(requestsPerMinute),
+		tokens:   newTokenBucket(tokensPerMinute),
+	}
+}
+
+// Wait 等待直到可以发送预计使用tokens个令牌的请求
+func (l *RateLimiter) Wait(ctx context.Context, tokens int) error {
+	if err := l.requests.wait(ctx, 1); err != nil {
+		return err
+	}
+	return l.tokens.wait(ctx, tokens)
+}
+
+// Adjust 请求结束后根据实际使用的令牌数修正预计值
+func (l *RateLimiter) Adjust(estimated int, actual int) {
+	l.tokens.adjust(estimated - actual)
+}
+
+// tokenBucket 令牌桶，容量为每分钟的数量
+type tokenBucket struct {
+	capacity float64
+	perSec   float64
+	tokens   float64
+	last     time.Time
+	mutex    sync.Mutex
+}
+
+func newTokenBucket(perMinute int) *tokenBucket {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &tokenBucket{
+		capacity: float64(perMinute),
+		perSec:   float64(perMinute) / 60,
+		tokens:   float64(perMinute),
+		last:     time.Now(),
+	}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens = math.Min(b.capacity, b.tokens+now.Sub(b.last).Seconds()*b.perSec)
+	b.last = now
+}
+
+// wait 取出n个令牌，不足时等待。超过容量的请求在桶满时放行，避免永远等待
+func (b *tokenBucket) wait(ctx context.Context, n int) error {
+	if b == nil || n <= 0 {
+		return nil
+	}
+	need := math.Min(float64(n), b.capacity)
+	for {
+		b.mutex.Lock()
+		b.refill(time.Now())
+		if b.tokens >= need {
+			b.tokens -= float64(n)
+			b.mutex.Unlock()
+			return nil
+		}
+		delay := time.Duration((need - b.tokens) / b.perSec * float64(time.Second))
+		b.mutex.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("rate limit wait: %w", ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// adjust 归还（n为正）或补扣（n为负）令牌
+func (b *tokenBucket) adjust(n int) {
+	if b == nil || n == 0 {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.refill(time.Now())
+	b.tokens = math.Min(b.capacity, b.tokens+float64(n))
+}
+
+// estimateTokens 粗略估计请求使用的令牌数：消息和工具定义的令牌数加上最大输出令牌数
+func estimateTokens(messages []Message, opts *GenerateOptions) int {
+	tokens := EstimateTokens(messages)
+	for _, tool := range opts.Tools {
+		if tool.Function != nil {
+			tokens += estimateTextTokens(tool.Function.Name) + estimateTextTokens(tool.Function.Description)
+			if bs, err := json.Marshal(tool.Function.Parameters); err == nil {
+				tokens += estimateTextTokens(string(bs))
+			}
+		}
+	}
+	return tokens + max(opts.MaxTokens, 0)
+}
@@ -0,0 +1,312 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// GenerationInfo中记录RouterLLM处理请求的后端名称的键
+const GenerationInfoBackend = "router_backend"
+
+// GenerationInfo中记录RouterLLM切换到后续后端之前各后端失败原因的键
+const GenerationInfoBackendErrors = "router_backend_errors"
+
+// ErrNoBackend 没有可用于请求的后端
+var ErrNoBackend = errors.New("no backend available")
+
+// RouterStrategy 后端的选择策略
+type RouterStrategy string
+
+const (
+	RouterFallback RouterStrategy = "fallback" // 按顺序使用，失败时切换到下一个
+	RouterWeighted RouterStrategy = "weighted" // 按权重随机选择，失败时按权重在剩余后端中切换
+)
+
+// Backend RouterLLM的后端
+type Backend struct {
+	Name    string        // 名称，记录在GenerationInfo中
+	LLM     LLM           // 模型
+	Weight  int           // 权重，用于RouterWeighted策略，小于等于0时为1
+	Timeout time.Duration // 单次请求的超时时间，超时后切换到下一个后端，0表示不限制
+}
+
+// RouteMatcher 根据生成选项判断是否使用路由规则
+type RouteMatcher func(opts *GenerateOptions) bool
+
+// RouteRule 路由规则，匹配时只使用列出的后端
+type RouteRule struct {
+	Match    RouteMatcher
+	Backends []string
+}
+
+// RouterLLM 组合多个后端的LLM，支持按顺序故障转移、按权重负载均衡和根据生成选项路由
+type RouterLLM struct {
+	backends  []Backend
+	rules     []RouteRule
+	strategy  RouterStrategy
+	retryable func(err error) bool
+	cooldown  time.Duration
+
+	// 后端失败后在cooldown内排在其他后端之后
+	failedAt map[string]time.Time
+	mutex    sync.Mutex
+}
+
+// RouterOption RouterLLM的配置选项
+type RouterOption func(*RouterLLM)
+
+var _ LLM = (*RouterLLM)(nil)
+
+// NewRouterLLM 创建RouterLLM，默认使用RouterFallback策略，任何错误都会切换到下一个后端
+func NewRouterLLM(opts ...RouterOption) (*RouterLLM, error) {
+	r := &RouterLLM{
+		strategy:  RouterFallback,
+		retryable: func(err error) bool { return true },
+		failedAt:  make(map[string]time.Time),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	if len(r.backends) == 0 {
+		return nil, ErrNoBackend
+	}
+	names := make(map[string]bool, len(r.backends))
+	for _, backend := range r.backends {
+		if backend.LLM == nil {
+			return nil, fmt.Errorf("backend %s has no LLM", backend.Name)
+		}
+		if names[backend.Name] {
+			return nil, fmt.Errorf("duplicate backend %s", backend.Name)
+		}
+		names[backend.Name] = true
+	}
+	for _, rule := range r.rules {
+		for _, name := range rule.Backends {
+			if !names[name] {
+				return nil, fmt.Errorf("route rule references unknown backend %s", name)
+			}
+		}
+	}
+	return r, nil
+}
+
+// WithBackend 添加后端，RouterFallback策略按添加顺序使用
+func WithBackend(backend Backend) RouterOption {
+	return func(r *RouterLLM) {
+		r.backends = append(r.backends, backend)
+	}
+}
+
+// WithRouteRule 添加路由规则，按添加顺序匹配第一个规则，没有规则匹配时使用全部后端
+func WithRouteRule(match RouteMatcher, backends ...string) RouterOption {
+	return func(r *RouterLLM) {
+		r.rules = append(r.rules, RouteRule{Match: match, Backends: backends})
+	}
+}
+
+// WithRouterStrategy 设置后端的选择策略
+func WithRouterStrategy(strategy RouterStrategy) RouterOption {
+	return func(r *RouterLLM) {
+		r.strategy = strategy
+	}
+}
+
+// WithRouterRetryable 设置哪些错误切换到下一个后端，返回false时直接返回错误
+func WithRouterRetryable(retryable func(err error) bool) RouterOption {
+	return func(r *RouterLLM) {
+		r.retryable = retryable
+	}
+}
+
+// WithRouterCooldown 设置后端失败后的冷却时间，冷却期间该后端排在其他后端之后
+func WithRouterCooldown(cooldown time.Duration) RouterOption {
+	return func(r *RouterLLM) {
+		r.cooldown = cooldown
+	}
+}
+
+// MatchModel 匹配GenerateOptions.Model，支持path.Match的通配符，例如 "gpt-4*"
+func MatchModel(patterns ...string) RouteMatcher {
+	return func(opts *GenerateOptions) bool {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, opts.Model); ok {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MatchTools 匹配提供了工具的请求
+func MatchTools() RouteMatcher {
+	return func(opts *GenerateOptions) bool {
+		return len(opts.Tools) > 0
+	}
+}
+
+// MatchJSONMode 匹配JSON模式或指定了application/json响应类型的请求
+func MatchJSONMode() RouteMatcher {
+	return func(opts *GenerateOptions) bool {
+		return opts.JSONMode || opts.ResponseMIMEType == "application/json"
+	}
+}
+
+// MatchAll 所有条件都匹配时匹配
+func MatchAll(matchers ...RouteMatcher) RouteMatcher {
+	return func(opts *GenerateOptions) bool {
+		for _, match := range matchers {
+			if !match(opts) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Generate 生成文本回复
+func (r *RouterLLM) Generate(ctx context.Context, messages []Message, options ...GenerateOption) (*Generation, error) {
+	return r.GenerateContent(ctx, messages, options...)
+}
+
+// GenerateContent 依次尝试选出的后端，直到成功。流式输出已开始后不再切换后端
+func (r *RouterLLM) GenerateContent(ctx context.Context, messages []Message, options ...GenerateOption) (*Generation, error) {
+	opts := DefaultGenerateOption()
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	candidates := r.candidates(opts)
+	if len(candidates) == 0 {
+		return nil, ErrNoBackend
+	}
+
+	var errs []error
+	var failures []string
+	for _, backend := range candidates {
+		attemptOptions := options
+		streamed := false
+		if opts.StreamingFunc != nil {
+			streamingFunc := opts.StreamingFunc
+			attemptOptions = append(options[:len(options):len(options)], WithStreamingFunc(
+				func(ctx context.Context, delta *openai.ChatCompletionStreamChoiceDelta, toolResults []MCPToolExecutionResult, flag int) error {
+					streamed = true
+					return streamingFunc(ctx, delta, toolResults, flag)
+				}))
+		}
+
+		gen, err := r.generate(ctx, backend, messages, attemptOptions)
+		if err == nil {
+			r.markHealthy(backend.Name)
+			if gen.GenerationInfo == nil {
+				gen.GenerationInfo = make(map[string]any)
+			}
+			gen.GenerationInfo[GenerationInfoBackend] = backend.Name
+			if len(failures) > 0 {
+				gen.GenerationInfo[GenerationInfoBackendErrors] = failures
+			}
+			return gen, nil
+		}
+
+		// 只有调用方未取消且后端本身可重试的错误（包括超过后端超时时间）才让后端进入冷却
+		if ctx.Err() == nil && (IsRetryableError(err) || errors.Is(err, context.DeadlineExceeded)) {
+			r.markFailed(backend.Name)
+		}
+		err = fmt.Errorf("backend %s: %w", backend.Name, err)
+		if ctx.Err() != nil || streamed || !r.retryable(err) {
+			return gen, err
+		}
+		errs = append(errs, err)
+		failures = append(failures, err.Error())
+	}
+	return nil, fmt.Errorf("all backends failed: %w", errors.Join(errs...))
+}
+
+// generate 使用后端的超时时间请求
+func (r *RouterLLM) generate(ctx context.Context, backend Backend, messages []Message, options []GenerateOption) (*Generation, error) {
+	if backend.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, backend.Timeout)
+		defer cancel()
+	}
+	return backend.LLM.GenerateContent(ctx, messages, options...)
+}
+
+// candidates 根据路由规则和策略确定尝试的后端及其顺序，冷却中的后端排在最后
+func (r *RouterLLM) candidates(opts *GenerateOptions) []Backend {
+	backends := r.backends
+	for _, rule := range r.rules {
+		if rule.Match != nil && rule.Match(opts) {
+			backends = make([]Backend, 0, len(rule.Backends))
+			for _, name := range rule.Backends {
+				for _, backend := range r.backends {
+					if backend.Name == name {
+						backends = append(backends, backend)
+					}
+				}
+			}
+			break
+		}
+	}
+
+	if r.strategy == RouterWeighted {
+		backends = weightedOrder(backends)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	ordered := make([]Backend, 0, len(backends))
+	var cooling []Backend
+	for _, backend := range backends {
+		if failedAt, ok := r.failedAt[backend.Name]; ok && time.Since(failedAt) < r.cooldown {
+			cooling = append(cooling, backend)
+			continue
+		}
+		ordered = append(ordered, backend)
+	}
+	return append(ordered, cooling...)
+}
+
+// weightedOrder 按权重随机排列后端
+func weightedOrder(backends []Backend) []Backend {
+	remaining := append([]Backend(nil), backends...)
+	ordered := make([]Backend, 0, len(backends))
+	for len(remaining) > 0 {
+		total := 0
+		for _, backend := range remaining {
+			total += max(backend.Weight, 1)
+		}
+		n := rand.IntN(total)
+		for i, backend := range remaining {
+			n -= max(backend.Weight, 1)
+			if n < 0 {
+				ordered = append(ordered, backend)
+				remaining = append(remaining[:i], remaining[i+1:]...)
+				break
+			}
+		}
+	}
+	return ordered
+}
+
+func (r *RouterLLM) markFailed(name string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.failedAt[name] = time.Now()
+}
+
+func (r *RouterLLM) markHealthy(name string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.failedAt, name)
+}
@@ -21,6 +21,7 @@ type (
 		ReasoningContent string      `json:"reasoning_content,omitempty"`
 		ToolCallId       string      `json:"tool_call_id,omitempty"`
 		ToolCalls        []ToolCall  `json:"tool_calls,omitempty"`
+		Pinned           bool        `json:"pinned,omitempty"` // 上下文管理时始终保留
 	}
 	GuardResponse struct {
 		OK          bool   `json:"ok"`
@@ -85,6 +86,7 @@ type LLMWorkMode string
 const (
 	TextMode         LLMWorkMode = "text"          // 纯文本模式
 	FunctionCallMode LLMWorkMode = "function_call" // 函数调用模式
+	PlanMode         LLMWorkMode = "plan"          // 计划执行模式，先生成工具调用计划再按依赖关系执行
 )
 
 func NewSystemMessage(name, content string) *Message {
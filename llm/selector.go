@@ -0,0 +1,367 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// 默认选择的工具数量
+const DefaultToolSelectorTopK = 10
+
+// GenerationInfo中记录本次请求提供给模型的工具名称的键
+const GenerationInfoOfferedTools = "mcp_offered_tools"
+
+// GenerationInfo中记录工具选择失败原因的键，失败时提供全部工具
+const GenerationInfoToolSelectionError = "mcp_tool_selection_error"
+
+// 参与选择的最近用户消息数量
+const toolSelectionQueryMessages = 3
+
+// ToolSelector 根据当前对话从候选工具中选出最相关的工具
+type ToolSelector interface {
+	SelectTools(ctx context.Context, messages []Message, tools []Tool) ([]Tool, error)
+}
+
+// WithToolSelector 设置工具选择器，工具较多时只向模型提供最相关的工具
+func WithToolSelector(selector ToolSelector) MCPClientOption {
+	return func(c *MCPClient) {
+		c.toolSelector = selector
+	}
+}
+
+// selectTools 使用工具选择器筛选工具，并在GenerationInfo中记录提供的工具。指定了MCPTools时不再筛选，列出的工具全部提供
+func (c *MCPClient) selectTools(ctx context.Context, messages []Message, opts *GenerateOptions, tools []Tool) ([]Tool, map[string]any) {
+	info := make(map[string]any)
+	if c.toolSelector != nil && len(opts.MCPTools) == 0 {
+		selected, err := c.toolSelector.SelectTools(ctx, messages, tools)
+		if err != nil {
+			info[GenerationInfoToolSelectionError] = err.Error()
+		} else {
+			tools = selected
+		}
+	}
+	names := make([]string, 0, len(tools))
+	for _, tool := range tools {
+		if tool.Function != nil {
+			names = append(names, tool.Function.Name)
+		}
+	}
+	info[GenerationInfoOfferedTools] = names
+	return tools, info
+}
+
+// applySelectionInfo 将工具选择信息写入GenerationInfo
+func applySelectionInfo(gen *Generation, info map[string]any) {
+	if gen.GenerationInfo == nil {
+		gen.GenerationInfo = make(map[string]any)
+	}
+	for k, v := range info {
+		gen.GenerationInfo[k] = v
+	}
+}
+
+// toolSelectionQuery 使用最近的用户消息作为查询
+func toolSelectionQuery(messages []Message) string {
+	parts := make([]string, 0, toolSelectionQueryMessages)
+	for i := len(messages) - 1; i >= 0 && len(parts) < toolSelectionQueryMessages; i-- {
+		if messages[i].Role == RoleUser && strings.TrimSpace(messages[i].Content) != "" {
+			parts = append(parts, messages[i].Content)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// toolName 返回工具名称，作为向量缓存的键
+func toolName(tool Tool) string {
+	if tool.Function == nil {
+		return ""
+	}
+	return tool.Function.Name
+}
+
+// toolDocument 用于检索的工具文本
+func toolDocument(tool Tool) string {
+	if tool.Function == nil {
+		return ""
+	}
+	return tool.Function.Name + "\n" + tool.Function.Description
+}
+
+// topK 按分数从高到低选出前k个工具，分数相同时保持原有顺序
+func topK(tools []Tool, scores []float64, k int) []Tool {
+	if k <= 0 {
+		k = DefaultToolSelectorTopK
+	}
+	if len(tools) <= k {
+		return tools
+	}
+	indexes := make([]int, len(tools))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	sort.SliceStable(indexes, func(a, b int) bool {
+		return scores[indexes[a]] > scores[indexes[b]]
+	})
+	selected := make([]Tool, 0, k)
+	for _, i := range indexes[:k] {
+		selected = append(selected, tools[i])
+	}
+	return selected
+}
+
+// BM25Selector 基于BM25对工具名称和描述打分的选择器
+type BM25Selector struct {
+	k  int
+	k1 float64
+	b  float64
+}
+
+var _ ToolSelector = (*BM25Selector)(nil)
+
+// BM25Option BM25Selector的配置选项
+type BM25Option func(*BM25Selector)
+
+// WithBM25Params 设置BM25的k1和b参数，默认为1.2和0.75
+func WithBM25Params(k1 float64, b float64) BM25Option {
+	return func(s *BM25Selector) {
+		s.k1 = k1
+		s.b = b
+	}
+}
+
+// NewBM25Selector 创建BM25选择器，k为选择的工具数量
+func NewBM25Selector(k int, opts ...BM25Option) *BM25Selector {
+	s := &BM25Selector{k: k, k1: 1.2, b: 0.75}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// SelectTools 实现ToolSelector
+func (s *BM25Selector) SelectTools(ctx context.Context, messages []Message, tools []Tool) ([]Tool, error) {
+	query := tokenize(toolSelectionQuery(messages))
+	if len(query) == 0 {
+		return topK(tools, make([]float64, len(tools)), s.k), nil
+	}
+
+	docs := make([][]string, len(tools))
+	df := make(map[string]int)
+	totalLength := 0
+	for i, tool := range tools {
+		docs[i] = tokenize(toolDocument(tool))
+		totalLength += len(docs[i])
+		seen := make(map[string]bool)
+		for _, term := range docs[i] {
+			if !seen[term] {
+				seen[term] = true
+				df[term]++
+			}
+		}
+	}
+	avgLength := float64(totalLength) / math.Max(float64(len(tools)), 1)
+
+	n := float64(len(tools))
+	scores := make([]float64, len(tools))
+	for i, doc := range docs {
+		tf := make(map[string]int, len(doc))
+		for _, term := range doc {
+			tf[term]++
+		}
+		norm := s.k1 * (1 - s.b + s.b*float64(len(doc))/math.Max(avgLength, 1))
+		for _, term := range query {
+			f := float64(tf[term])
+			if f == 0 {
+				continue
+			}
+			idf := math.Log(1 + (n-float64(df[term])+0.5)/(float64(df[term])+0.5))
+			scores[i] += idf * f * (s.k1 + 1) / (f + norm)
+		}
+	}
+	return topK(tools, scores, s.k), nil
+}
+
+// tokenize 分词：拉丁字母和数字按单词切分（同时拆分驼峰），中日韩文字按相邻两字切分
+func tokenize(text string) []string {
+	var tokens []string
+	var word []rune
+	var cjk []rune
+	flushWord := func() {
+		if len(word) > 0 {
+			tokens = append(tokens, strings.ToLower(string(word)))
+			word = word[:0]
+		}
+	}
+	flushCJK := func() {
+		switch {
+		case len(cjk) == 1:
+			tokens = append(tokens, string(cjk))
+		case len(cjk) > 1:
+			for i := 0; i+1 < len(cjk); i++ {
+				tokens = append(tokens, string(cjk[i:i+2]))
+			}
+		}
+		cjk = cjk[:0]
+	}
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r):
+			flushWord()
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushCJK()
+			if unicode.IsUpper(r) && len(word) > 0 && unicode.IsLower(word[len(word)-1]) {
+				flushWord()
+			}
+			word = append(word, r)
+		default:
+			flushWord()
+			flushCJK()
+		}
+	}
+	flushWord()
+	flushCJK()
+	return tokens
+}
+
+// Embedder 将文本转换为向量
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// EmbeddingSelector 基于向量相似度的选择器，工具的向量按工具名称缓存，名称或描述变化时重新生成
+type EmbeddingSelector struct {
+	embedder Embedder
+	k        int
+	cache    map[string]toolEmbedding
+	mutex    sync.Mutex
+}
+
+// toolEmbedding 缓存的工具向量及生成向量时的工具文本
+type toolEmbedding struct {
+	document string
+	vector   []float32
+}
+
+var _ ToolSelector = (*EmbeddingSelector)(nil)
+
+// NewEmbeddingSelector 创建向量选择器，k为选择的工具数量
+func NewEmbeddingSelector(embedder Embedder, k int) *EmbeddingSelector {
+	return &EmbeddingSelector{
+		embedder: embedder,
+		k:        k,
+		cache:    make(map[string]toolEmbedding),
+	}
+}
+
+// SelectTools 实现ToolSelector
+func (s *EmbeddingSelector) SelectTools(ctx context.Context, messages []Message, tools []Tool) ([]Tool, error) {
+	k := s.k
+	if k <= 0 {
+		k = DefaultToolSelectorTopK
+	}
+	if len(tools) <= k {
+		return tools, nil
+	}
+	query := toolSelectionQuery(messages)
+	if strings.TrimSpace(query) == "" {
+		return topK(tools, make([]float64, len(tools)), k), nil
+	}
+
+	documents := make([]string, len(tools))
+	toolVectors := make([][]float32, len(tools))
+	texts := []string{query}
+	s.mutex.Lock()
+	for i, tool := range tools {
+		documents[i] = toolDocument(tool)
+		if cached, ok := s.cache[toolName(tool)]; ok && cached.document == documents[i] {
+			toolVectors[i] = cached.vector
+		} else if !slices.Contains(texts[1:], documents[i]) {
+			texts = append(texts, documents[i])
+		}
+	}
+	s.mutex.Unlock()
+
+	vectors, err := s.embedder.Embed(ctx, texts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed tools: %w", err)
+	}
+	if len(vectors) != len(texts) {
+		return nil, fmt.Errorf("embedder returned %d vectors for %d texts", len(vectors), len(texts))
+	}
+
+	embedded := make(map[string][]float32, len(texts)-1)
+	for i, text := range texts[1:] {
+		embedded[text] = vectors[i+1]
+	}
+	scores := make([]float64, len(tools))
+	s.mutex.Lock()
+	for i, tool := range tools {
+		if vector, ok := embedded[documents[i]]; ok {
+			toolVectors[i] = vector
+			s.cache[toolName(tool)] = toolEmbedding{document: documents[i], vector: vector}
+		}
+		scores[i] = cosine(vectors[0], toolVectors[i])
+	}
+	s.mutex.Unlock()
+
+	return topK(tools, scores, k), nil
+}
+
+// cosine 计算余弦相似度
+func cosine(a []float32, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
+
+// OpenAIEmbedder 使用OpenAI兼容的embeddings接口生成向量
+type OpenAIEmbedder struct {
+	client *openai.Client
+	model  openai.EmbeddingModel
+}
+
+var _ Embedder = (*OpenAIEmbedder)(nil)
+
+// NewOpenAIEmbedder 使用OpenAIClient的连接配置创建Embedder
+func NewOpenAIEmbedder(client *OpenAIClient, model openai.EmbeddingModel) *OpenAIEmbedder {
+	return &OpenAIEmbedder{client: client.client, model: model}
+}
+
+// Embed 实现Embedder
+func (e *OpenAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	resp, err := e.client.CreateEmbeddings(ctx, openai.EmbeddingRequestStrings{
+		Input: texts,
+		Model: e.model,
+	})
+	if err != nil {
+		return nil, err
+	}
+	vectors := make([][]float32, len(texts))
+	for _, data := range resp.Data {
+		if data.Index < 0 || data.Index >= len(vectors) {
+			return nil, errors.New("embedding index out of range")
+		}
+		vectors[data.Index] = data.Embedding
+	}
+	return vectors, nil
+}
@@ -0,0 +1,96 @@
+package llm
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 追踪器名称
+const tracerName = "github.com/longdexin/MCP_Host/llm"
+
+// GenAI语义约定中使用的属性名
+const (
+	AttrGenAIOperationName         = "gen_ai.operation.name"
+	AttrGenAIProviderName          = "gen_ai.provider.name"
+	AttrGenAIRequestModel          = "gen_ai.request.model"
+	AttrGenAIRequestMaxTokens      = "gen_ai.request.max_tokens"
+	AttrGenAIRequestTemperature    = "gen_ai.request.temperature"
+	AttrGenAIRequestTopP           = "gen_ai.request.top_p"
+	AttrGenAIResponseModel         = "gen_ai.response.model"
+	AttrGenAIResponseFinishReasons = "gen_ai.response.finish_reasons"
+	AttrGenAIUsageInputTokens      = "gen_ai.usage.input_tokens"
+	AttrGenAIUsageOutputTokens     = "gen_ai.usage.output_tokens"
+	AttrMCPWorkMode                = "mcp.work_mode"
+	AttrMCPExecutionRound          = "mcp.execution_round"
+	AttrMCPToolCallCount           = "mcp.tool_call_count"
+)
+
+// tracerFrom 返回指定TracerProvider的追踪器，provider为空时使用全局TracerProvider
+func tracerFrom(provider trace.TracerProvider) trace.Tracer {
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return provider.Tracer(tracerName)
+}
+
+// startChatSpan 开始一个LLM调用span
+func startChatSpan(ctx context.Context, tracer trace.Tracer, provider string, model string, opts *GenerateOptions) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{
+		attribute.String(AttrGenAIOperationName, "chat"),
+		attribute.String(AttrGenAIProviderName, provider),
+		attribute.String(AttrGenAIRequestModel, model),
+	}
+	if opts.MaxTokens > 0 {
+		attrs = append(attrs, attribute.Int(AttrGenAIRequestMaxTokens, opts.MaxTokens))
+	}
+	if opts.Temperature > 0 {
+		attrs = append(attrs, attribute.Float64(AttrGenAIRequestTemperature, float64(opts.Temperature)))
+	}
+	if opts.TopP > 0 {
+		attrs = append(attrs, attribute.Float64(AttrGenAIRequestTopP, float64(opts.TopP)))
+	}
+	return tracer.Start(ctx, "chat "+model,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+}
+
+// endChatSpan 记录生成结果并结束LLM调用span
+func endChatSpan(span trace.Span, model string, gen *Generation, err error) {
+	if gen != nil {
+		span.SetAttributes(attribute.String(AttrGenAIResponseModel, model))
+		if gen.StopReason != "" {
+			span.SetAttributes(attribute.StringSlice(AttrGenAIResponseFinishReasons, []string{gen.StopReason}))
+		}
+		if gen.Usage != nil {
+			span.SetAttributes(
+				attribute.Int(AttrGenAIUsageInputTokens, gen.Usage.PromptTokens),
+				attribute.Int(AttrGenAIUsageOutputTokens, gen.Usage.CompletionTokens),
+			)
+		}
+	}
+	endSpan(span, err)
+}
+
+// startRoundSpan 开始一个工具执行轮次span
+func (c *MCPClient) startRoundSpan(ctx context.Context, state *ExecutionState) (context.Context, trace.Span) {
+	return tracerFrom(c.tracerProvider).Start(ctx, "execution_round",
+		trace.WithAttributes(
+			attribute.String(AttrMCPWorkMode, string(state.gen.MCPWorkMode)),
+			attribute.Int(AttrMCPExecutionRound, state.executionRound),
+		),
+	)
+}
+
+// endSpan 根据错误设置span状态并结束span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,177 @@
+package llm
+
+import (
+	"cmp"
+	"path"
+	"slices"
+)
+
+// GenerationInfo中记录每次模型调用用量的键，值为[]UsageRecord
+const GenerationInfoUsage = "mcp_usage"
+
+// GenerationInfo中记录总费用的键，设置了价格表时才记录
+const GenerationInfoCost = "mcp_cost"
+
+// GenerationInfo中记录实际使用的模型的键，值为string
+const GenerationInfoModel = "model"
+
+// UsagePhase 模型调用所处的阶段
+type UsagePhase string
+
+const (
+	UsagePhaseInitial UsagePhase = "initial" // 首次生成
+	UsagePhaseRound   UsagePhase = "round"   // 工具执行后的中间生成
+	UsagePhaseFinal   UsagePhase = "final"   // 达到最大轮次后生成最终结果
+	UsagePhaseSummary UsagePhase = "summary" // 上下文管理生成摘要
+	UsagePhaseGuard   UsagePhase = "guard"   // Guard检查
+	UsagePhasePlan    UsagePhase = "plan"    // 计划执行模式生成计划，Round为计划的序号
+)
+
+// UsageRecord 一次模型调用的用量
+type UsageRecord struct {
+	Phase   UsagePhase `json:"phase"`
+	Round   int        `json:"round,omitempty"`   // 工具执行轮次
+	Attempt int        `json:"attempt,omitempty"` // Guard检查未通过后重新生成的次数，首次生成为0
+	Model   string     `json:"model,omitempty"`
+	Usage   Usage      `json:"usage"`
+	Cost    float64    `json:"cost,omitempty"` // 设置了价格表时的费用
+}
+
+// ModelPrice 模型每百万令牌的价格
+type ModelPrice struct {
+	Prompt     float64 `json:"prompt"`
+	Completion float64 `json:"completion"`
+}
+
+// PricingTable 模型名称到价格的映射，名称支持path.Match的通配符，例如 "gpt-4o*"，"*" 匹配所有模型
+type PricingTable map[string]ModelPrice
+
+// WithPricing 设置价格表，每次模型调用按实际使用的模型计算费用，生成结果中没有记录模型时使用GenerateOptions.Model
+func WithPricing(table PricingTable) MCPClientOption {
+	return func(c *MCPClient) {
+		c.pricing = table
+	}
+}
+
+// Price 查找模型的价格，精确匹配优先，其次匹配最长的通配符模式
+func (t PricingTable) Price(model string) (ModelPrice, bool) {
+	if price, ok := t[model]; ok {
+		return price, true
+	}
+	patterns := make([]string, 0, len(t))
+	for pattern := range t {
+		patterns = append(patterns, pattern)
+	}
+	slices.SortFunc(patterns, func(a, b string) int {
+		return cmp.Or(cmp.Compare(len(b), len(a)), cmp.Compare(a, b))
+	})
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, model); ok {
+			return t[pattern], true
+		}
+	}
+	return ModelPrice{}, false
+}
+
+// Cost 计算一次调用的费用，价格表中没有该模型时返回false
+func (t PricingTable) Cost(model string, usage Usage) (float64, bool) {
+	price, ok := t.Price(model)
+	if !ok {
+		return 0, false
+	}
+	return (float64(usage.PromptTokens)*price.Prompt + float64(usage.CompletionTokens)*price.Completion) / 1e6, true
+}
+
+// add 累加用量
+func (u *Usage) add(other Usage) {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.TotalTokens += other.TotalTokens
+}
+
+// recordUsage 按record的阶段和轮次记录一次模型调用的用量，并累加到gen.Usage和总费用中
+func (c *MCPClient) recordUsage(gen *Generation, opts *GenerateOptions, record UsageRecord, usage *Usage) {
+	if usage == nil || *usage == (Usage{}) {
+		return
+	}
+	record.Model = cmp.Or(record.Model, opts.Model)
+	record.Usage = *usage
+	if usage.TotalTokens == 0 {
+		record.Usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	if c.pricing != nil {
+		record.Cost, _ = c.pricing.Cost(record.Model, record.Usage)
+	}
+	c.appendUsageRecords(gen, record)
+}
+
+// appendUsageRecords 追加用量记录并更新gen.Usage和总费用
+func (c *MCPClient) appendUsageRecords(gen *Generation, records ...UsageRecord) {
+	if len(records) == 0 {
+		return
+	}
+	if gen.GenerationInfo == nil {
+		gen.GenerationInfo = make(map[string]any)
+	}
+	total := Usage{}
+	if gen.Usage != nil {
+		total = *gen.Usage
+	}
+	cost, _ := gen.GenerationInfo[GenerationInfoCost].(float64)
+	for _, record := range records {
+		total.add(record.Usage)
+		cost += record.Cost
+	}
+	gen.Usage = &total
+	existing, _ := gen.GenerationInfo[GenerationInfoUsage].([]UsageRecord)
+	gen.GenerationInfo[GenerationInfoUsage] = append(slices.Clip(existing), records...)
+	if c.pricing != nil {
+		gen.GenerationInfo[GenerationInfoCost] = cost
+	}
+}
+
+// startUsage 将首次生成的用量作为第一条记录，此后gen.Usage为所有调用的合计
+func (c *MCPClient) startUsage(gen *Generation, opts *GenerateOptions) {
+	usage := gen.Usage
+	gen.Usage = nil
+	c.recordUsage(gen, opts, UsageRecord{Phase: UsagePhaseInitial, Model: generationModel(gen)}, usage)
+}
+
+// setGenerationModel 在gen中记录实际使用的模型，已经记录了响应中的模型时不覆盖
+func setGenerationModel(gen *Generation, model string) {
+	if gen == nil || model == "" {
+		return
+	}
+	if gen.GenerationInfo == nil {
+		gen.GenerationInfo = make(map[string]any)
+	}
+	if existing, _ := gen.GenerationInfo[GenerationInfoModel].(string); existing == "" {
+		gen.GenerationInfo[GenerationInfoModel] = model
+	}
+}
+
+// generationModel 返回gen中记录的实际使用的模型
+func generationModel(gen *Generation) string {
+	if gen == nil {
+		return ""
+	}
+	model, _ := gen.GenerationInfo[GenerationInfoModel].(string)
+	return model
+}
+
+// carryUsage 重新生成后，将之前所有调用的用量合并到新的生成结果中，新结果的记录标记为第attempt次重新生成
+func (c *MCPClient) carryUsage(next *Generation, previous *Generation, attempt int) {
+	records, _ := next.GenerationInfo[GenerationInfoUsage].([]UsageRecord)
+	records = slices.Clone(records)
+	for i := range records {
+		records[i].Attempt = attempt
+	}
+	if next.GenerationInfo != nil {
+		delete(next.GenerationInfo, GenerationInfoUsage)
+		delete(next.GenerationInfo, GenerationInfoCost)
+	}
+	next.Usage = nil
+
+	previousRecords, _ := previous.GenerationInfo[GenerationInfoUsage].([]UsageRecord)
+	c.appendUsageRecords(next, append(slices.Clone(previousRecords), records...)...)
+}
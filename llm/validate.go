@@ -0,0 +1,674 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// SchemaViolation 参数中不符合JSON Schema的一处位置
+type SchemaViolation struct {
+	Path    string `json:"path"`    // JSON Pointer，根为空字符串
+	Message string `json:"message"` // 违反的约束
+}
+
+// ToolArgsValidationError 工具参数校验错误，列出所有违反的约束
+type ToolArgsValidationError struct {
+	Server     string            `json:"server"`
+	Tool       string            `json:"tool"`
+	Violations []SchemaViolation `json:"violations"`
+}
+
+func (e *ToolArgsValidationError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "invalid arguments for tool %s.%s:", e.Server, e.Tool)
+	writeViolations(&sb, e.Violations)
+	return sb.String()
+}
+
+// writeViolations 逐行输出违反的约束
+func writeViolations(sb *strings.Builder, violations []SchemaViolation) {
+	for _, v := range violations {
+		path := v.Path
+		if path == "" {
+			path = "(root)"
+		}
+		fmt.Fprintf(sb, "\n  - %s: %s", path, v.Message)
+	}
+}
+
+// ValidateToolArgs 根据JSON Schema（draft 2020-12的子集）校验参数。
+// coerce为true时会进行安全的类型转换，例如将"5"转换为5，返回值为转换后的参数
+func ValidateToolArgs(schema any, args map[string]any, coerce bool) (map[string]any, []SchemaViolation) {
+	if args == nil {
+		args = map[string]any{}
+	}
+	value, violations := ValidateJSON(schema, args, coerce)
+	if obj, ok := value.(map[string]any); ok && len(violations) == 0 {
+		return obj, nil
+	}
+	return args, violations
+}
+
+// ValidateJSON 根据JSON Schema校验任意JSON值，不会修改传入的值
+func ValidateJSON(schema any, value any, coerce bool) (any, []SchemaViolation) {
+	root, err := normalizeSchema(schema)
+	if err != nil {
+		return value, []SchemaViolation{{Message: fmt.Sprintf("invalid schema: %v", err)}}
+	}
+	v := &schemaValidator{root: root, coerce: coerce}
+	value = v.validate(deepCopyJSON(value), root, "")
+	return value, v.violations
+}
+
+// WithArgsValidation 直接调用ExecuteMCPTasks、ExecuteMCPTasksWithResults和ExecuteToolCalls时，
+// 执行前根据工具的输入Schema校验参数，coerce为true时进行安全的类型转换。
+// 自动执行时由WithMCPValidateArgs和WithMCPCoerceArgs决定
+func WithArgsValidation(coerce bool) MCPClientOption {
+	return func(c *MCPClient) {
+		c.validateArgs = true
+		c.coerceArgs = coerce
+	}
+}
+
+// executeValidated 按客户端的校验设置校验参数后执行工具，用于不经过GenerateOptions的直接执行
+func (c *MCPClient) executeValidated(ctx context.Context, serverID string, toolName string, args map[string]any) toolOutcome {
+	opts := &GenerateOptions{MCPValidateArgs: c.validateArgs, MCPCoerceArgs: c.coerceArgs}
+	args, err := c.validateToolArgs(ctx, opts, serverID, toolName, args)
+	if err != nil {
+		return toolOutcome{Error: err.Error()}
+	}
+	result, err := c.host.ExecuteTool(ctx, serverID, toolName, args)
+	return c.interpretToolResult(ctx, serverID, toolName, result, err)
+}
+
+// validateToolArgs 使用工具缓存的输入Schema校验参数
+func (c *MCPClient) validateToolArgs(ctx context.Context, opts *GenerateOptions, serverID string, toolName string, args map[string]any) (map[string]any, error) {
+	if !opts.MCPValidateArgs {
+		return args, nil
+	}
+	tool, err := c.host.GetTool(ctx, serverID, toolName)
+	if err != nil {
+		return args, err
+	}
+	schema, err := toolInputSchema(tool)
+	if err != nil {
+		return args, nil
+	}
+	coerced, violations := ValidateToolArgs(schema, args, opts.MCPCoerceArgs)
+	if len(violations) > 0 {
+		return args, &ToolArgsValidationError{Server: serverID, Tool: toolName, Violations: violations}
+	}
+	return coerced, nil
+}
+
+// toolInputSchema 获取工具的输入Schema
+func toolInputSchema(tool *mcp.Tool) (map[string]any, error) {
+	if len(tool.RawInputSchema) > 0 {
+		return normalizeSchemaMap(tool.RawInputSchema)
+	}
+	return normalizeSchemaMap(tool.InputSchema)
+}
+
+// normalizeSchema 将Schema转换为通用的JSON结构
+func normalizeSchema(schema any) (any, error) {
+	switch s := schema.(type) {
+	case nil:
+		return true, nil
+	case bool, map[string]any:
+		return s, nil
+	case json.RawMessage:
+		var out any
+		err := json.Unmarshal(s, &out)
+		return out, err
+	default:
+		bs, err := json.Marshal(s)
+		if err != nil {
+			return nil, err
+		}
+		var out any
+		err = json.Unmarshal(bs, &out)
+		return out, err
+	}
+}
+
+// normalizeSchemaMap 将Schema转换为map
+func normalizeSchemaMap(schema any) (map[string]any, error) {
+	s, err := normalizeSchema(schema)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := s.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("schema is not an object")
+	}
+	return m, nil
+}
+
+// schemaValidator JSON Schema校验器
+type schemaValidator struct {
+	root       any
+	coerce     bool
+	violations []SchemaViolation
+	depth      int
+}
+
+func (v *schemaValidator) addf(path string, format string, a ...any) {
+	v.violations = append(v.violations, SchemaViolation{Path: path, Message: fmt.Sprintf(format, a...)})
+}
+
+// validate 校验value并返回（可能经过类型转换的）值
+func (v *schemaValidator) validate(value any, schema any, path string) any {
+	switch s := schema.(type) {
+	case bool:
+		if !s {
+			v.addf(path, "value is not allowed")
+		}
+		return value
+	case map[string]any:
+		return v.validateObjectSchema(value, s, path)
+	default:
+		return value
+	}
+}
+
+func (v *schemaValidator) validateObjectSchema(value any, schema map[string]any, path string) any {
+	// 防止循环引用
+	v.depth++
+	defer func() { v.depth-- }()
+	if v.depth > 64 {
+		v.addf(path, "schema nesting too deep")
+		return value
+	}
+
+	if ref, ok := schema["$ref"].(string); ok {
+		target, err := v.resolveRef(ref)
+		if err != nil {
+			v.addf(path, "%v", err)
+		} else {
+			value = v.validate(value, target, path)
+		}
+	}
+
+	if types := schemaTypes(schema["type"]); len(types) > 0 {
+		if !matchesAnyType(value, types) {
+			coerced, ok := any(nil), false
+			if v.coerce {
+				coerced, ok = coerceValue(value, types)
+			}
+			if !ok {
+				v.addf(path, "expected %s, got %s", strings.Join(types, " or "), jsonTypeName(value))
+				return value
+			}
+			value = coerced
+		}
+	}
+
+	if enum, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, e := range enum {
+			if jsonEqual(value, e) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			bs, _ := json.Marshal(enum)
+			v.addf(path, "value must be one of %s", string(bs))
+		}
+	}
+	if c, ok := schema["const"]; ok && !jsonEqual(value, c) {
+		bs, _ := json.Marshal(c)
+		v.addf(path, "value must be %s", string(bs))
+	}
+
+	switch val := value.(type) {
+	case string:
+		v.validateString(val, schema, path)
+	case []any:
+		value = v.validateArray(val, schema, path)
+	case map[string]any:
+		value = v.validateObject(val, schema, path)
+	default:
+		if n, ok := toFloat(value); ok {
+			v.validateNumber(n, schema, path)
+		}
+	}
+
+	value = v.validateCombinators(value, schema, path)
+	return value
+}
+
+func (v *schemaValidator) validateString(s string, schema map[string]any, path string) {
+	length := utf8.RuneCountInString(s)
+	if n, ok := toFloat(schema["minLength"]); ok && float64(length) < n {
+		v.addf(path, "string length must be >= %v", n)
+	}
+	if n, ok := toFloat(schema["maxLength"]); ok && float64(length) > n {
+		v.addf(path, "string length must be <= %v", n)
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(s) {
+			v.addf(path, "string must match pattern %q", pattern)
+		}
+	}
+}
+
+func (v *schemaValidator) validateNumber(n float64, schema map[string]any, path string) {
+	if m, ok := toFloat(schema["minimum"]); ok && n < m {
+		v.addf(path, "value must be >= %v", m)
+	}
+	if m, ok := toFloat(schema["maximum"]); ok && n > m {
+		v.addf(path, "value must be <= %v", m)
+	}
+	if m, ok := toFloat(schema["exclusiveMinimum"]); ok && n <= m {
+		v.addf(path, "value must be > %v", m)
+	}
+	if m, ok := toFloat(schema["exclusiveMaximum"]); ok && n >= m {
+		v.addf(path, "value must be < %v", m)
+	}
+	if m, ok := toFloat(schema["multipleOf"]); ok && m > 0 {
+		if q := n / m; math.Abs(q-math.Round(q)) > 1e-9 {
+			v.addf(path, "value must be a multiple of %v", m)
+		}
+	}
+}
+
+func (v *schemaValidator) validateArray(arr []any, schema map[string]any, path string) []any {
+	if n, ok := toFloat(schema["minItems"]); ok && float64(len(arr)) < n {
+		v.addf(path, "array must have at least %v items", n)
+	}
+	if n, ok := toFloat(schema["maxItems"]); ok && float64(len(arr)) > n {
+		v.addf(path, "array must have at most %v items", n)
+	}
+	prefix, _ := schema["prefixItems"].([]any)
+	for i := range arr {
+		itemPath := fmt.Sprintf("%s/%d", path, i)
+		if i < len(prefix) {
+			arr[i] = v.validate(arr[i], prefix[i], itemPath)
+		} else if items, ok := schema["items"]; ok {
+			arr[i] = v.validate(arr[i], items, itemPath)
+		}
+	}
+	if unique, _ := schema["uniqueItems"].(bool); unique {
+	UNIQUE_LOOP:
+		for i := range arr {
+			for j := i + 1; j < len(arr); j++ {
+				if jsonEqual(arr[i], arr[j]) {
+					v.addf(path, "array items must be unique")
+					break UNIQUE_LOOP
+				}
+			}
+		}
+	}
+	return arr
+}
+
+func (v *schemaValidator) validateObject(obj map[string]any, schema map[string]any, path string) map[string]any {
+	if required, ok := schema["required"].([]any); ok {
+		for _, r := range required {
+			if name, ok := r.(string); ok {
+				if _, exists := obj[name]; !exists {
+					v.addf(joinPointer(path, name), "missing required property")
+				}
+			}
+		}
+	}
+	if n, ok := toFloat(schema["minProperties"]); ok && float64(len(obj)) < n {
+		v.addf(path, "object must have at least %v properties", n)
+	}
+	if n, ok := toFloat(schema["maxProperties"]); ok && float64(len(obj)) > n {
+		v.addf(path, "object must have at most %v properties", n)
+	}
+
+	properties, _ := schema["properties"].(map[string]any)
+	patternProperties, _ := schema["patternProperties"].(map[string]any)
+	additional, hasAdditional := schema["additionalProperties"]
+	for _, key := range sortedKeys(obj) {
+		propPath := joinPointer(path, key)
+		matched := false
+		if propSchema, ok := properties[key]; ok {
+			obj[key] = v.validate(obj[key], propSchema, propPath)
+			matched = true
+		}
+		for pattern, propSchema := range patternProperties {
+			if re, err := regexp.Compile(pattern); err == nil && re.MatchString(key) {
+				obj[key] = v.validate(obj[key], propSchema, propPath)
+				matched = true
+			}
+		}
+		if !matched && hasAdditional {
+			if allowed, ok := additional.(bool); ok && !allowed {
+				v.addf(propPath, "additional property is not allowed")
+			} else {
+				obj[key] = v.validate(obj[key], additional, propPath)
+			}
+		}
+	}
+	return obj
+}
+
+func (v *schemaValidator) validateCombinators(value any, schema map[string]any, path string) any {
+	if allOf, ok := schema["allOf"].([]any); ok {
+		for _, sub := range allOf {
+			value = v.validate(value, sub, path)
+		}
+	}
+	if anyOf, ok := schema["anyOf"].([]any); ok {
+		matched, coerced := v.matchBranches(value, anyOf, path)
+		if matched == 0 {
+			v.addf(path, "value must match at least one schema in anyOf")
+		} else {
+			value = coerced
+		}
+	}
+	if oneOf, ok := schema["oneOf"].([]any); ok {
+		matched, coerced := v.matchBranches(value, oneOf, path)
+		if matched != 1 {
+			v.addf(path, "value must match exactly one schema in oneOf, matched %d", matched)
+		} else {
+			value = coerced
+		}
+	}
+	if not, ok := schema["not"]; ok {
+		sub := &schemaValidator{root: v.root, depth: v.depth}
+		sub.validate(deepCopyJSON(value), not, path)
+		if len(sub.violations) == 0 {
+			v.addf(path, "value must not match schema in not")
+		}
+	}
+	return value
+}
+
+// matchBranches 统计匹配的分支数量；没有分支严格匹配时尝试类型转换
+func (v *schemaValidator) matchBranches(value any, branches []any, path string) (int, any) {
+	matched := 0
+	for _, branch := range branches {
+		sub := &schemaValidator{root: v.root, depth: v.depth}
+		sub.validate(deepCopyJSON(value), branch, path)
+		if len(sub.violations) == 0 {
+			matched++
+		}
+	}
+	if matched > 0 || !v.coerce {
+		return matched, value
+	}
+	for _, branch := range branches {
+		sub := &schemaValidator{root: v.root, coerce: true, depth: v.depth}
+		coerced := sub.validate(deepCopyJSON(value), branch, path)
+		if len(sub.violations) == 0 {
+			return 1, coerced
+		}
+	}
+	return 0, value
+}
+
+// resolveRef 解析本地引用，例如 #/$defs/address
+func (v *schemaValidator) resolveRef(ref string) (any, error) {
+	if ref == "#" {
+		return v.root, nil
+	}
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("unsupported $ref %q", ref)
+	}
+	current := v.root
+	for _, token := range strings.Split(ref[2:], "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		switch node := current.(type) {
+		case map[string]any:
+			next, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("unresolvable $ref %q", ref)
+			}
+			current = next
+		case []any:
+			idx, err := strconv.Atoi(token)
+			if err != nil || idx < 0 || idx >= len(node) {
+				return nil, fmt.Errorf("unresolvable $ref %q", ref)
+			}
+			current = node[idx]
+		default:
+			return nil, fmt.Errorf("unresolvable $ref %q", ref)
+		}
+	}
+	return current, nil
+}
+
+// schemaTypes 读取type关键字
+func schemaTypes(t any) []string {
+	switch tt := t.(type) {
+	case string:
+		return []string{tt}
+	case []any:
+		types := make([]string, 0, len(tt))
+		for _, x := range tt {
+			if s, ok := x.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+func matchesAnyType(value any, types []string) bool {
+	for _, t := range types {
+		if matchesType(value, t) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesType(value any, t string) bool {
+	switch t {
+	case "null":
+		return value == nil
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "number":
+		_, ok := toFloat(value)
+		return ok
+	case "integer":
+		n, ok := toFloat(value)
+		return ok && n == math.Trunc(n) && !math.IsInf(n, 0)
+	}
+	return true
+}
+
+// coerceValue 尝试安全的类型转换
+func coerceValue(value any, types []string) (any, bool) {
+	for _, t := range types {
+		switch src := value.(type) {
+		case string:
+			s := strings.TrimSpace(src)
+			switch t {
+			case "integer":
+				if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+					return i, true
+				}
+				if f, err := strconv.ParseFloat(s, 64); err == nil && f == math.Trunc(f) && !math.IsInf(f, 0) {
+					return f, true
+				}
+			case "number":
+				if f, err := strconv.ParseFloat(s, 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+					return f, true
+				}
+			case "boolean":
+				switch strings.ToLower(s) {
+				case "true":
+					return true, true
+				case "false":
+					return false, true
+				}
+			case "null":
+				if s == "null" {
+					return nil, true
+				}
+			case "array":
+				var arr []any
+				if strings.HasPrefix(s, "[") && json.Unmarshal([]byte(s), &arr) == nil {
+					return arr, true
+				}
+			case "object":
+				var obj map[string]any
+				if strings.HasPrefix(s, "{") && json.Unmarshal([]byte(s), &obj) == nil {
+					return obj, true
+				}
+			}
+		case bool:
+			if t == "string" {
+				return strconv.FormatBool(src), true
+			}
+		default:
+			if n, ok := toFloat(value); ok && t == "string" {
+				return strconv.FormatFloat(n, 'f', -1, 64), true
+			}
+		}
+	}
+	return value, false
+}
+
+func jsonTypeName(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	}
+	if n, ok := toFloat(value); ok {
+		if n == math.Trunc(n) {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// toFloat 将数值类型转换为float64
+func toFloat(value any) (float64, bool) {
+	switch n := value.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// jsonEqual 按JSON语义比较两个值，数值按大小比较
+func jsonEqual(a, b any) bool {
+	if na, ok := toFloat(a); ok {
+		nb, ok := toFloat(b)
+		return ok && na == nb
+	}
+	switch av := a.(type) {
+	case []any:
+		bv, ok := b.([]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !jsonEqual(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]any:
+		bv, ok := b.(map[string]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for k, x := range av {
+			y, ok := bv[k]
+			if !ok || !jsonEqual(x, y) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// deepCopyJSON 深拷贝JSON值
+func deepCopyJSON(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, x := range v {
+			m[k] = deepCopyJSON(x)
+		}
+		return m
+	case []any:
+		arr := make([]any, len(v))
+		for i, x := range v {
+			arr[i] = deepCopyJSON(x)
+		}
+		return arr
+	}
+	return value
+}
+
+// joinPointer 拼接JSON Pointer
+func joinPointer(path string, token string) string {
+	token = strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+	return path + "/" + token
+}
+
+// sortedKeys 返回排序后的键，保证违规列表的顺序稳定
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
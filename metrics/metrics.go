@@ -0,0 +1,274 @@
+// Package metrics 为MCPHost和LLM客户端提供Prometheus指标
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/longdexin/MCP_Host"
+	"github.com/longdexin/MCP_Host/llm"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// 默认指标命名空间
+const DefaultNamespace = "mcp_host"
+
+// 工具调用状态
+const (
+	StatusSuccess   = "success"    // 调用成功
+	StatusError     = "error"      // 传输或连接错误
+	StatusToolError = "tool_error" // 服务器将结果标记为错误
+)
+
+// Metrics 采集主机与LLM指标，实现了MCP_Host.HostObserver和llm.RequestObserver
+type Metrics struct {
+	registerer prometheus.Registerer
+	gatherer   prometheus.Gatherer
+
+	toolCalls        *prometheus.CounterVec
+	toolCallDuration *prometheus.HistogramVec
+	reconnects       *prometheus.CounterVec
+	serverConnected  *prometheus.GaugeVec
+	connectedServers prometheus.Gauge
+	llmRequests      *prometheus.CounterVec
+	llmDuration      *prometheus.HistogramVec
+	llmTokens        *prometheus.CounterVec
+
+	connected map[string]struct{}
+	mutex     sync.Mutex
+}
+
+var (
+	_ MCP_Host.HostObserver = (*Metrics)(nil)
+	_ llm.RequestObserver   = (*Metrics)(nil)
+)
+
+// Option Metrics的配置选项
+type Option func(*options)
+
+type options struct {
+	namespace   string
+	toolBuckets []float64
+	llmBuckets  []float64
+	constLabels prometheus.Labels
+	registerer  prometheus.Registerer
+	gatherer    prometheus.Gatherer
+}
+
+// WithNamespace 设置指标命名空间，默认为 mcp_host
+func WithNamespace(namespace string) Option {
+	return func(o *options) {
+		o.namespace = namespace
+	}
+}
+
+// WithRegistry 使用指定的Registry注册并导出指标
+func WithRegistry(registry *prometheus.Registry) Option {
+	return func(o *options) {
+		o.registerer = registry
+		o.gatherer = registry
+	}
+}
+
+// WithDefaultRegistry 使用Prometheus全局默认Registry
+func WithDefaultRegistry() Option {
+	return func(o *options) {
+		o.registerer = prometheus.DefaultRegisterer
+		o.gatherer = prometheus.DefaultGatherer
+	}
+}
+
+// WithConstLabels 设置所有指标的固定标签
+func WithConstLabels(labels prometheus.Labels) Option {
+	return func(o *options) {
+		o.constLabels = labels
+	}
+}
+
+// WithToolBuckets 设置工具调用耗时直方图的桶（秒）
+func WithToolBuckets(buckets []float64) Option {
+	return func(o *options) {
+		o.toolBuckets = buckets
+	}
+}
+
+// WithLLMBuckets 设置LLM请求耗时直方图的桶（秒）
+func WithLLMBuckets(buckets []float64) Option {
+	return func(o *options) {
+		o.llmBuckets = buckets
+	}
+}
+
+// New 创建并注册指标。未指定Registry时使用新建的独立Registry
+func New(opts ...Option) (*Metrics, error) {
+	o := &options{
+		namespace:   DefaultNamespace,
+		toolBuckets: prometheus.DefBuckets,
+		llmBuckets:  []float64{0.25, 0.5, 1, 2, 4, 8, 16, 32, 64, 128},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.registerer == nil {
+		registry := prometheus.NewRegistry()
+		o.registerer = registry
+		o.gatherer = registry
+	}
+
+	m := &Metrics{
+		registerer: o.registerer,
+		gatherer:   o.gatherer,
+		connected:  make(map[string]struct{}),
+		toolCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   o.namespace,
+			Name:        "tool_calls_total",
+			Help:        "Total number of MCP tool calls by server, tool and status.",
+			ConstLabels: o.constLabels,
+		}, []string{"server", "tool", "status"}),
+		toolCallDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   o.namespace,
+			Name:        "tool_call_duration_seconds",
+			Help:        "Latency of MCP tool calls in seconds.",
+			ConstLabels: o.constLabels,
+			Buckets:     o.toolBuckets,
+		}, []string{"server", "tool"}),
+		reconnects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   o.namespace,
+			Name:        "reconnects_total",
+			Help:        "Total number of reconnect attempts by server and result.",
+			ConstLabels: o.constLabels,
+		}, []string{"server", "result"}),
+		serverConnected: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   o.namespace,
+			Name:        "server_connected",
+			Help:        "Whether the MCP server is currently connected (1) or not (0).",
+			ConstLabels: o.constLabels,
+		}, []string{"server"}),
+		connectedServers: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   o.namespace,
+			Name:        "connected_servers",
+			Help:        "Number of currently connected MCP servers.",
+			ConstLabels: o.constLabels,
+		}),
+		llmRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   o.namespace,
+			Name:        "llm_requests_total",
+			Help:        "Total number of LLM requests by provider, model and status.",
+			ConstLabels: o.constLabels,
+		}, []string{"provider", "model", "status"}),
+		llmDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   o.namespace,
+			Name:        "llm_request_duration_seconds",
+			Help:        "Latency of LLM requests in seconds.",
+			ConstLabels: o.constLabels,
+			Buckets:     o.llmBuckets,
+		}, []string{"provider", "model"}),
+		llmTokens: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   o.namespace,
+			Name:        "llm_tokens_total",
+			Help:        "Total number of LLM tokens by provider, model and type.",
+			ConstLabels: o.constLabels,
+		}, []string{"provider", "model", "type"}),
+	}
+
+	for _, collector := range m.collectors() {
+		if err := o.registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// collectors 返回所有指标
+func (m *Metrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.toolCalls,
+		m.toolCallDuration,
+		m.reconnects,
+		m.serverConnected,
+		m.connectedServers,
+		m.llmRequests,
+		m.llmDuration,
+		m.llmTokens,
+	}
+}
+
+// ToolCallFinished 记录工具调用次数与耗时
+func (m *Metrics) ToolCallFinished(serverID string, toolName string, latency time.Duration, isError bool, err error) {
+	status := StatusSuccess
+	if err != nil {
+		status = StatusError
+	} else if isError {
+		status = StatusToolError
+	}
+	m.toolCalls.WithLabelValues(serverID, toolName, status).Inc()
+	m.toolCallDuration.WithLabelValues(serverID, toolName).Observe(latency.Seconds())
+}
+
+// Reconnected 记录重连次数
+func (m *Metrics) Reconnected(serverID string, err error) {
+	result := StatusSuccess
+	if err != nil {
+		result = StatusError
+	}
+	m.reconnects.WithLabelValues(serverID, result).Inc()
+}
+
+// ConnectionChanged 更新连接状态
+func (m *Metrics) ConnectionChanged(serverID string, connected bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if connected {
+		m.connected[serverID] = struct{}{}
+		m.serverConnected.WithLabelValues(serverID).Set(1)
+	} else {
+		delete(m.connected, serverID)
+		m.serverConnected.WithLabelValues(serverID).Set(0)
+	}
+	m.connectedServers.Set(float64(len(m.connected)))
+}
+
+// RequestFinished 记录LLM请求次数、耗时与令牌数
+func (m *Metrics) RequestFinished(provider string, model string, latency time.Duration, usage *llm.Usage, err error) {
+	status := StatusSuccess
+	if err != nil {
+		status = StatusError
+	}
+	m.llmRequests.WithLabelValues(provider, model, status).Inc()
+	m.llmDuration.WithLabelValues(provider, model).Observe(latency.Seconds())
+	if usage != nil {
+		m.llmTokens.WithLabelValues(provider, model, "prompt").Add(float64(usage.PromptTokens))
+		m.llmTokens.WithLabelValues(provider, model, "completion").Add(float64(usage.CompletionTokens))
+	}
+}
+
+// HostOption 返回将指标挂载到MCPHost的选项
+func (m *Metrics) HostOption() MCP_Host.HostOption {
+	return MCP_Host.WithHostObserver(m)
+}
+
+// OpenAIOption 返回将指标挂载到OpenAIClient的选项
+func (m *Metrics) OpenAIOption() llm.OpenAIOption {
+	return llm.WithRequestObserver(m)
+}
+
+// Handler 返回导出指标的 /metrics 处理器
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.gatherer, promhttp.HandlerOpts{})
+}
+
+// Unregister 从Registry中注销所有指标
+func (m *Metrics) Unregister() error {
+	var errs []error
+	for _, collector := range m.collectors() {
+		if !m.registerer.Unregister(collector) {
+			errs = append(errs, errors.New("collector was not registered"))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,476 @@
+package MCP_Host
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+)
+
+// 动态注册客户端时默认使用的名称
+const DefaultOAuthClientName = "MCP Host"
+
+// OAuthConfig 远程服务器的OAuth 2.1授权配置
+type OAuthConfig struct {
+	ClientID              string               // 客户端ID，为空时使用动态客户端注册
+	ClientSecret          string               // 客户端密钥，公开客户端为空
+	ClientName            string               // 动态注册时使用的客户端名称
+	RedirectURI           string               // 授权完成后的重定向地址
+	Scopes                []string             // 请求的权限范围
+	TokenStore            transport.TokenStore // 令牌存储，默认保存在内存中
+	AuthServerMetadataURL string               // 授权服务器元数据地址，为空时自动发现
+	Authorizer            Authorizer           // 处理浏览器授权与重定向，为空时无法完成交互式授权
+	HTTPClient            *http.Client         // 发现、注册和令牌请求使用的HTTP客户端
+}
+
+// Authorizer 引导用户打开授权页面，并返回重定向中携带的授权码和state
+type Authorizer interface {
+	Authorize(ctx context.Context, authURL string) (code string, state string, err error)
+}
+
+// AuthorizerFunc 函数形式的Authorizer
+type AuthorizerFunc func(ctx context.Context, authURL string) (code string, state string, err error)
+
+// Authorize 实现Authorizer
+func (f AuthorizerFunc) Authorize(ctx context.Context, authURL string) (string, string, error) {
+	return f(ctx, authURL)
+}
+
+// OAuthClientStore 可选接口，TokenStore同时实现时用于保存动态注册得到的客户端，避免每次启动重新注册
+type OAuthClientStore interface {
+	GetClient(ctx context.Context) (clientID string, clientSecret string, err error)
+	SaveClient(ctx context.Context, clientID string, clientSecret string) error
+}
+
+// ConnectSSEWithOAuth 使用SSE传输连接到需要OAuth授权的MCP服务器。没有可用令牌且无法刷新时，
+// 依次进行元数据发现、动态客户端注册和PKCE授权码流程，之后由传输层自动附带和刷新令牌
+func (h *MCPHost) ConnectSSEWithOAuth(ctx context.Context, serverID string, baseURL string, config OAuthConfig, options ...transport.ClientOption) (*ServerConnection, error) {
+	if config.TokenStore == nil {
+		config.TokenStore = transport.NewMemoryTokenStore()
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	if config.ClientName == "" {
+		config.ClientName = DefaultOAuthClientName
+	}
+	if config.ClientID == "" {
+		if store, ok := config.TokenStore.(OAuthClientStore); ok {
+			clientID, clientSecret, err := store.GetClient(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load oauth client: %w", err)
+			}
+			config.ClientID, config.ClientSecret = clientID, clientSecret
+		}
+	}
+	if config.AuthServerMetadataURL == "" {
+		// 发现失败时由传输层按默认规则查找
+		config.AuthServerMetadataURL, _ = discoverAuthServerMetadata(ctx, config.HTTPClient, baseURL)
+	}
+
+	conn, err := h.connectSSE(ctx, serverID, baseURL, &config, options)
+	if err == nil || !isOAuthAuthorizationRequired(err) {
+		return conn, err
+	}
+	if config.Authorizer == nil {
+		return nil, fmt.Errorf("server %s requires authorization but no authorizer is configured: %w", serverID, err)
+	}
+	if err := authorizeOAuth(ctx, baseURL, &config); err != nil {
+		return nil, fmt.Errorf("server %s: oauth authorization failed: %w", serverID, err)
+	}
+	return h.connectSSE(ctx, serverID, baseURL, &config, options)
+}
+
+// authorizeOAuth 执行授权码流程，成功后令牌保存在config.TokenStore中
+func authorizeOAuth(ctx context.Context, baseURL string, config *OAuthConfig) error {
+	handler := transport.NewOAuthHandler(config.transportConfig())
+	if u, err := url.Parse(baseURL); err == nil {
+		handler.SetBaseURL(u.Scheme + "://" + u.Host)
+	}
+
+	if config.ClientID == "" {
+		if err := handler.RegisterClient(ctx, config.ClientName); err != nil {
+			return fmt.Errorf("failed to register client: %w", err)
+		}
+		config.ClientID, config.ClientSecret = handler.GetClientID(), handler.GetClientSecret()
+		if store, ok := config.TokenStore.(OAuthClientStore); ok {
+			if err := store.SaveClient(ctx, config.ClientID, config.ClientSecret); err != nil {
+				return fmt.Errorf("failed to save oauth client: %w", err)
+			}
+		}
+	}
+
+	verifier, err := transport.GenerateCodeVerifier()
+	if err != nil {
+		return fmt.Errorf("failed to generate code verifier: %w", err)
+	}
+	state, err := transport.GenerateState()
+	if err != nil {
+		return fmt.Errorf("failed to generate state: %w", err)
+	}
+	authURL, err := handler.GetAuthorizationURL(ctx, state, transport.GenerateCodeChallenge(verifier))
+	if err != nil {
+		return err
+	}
+
+	code, returnedState, err := config.Authorizer.Authorize(ctx, authURL)
+	if err != nil {
+		return err
+	}
+	return handler.ProcessAuthorizationResponse(ctx, code, returnedState, verifier)
+}
+
+// transportConfig 转换为传输层的OAuth配置，始终启用PKCE
+func (c *OAuthConfig) transportConfig() transport.OAuthConfig {
+	return transport.OAuthConfig{
+		ClientID:              c.ClientID,
+		ClientSecret:          c.ClientSecret,
+		RedirectURI:           c.RedirectURI,
+		Scopes:                c.Scopes,
+		TokenStore:            c.TokenStore,
+		AuthServerMetadataURL: c.AuthServerMetadataURL,
+		PKCEEnabled:           true,
+		HTTPClient:            c.HTTPClient,
+	}
+}
+
+func isOAuthAuthorizationRequired(err error) bool {
+	return client.IsOAuthAuthorizationRequiredError(err) || errors.Is(err, transport.ErrOAuthAuthorizationRequired)
+}
+
+// discoverAuthServerMetadata 按RFC 9728和RFC 8414发现授权服务器元数据地址：
+// 优先使用401响应WWW-Authenticate中的resource_metadata，其次使用受保护资源的well-known地址
+func discoverAuthServerMetadata(ctx context.Context, httpClient *http.Client, baseURL string) (string, error) {
+	resource, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+
+	var candidates []string
+	if metadataURL := probeResourceMetadata(ctx, httpClient, baseURL); metadataURL != "" {
+		candidates = append(candidates, metadataURL)
+	}
+	candidates = append(candidates, wellKnownURLs(resource, "oauth-protected-resource")...)
+
+	var protectedResource transport.OAuthProtectedResource
+	found := false
+	for _, candidate := range candidates {
+		if err := fetchJSON(ctx, httpClient, candidate, &protectedResource); err == nil {
+			found = true
+			break
+		}
+	}
+	if !found || len(protectedResource.AuthorizationServers) == 0 {
+		return "", errors.New("protected resource metadata not found")
+	}
+
+	issuer, err := url.Parse(protectedResource.AuthorizationServers[0])
+	if err != nil {
+		return "", fmt.Errorf("invalid authorization server: %w", err)
+	}
+	candidates = append(wellKnownURLs(issuer, "oauth-authorization-server"), wellKnownURLs(issuer, "openid-configuration")...)
+	if path := strings.TrimSuffix(issuer.Path, "/"); path != "" {
+		candidates = append(candidates, strings.TrimSuffix(issuer.String(), "/")+"/.well-known/openid-configuration")
+	}
+	for _, candidate := range candidates {
+		var metadata transport.AuthServerMetadata
+		if err := fetchJSON(ctx, httpClient, candidate, &metadata); err == nil && metadata.TokenEndpoint != "" {
+			return candidate, nil
+		}
+	}
+	return "", errors.New("authorization server metadata not found")
+}
+
+// probeResourceMetadata 不带令牌请求服务器，从401响应中读取resource_metadata
+func probeResourceMetadata(ctx context.Context, httpClient *http.Client, baseURL string) string {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL, nil)
+	if err != nil {
+		return ""
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return ""
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		return ""
+	}
+	for _, challenge := range resp.Header.Values("WWW-Authenticate") {
+		if value := authParam(challenge, "resource_metadata"); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// authParam 从WWW-Authenticate中读取参数值
+func authParam(challenge string, name string) string {
+	for _, part := range strings.Split(challenge, ",") {
+		part = strings.TrimSpace(part)
+		if scheme, rest, ok := strings.Cut(part, " "); ok && !strings.Contains(scheme, "=") {
+			part = strings.TrimSpace(rest)
+		}
+		key, value, ok := strings.Cut(part, "=")
+		if ok && strings.EqualFold(strings.TrimSpace(key), name) {
+			return strings.Trim(strings.TrimSpace(value), `"`)
+		}
+	}
+	return ""
+}
+
+// wellKnownURLs 返回well-known地址，地址带路径时先尝试插入路径的形式
+func wellKnownURLs(u *url.URL, name string) []string {
+	origin := u.Scheme + "://" + u.Host
+	var urls []string
+	if path := strings.TrimSuffix(u.Path, "/"); path != "" {
+		urls = append(urls, origin+"/.well-known/"+name+path)
+	}
+	return append(urls, origin+"/.well-known/"+name)
+}
+
+func fetchJSON(ctx context.Context, httpClient *http.Client, target string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// LoopbackAuthorizer 在本机回环地址上监听重定向的Authorizer
+type LoopbackAuthorizer struct {
+	redirectURI string
+	open        func(authURL string) error
+}
+
+var _ Authorizer = (*LoopbackAuthorizer)(nil)
+
+// NewLoopbackAuthorizer 创建回环Authorizer，redirectURI应与OAuthConfig.RedirectURI一致，
+// 例如 "http://127.0.0.1:8085/callback"；open用于打开授权页面，为nil时使用OpenBrowser
+func NewLoopbackAuthorizer(redirectURI string, open func(authURL string) error) *LoopbackAuthorizer {
+	if open == nil {
+		open = OpenBrowser
+	}
+	return &LoopbackAuthorizer{redirectURI: redirectURI, open: open}
+}
+
+// Authorize 实现Authorizer，等待重定向或ctx结束
+func (a *LoopbackAuthorizer) Authorize(ctx context.Context, authURL string) (string, string, error) {
+	redirect, err := url.Parse(a.redirectURI)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid redirect uri: %w", err)
+	}
+	if err := transport.ValidateRedirectURI(a.redirectURI); err != nil {
+		return "", "", err
+	}
+	listener, err := net.Listen("tcp", redirect.Host)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to listen on %s: %w", redirect.Host, err)
+	}
+
+	type result struct {
+		code  string
+		state string
+		err   error
+	}
+	results := make(chan result, 1)
+	mux := http.NewServeMux()
+	path := redirect.Path
+	if path == "" {
+		path = "/"
+	}
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		var res result
+		if errCode := query.Get("error"); errCode != "" {
+			res.err = fmt.Errorf("authorization denied: %s %s", errCode, query.Get("error_description"))
+			fmt.Fprintln(w, "Authorization failed, you can close this window.")
+		} else {
+			res.code, res.state = query.Get("code"), query.Get("state")
+			fmt.Fprintln(w, "Authorization complete, you can close this window.")
+		}
+		select {
+		case results <- res:
+		default:
+		}
+	})
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(listener)
+	defer srv.Close()
+
+	if err := a.open(authURL); err != nil {
+		return "", "", fmt.Errorf("failed to open authorization url: %w", err)
+	}
+	select {
+	case <-ctx.Done():
+		return "", "", ctx.Err()
+	case res := <-results:
+		return res.code, res.state, res.err
+	}
+}
+
+// OpenBrowser 使用系统默认浏览器打开地址
+func OpenBrowser(target string) error {
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("open", target).Start()
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", target).Start()
+	default:
+		return exec.Command("xdg-open", target).Start()
+	}
+}
+
+// FileTokenStore 将令牌和动态注册的客户端保存在JSON文件中，文件权限为0600
+type FileTokenStore struct {
+	path  string
+	mutex sync.Mutex
+}
+
+var (
+	_ transport.TokenStore = (*FileTokenStore)(nil)
+	_ OAuthClientStore     = (*FileTokenStore)(nil)
+)
+
+// fileTokenData FileTokenStore的文件内容
+type fileTokenData struct {
+	Token        *transport.Token `json:"token,omitempty"`
+	ClientID     string           `json:"client_id,omitempty"`
+	ClientSecret string           `json:"client_secret,omitempty"`
+}
+
+// NewFileTokenStore 创建文件令牌存储，每个服务器应使用单独的文件
+func NewFileTokenStore(path string) *FileTokenStore {
+	return &FileTokenStore{path: path}
+}
+
+// GetToken 实现transport.TokenStore
+func (s *FileTokenStore) GetToken(ctx context.Context) (*transport.Token, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	data, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	if data.Token == nil {
+		return nil, transport.ErrNoToken
+	}
+	return data.Token, nil
+}
+
+// SaveToken 实现transport.TokenStore
+func (s *FileTokenStore) SaveToken(ctx context.Context, token *transport.Token) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	data, err := s.load()
+	if err != nil {
+		return err
+	}
+	data.Token = token
+	return s.save(data)
+}
+
+// GetClient 实现OAuthClientStore
+func (s *FileTokenStore) GetClient(ctx context.Context) (string, string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", "", err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	data, err := s.load()
+	if err != nil {
+		return "", "", err
+	}
+	return data.ClientID, data.ClientSecret, nil
+}
+
+// SaveClient 实现OAuthClientStore
+func (s *FileTokenStore) SaveClient(ctx context.Context, clientID string, clientSecret string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	data, err := s.load()
+	if err != nil {
+		return err
+	}
+	data.ClientID, data.ClientSecret = clientID, clientSecret
+	return s.save(data)
+}
+
+func (s *FileTokenStore) load() (*fileTokenData, error) {
+	data := &fileTokenData{}
+	bs, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return data, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token file: %w", err)
+	}
+	if err := json.Unmarshal(bs, data); err != nil {
+		return nil, fmt.Errorf("failed to parse token file: %w", err)
+	}
+	return data, nil
+}
+
+// save 先写入临时文件再重命名，避免写入中断导致文件损坏
+func (s *FileTokenStore) save(data *fileTokenData) error {
+	bs, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write token file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write token file: %w", err)
+	}
+	if _, err := tmp.Write(bs); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write token file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write token file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to write token file: %w", err)
+	}
+	return nil
+}
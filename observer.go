@@ -0,0 +1,56 @@
+package MCP_Host
+
+import "time"
+
+// HostObserver 观察主机的连接与工具执行事件，用于指标采集等场景
+type HostObserver interface {
+	// ToolCallFinished 工具执行结束，isError表示服务器将结果标记为错误
+	ToolCallFinished(serverID string, toolName string, latency time.Duration, isError bool, err error)
+	// Reconnected 尝试重连结束
+	Reconnected(serverID string, err error)
+	// ConnectionChanged 连接建立或断开
+	ConnectionChanged(serverID string, connected bool)
+}
+
+// AuditObserver 可选接口，HostObserver同时实现该接口时在审计记录写入失败时收到通知
+type AuditObserver interface {
+	// AuditFailed 工具执行后写入审计记录失败
+	AuditFailed(serverID string, toolName string, err error)
+}
+
+// WithHostObserver 添加主机事件观察者，可以多次调用添加多个观察者
+func WithHostObserver(observer HostObserver) HostOption {
+	return func(h *MCPHost) {
+		h.observers = append(h.observers, observer)
+	}
+}
+
+// notifyToolCallFinished 通知工具执行结束
+func (h *MCPHost) notifyToolCallFinished(serverID string, toolName string, latency time.Duration, isError bool, err error) {
+	for _, observer := range h.observers {
+		observer.ToolCallFinished(serverID, toolName, latency, isError, err)
+	}
+}
+
+// notifyReconnected 通知重连结束
+func (h *MCPHost) notifyReconnected(serverID string, err error) {
+	for _, observer := range h.observers {
+		observer.Reconnected(serverID, err)
+	}
+}
+
+// notifyConnectionChanged 通知连接状态变化
+func (h *MCPHost) notifyConnectionChanged(serverID string, connected bool) {
+	for _, observer := range h.observers {
+		observer.ConnectionChanged(serverID, connected)
+	}
+}
+
+// notifyAuditFailed 通知审计记录写入失败
+func (h *MCPHost) notifyAuditFailed(serverID string, toolName string, err error) {
+	for _, observer := range h.observers {
+		if o, ok := observer.(AuditObserver); ok {
+			o.AuditFailed(serverID, toolName, err)
+		}
+	}
+}
@@ -0,0 +1,394 @@
+package MCP_Host
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// 默认的脱敏替换文本
+const DefaultRedactReplacement = "[REDACTED]"
+
+// DefaultRedactKeyPattern 常见敏感字段名的匹配模式，NewRedactor默认使用
+const DefaultRedactKeyPattern = `(?i)(api[_-]?key|access[_-]?token|refresh[_-]?token|secret|password|passwd|authorization|cookie|credential|private[_-]?key)`
+
+// Redactor 对离开本库的数据（调试输出、通知、审计、日志）进行脱敏，发送给服务器的数据不受影响。
+// nil Redactor不做任何处理
+type Redactor struct {
+	keyPatterns   []*regexp.Regexp
+	valuePatterns []*regexp.Regexp
+	paths         [][]string
+	replacement   string
+}
+
+// RedactorOption Redactor的配置选项
+type RedactorOption func(*redactorOptions)
+
+type redactorOptions struct {
+	noDefaultKeys bool
+	keyPatterns   []string
+	valuePatterns []string
+	paths         []string
+	replacement   string
+}
+
+// WithRedactKeys 按字段名脱敏，参数为正则表达式，匹配到的字段值整体替换
+func WithRedactKeys(patterns ...string) RedactorOption {
+	return func(o *redactorOptions) {
+		o.keyPatterns = append(o.keyPatterns, patterns...)
+	}
+}
+
+// WithoutDefaultRedactKeys 不使用DefaultRedactKeyPattern，只按WithRedactKeys指定的字段名脱敏
+func WithoutDefaultRedactKeys() RedactorOption {
+	return func(o *redactorOptions) {
+		o.noDefaultKeys = true
+	}
+}
+
+// WithRedactValues 按内容脱敏，字符串中匹配正则表达式的部分被替换
+func WithRedactValues(patterns ...string) RedactorOption {
+	return func(o *redactorOptions) {
+		o.valuePatterns = append(o.valuePatterns, patterns...)
+	}
+}
+
+// WithRedactPaths 按JSON路径脱敏，例如 "$.auth.token"、"users[*].phone"，"*"匹配任意字段或下标
+func WithRedactPaths(paths ...string) RedactorOption {
+	return func(o *redactorOptions) {
+		o.paths = append(o.paths, paths...)
+	}
+}
+
+// WithRedactReplacement 设置替换文本，默认为 [REDACTED]
+func WithRedactReplacement(replacement string) RedactorOption {
+	return func(o *redactorOptions) {
+		o.replacement = replacement
+	}
+}
+
+// NewRedactor 创建Redactor，默认按DefaultRedactKeyPattern匹配字段名
+func NewRedactor(opts ...RedactorOption) (*Redactor, error) {
+	o := &redactorOptions{replacement: DefaultRedactReplacement}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if !o.noDefaultKeys {
+		o.keyPatterns = append([]string{DefaultRedactKeyPattern}, o.keyPatterns...)
+	}
+
+	r := &Redactor{replacement: o.replacement}
+	for _, pattern := range o.keyPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key pattern %q: %w", pattern, err)
+		}
+		r.keyPatterns = append(r.keyPatterns, re)
+	}
+	for _, pattern := range o.valuePatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value pattern %q: %w", pattern, err)
+		}
+		r.valuePatterns = append(r.valuePatterns, re)
+	}
+	for _, path := range o.paths {
+		tokens, err := parseRedactPath(path)
+		if err != nil {
+			return nil, err
+		}
+		r.paths = append(r.paths, tokens)
+	}
+	return r, nil
+}
+
+// parseRedactPath 将JSON路径解析为字段名与下标的序列
+func parseRedactPath(path string) ([]string, error) {
+	p := strings.TrimSpace(path)
+	p = strings.TrimPrefix(p, "$")
+	p = strings.TrimPrefix(p, ".")
+	if p == "" {
+		return nil, fmt.Errorf("invalid redact path %q", path)
+	}
+	var tokens []string
+	for _, segment := range strings.Split(p, ".") {
+		for segment != "" {
+			idx := strings.IndexByte(segment, '[')
+			if idx < 0 {
+				tokens = append(tokens, segment)
+				break
+			}
+			if idx > 0 {
+				tokens = append(tokens, segment[:idx])
+			}
+			end := strings.IndexByte(segment[idx:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid redact path %q", path)
+			}
+			tokens = append(tokens, strings.Trim(segment[idx+1:idx+end], `"'`))
+			segment = segment[idx+end+1:]
+		}
+	}
+	for _, token := range tokens {
+		if token == "" {
+			return nil, fmt.Errorf("invalid redact path %q", path)
+		}
+	}
+	return tokens, nil
+}
+
+// 文本中的标签，例如文本模式的 <MCP_HOST_TASK>
+var redactTagRegex = regexp.MustCompile(`<([A-Za-z_][A-Za-z0-9_.:-]*)>`)
+
+// RedactString 对字符串脱敏。字符串本身是JSON对象或数组时按结构脱敏；
+// 否则标签内的JSON（例如文本模式的任务和结果）也按结构脱敏
+func (r *Redactor) RedactString(s string) string {
+	if r == nil {
+		return s
+	}
+	if len(r.keyPatterns)+len(r.paths) > 0 {
+		if redacted, ok := r.redactJSON(s); ok {
+			return redacted
+		}
+		s = r.redactTagged(s)
+	}
+	return r.redactText(s)
+}
+
+// redactJSON 字符串去掉首尾空白后是JSON对象或数组时返回按结构脱敏后的JSON
+func (r *Redactor) redactJSON(s string) (string, bool) {
+	trimmed := strings.TrimSpace(s)
+	if !strings.HasPrefix(trimmed, "{") && !strings.HasPrefix(trimmed, "[") {
+		return s, false
+	}
+	var value any
+	if err := json.Unmarshal([]byte(trimmed), &value); err != nil {
+		return s, false
+	}
+	bs, err := json.Marshal(r.redact(value, nil))
+	if err != nil {
+		return s, false
+	}
+	return string(bs), true
+}
+
+// redactTagged 对 <tag>...</tag> 之间的内容脱敏：内容整体是JSON时按结构脱敏，
+// 否则逐行处理，行中从 { 或 [ 开始到行尾是JSON时按结构脱敏，例如 "[RESULT] {...}"
+func (r *Redactor) redactTagged(s string) string {
+	var sb strings.Builder
+	for {
+		loc := redactTagRegex.FindStringSubmatchIndex(s)
+		if loc == nil {
+			break
+		}
+		closeTag := "</" + s[loc[2]:loc[3]] + ">"
+		end := strings.Index(s[loc[1]:], closeTag)
+		if end < 0 {
+			sb.WriteString(s[:loc[1]])
+			s = s[loc[1]:]
+			continue
+		}
+		inner := s[loc[1] : loc[1]+end]
+		sb.WriteString(s[:loc[1]])
+		if redacted, ok := r.redactJSON(inner); ok {
+			trimmed := strings.TrimLeftFunc(inner, unicode.IsSpace)
+			sb.WriteString(inner[:len(inner)-len(trimmed)])
+			sb.WriteString(redacted)
+			sb.WriteString(trimmed[len(strings.TrimRightFunc(trimmed, unicode.IsSpace)):])
+		} else {
+			lines := strings.Split(inner, "\n")
+			for i, line := range lines {
+				lines[i] = r.redactLineJSON(line)
+			}
+			sb.WriteString(strings.Join(lines, "\n"))
+		}
+		sb.WriteString(closeTag)
+		s = s[loc[1]+end+len(closeTag):]
+	}
+	sb.WriteString(s)
+	return sb.String()
+}
+
+// redactLineJSON 对行尾的JSON按结构脱敏
+func (r *Redactor) redactLineJSON(line string) string {
+	for i := 0; i < len(line); i++ {
+		if line[i] != '{' && line[i] != '[' {
+			continue
+		}
+		if redacted, ok := r.redactJSON(line[i:]); ok {
+			return line[:i] + redacted
+		}
+	}
+	return line
+}
+
+// RedactArgs 返回脱敏后的参数副本
+func (r *Redactor) RedactArgs(args map[string]any) map[string]any {
+	if r == nil || args == nil {
+		return args
+	}
+	redacted, _ := r.redact(args, nil).(map[string]any)
+	return redacted
+}
+
+// RedactValue 返回脱敏后的值副本。非JSON基本结构的值会先转换为JSON结构，
+// 工具返回的[]mcp.Content保持原有类型
+func (r *Redactor) RedactValue(value any) any {
+	if r == nil || value == nil {
+		return value
+	}
+	switch v := value.(type) {
+	case string:
+		return r.RedactString(v)
+	case error:
+		return r.RedactString(v.Error())
+	case []mcp.Content:
+		return r.RedactContent(v)
+	case map[string]any, []any, bool, float64, int, int64:
+		return r.redact(v, nil)
+	}
+	bs, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	var generic any
+	if err := json.Unmarshal(bs, &generic); err != nil {
+		return value
+	}
+	return r.redact(generic, nil)
+}
+
+// RedactContent 返回脱敏后的工具内容副本
+func (r *Redactor) RedactContent(contents []mcp.Content) []mcp.Content {
+	if r == nil || contents == nil {
+		return contents
+	}
+	redacted := make([]mcp.Content, 0, len(contents))
+	for _, content := range contents {
+		switch c := content.(type) {
+		case mcp.TextContent:
+			c.Text = r.RedactString(c.Text)
+			redacted = append(redacted, c)
+		case *mcp.TextContent:
+			if c == nil {
+				redacted = append(redacted, content)
+				continue
+			}
+			text := *c
+			text.Text = r.RedactString(text.Text)
+			redacted = append(redacted, &text)
+		case mcp.EmbeddedResource:
+			c.Resource = r.redactResource(c.Resource)
+			redacted = append(redacted, c)
+		case *mcp.EmbeddedResource:
+			if c == nil {
+				redacted = append(redacted, content)
+				continue
+			}
+			resource := *c
+			resource.Resource = r.redactResource(resource.Resource)
+			redacted = append(redacted, &resource)
+		default:
+			redacted = append(redacted, content)
+		}
+	}
+	return redacted
+}
+
+// redactResource 返回脱敏后的文本资源副本，其他资源不做处理
+func (r *Redactor) redactResource(resource mcp.ResourceContents) mcp.ResourceContents {
+	switch text := resource.(type) {
+	case mcp.TextResourceContents:
+		text.Text = r.RedactString(text.Text)
+		return text
+	case *mcp.TextResourceContents:
+		if text == nil {
+			return resource
+		}
+		redacted := *text
+		redacted.Text = r.RedactString(redacted.Text)
+		return &redacted
+	}
+	return resource
+}
+
+// redact 递归脱敏，path为当前位置
+func (r *Redactor) redact(value any, path []string) any {
+	if r.matchPath(path) {
+		return r.replacement
+	}
+	switch v := value.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for key, x := range v {
+			if r.matchKey(key) {
+				out[key] = r.replacement
+				continue
+			}
+			out[key] = r.redact(x, append(path[:len(path):len(path)], key))
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, x := range v {
+			out[i] = r.redact(x, append(path[:len(path):len(path)], strconv.Itoa(i)))
+		}
+		return out
+	case string:
+		return r.redactText(v)
+	}
+	return value
+}
+
+// redactText 按内容正则替换
+func (r *Redactor) redactText(s string) string {
+	for _, re := range r.valuePatterns {
+		s = re.ReplaceAllString(s, r.replacement)
+	}
+	return s
+}
+
+func (r *Redactor) matchKey(key string) bool {
+	for _, re := range r.keyPatterns {
+		if re.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Redactor) matchPath(path []string) bool {
+	if len(path) == 0 {
+		return false
+	}
+PATH_LOOP:
+	for _, tokens := range r.paths {
+		if len(tokens) != len(path) {
+			continue
+		}
+		for i, token := range tokens {
+			if token != "*" && token != path[i] {
+				continue PATH_LOOP
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// WithRedactor 设置主机的Redactor，用于审计记录，并作为MCPClient调试输出和通知的默认Redactor
+func WithRedactor(redactor *Redactor) HostOption {
+	return func(h *MCPHost) {
+		h.redactor = redactor
+	}
+}
+
+// Redactor 返回主机的Redactor，未设置时为nil
+func (h *MCPHost) Redactor() *Redactor {
+	return h.redactor
+}
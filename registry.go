@@ -0,0 +1,299 @@
+package MCP_Host
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// ServerDefinition 服务器定义，注册后在首次使用时连接
+type ServerDefinition struct {
+	Type ConnectionType
+
+	// SSE
+	BaseURL string
+	Options []transport.ClientOption
+	OAuth   *OAuthConfig // 服务器需要OAuth授权时设置
+
+	// Stdio
+	Command      string
+	Env          []string
+	Args         []string
+	StdioOptions StdioOptions
+
+	// InProcess
+	Server *server.MCPServer
+
+	// Replay
+	Cassette      *Cassette
+	ReplayOptions []ReplayOption
+
+	IdleTimeout time.Duration // 空闲超过该时间后断开连接，0表示使用WithIdleTimeout的设置
+	Tools       []mcp.Tool    // 预置的工具定义，未连接时即可作为工具目录使用
+}
+
+// serverRegistration 已注册的服务器
+type serverRegistration struct {
+	definition   ServerDefinition
+	idleTimeout  time.Duration
+	connectMutex sync.Mutex // 保证同一服务器同时只有一个连接过程
+
+	mutex     sync.Mutex
+	lastUsed  time.Time
+	inflight  int
+	idleTimer *time.Timer
+}
+
+// WithIdleTimeout 设置已注册服务器的默认空闲超时，0表示不自动断开
+func WithIdleTimeout(timeout time.Duration) HostOption {
+	return func(h *MCPHost) {
+		h.idleTimeout = timeout
+	}
+}
+
+// RegisterServer 注册服务器定义但不连接，首次ListTools或ExecuteTool时自动连接
+func (h *MCPHost) RegisterServer(serverID string, definition ServerDefinition) error {
+	switch definition.Type {
+	case SSEConnectionType:
+		if definition.BaseURL == "" {
+			return fmt.Errorf("server %s: base url is required", serverID)
+		}
+	case StdioConnectionType:
+		if definition.Command == "" {
+			return fmt.Errorf("server %s: command is required", serverID)
+		}
+	case InProcessConnectionType:
+		if definition.Server == nil {
+			return fmt.Errorf("server %s: server is required", serverID)
+		}
+	case ReplayConnectionType:
+		if definition.Cassette == nil {
+			return fmt.Errorf("server %s: cassette is required", serverID)
+		}
+	default:
+		return fmt.Errorf("server %s: unsupported connection type %q", serverID, definition.Type)
+	}
+
+	h.mutex.Lock()
+	if _, exists := h.registrations[serverID]; exists {
+		h.mutex.Unlock()
+		return fmt.Errorf("server with ID %s already registered", serverID)
+	}
+	registration := &serverRegistration{definition: definition, idleTimeout: definition.IdleTimeout}
+	if registration.idleTimeout == 0 {
+		registration.idleTimeout = h.idleTimeout
+	}
+	h.registrations[serverID] = registration
+	h.mutex.Unlock()
+
+	if definition.Tools != nil {
+		h.cacheMutex.Lock()
+		if _, ok := h.toolCache[serverID]; !ok {
+			h.toolCache[serverID] = definition.Tools
+		}
+		h.cacheMutex.Unlock()
+	}
+	return nil
+}
+
+// UnregisterServer 移除服务器定义，已连接时同时断开连接
+func (h *MCPHost) UnregisterServer(serverID string) error {
+	h.mutex.Lock()
+	registration, exists := h.registrations[serverID]
+	if !exists {
+		h.mutex.Unlock()
+		return fmt.Errorf("no server registered with ID %s", serverID)
+	}
+	delete(h.registrations, serverID)
+	_, connected := h.connections[serverID]
+	h.mutex.Unlock()
+
+	registration.stopIdleTimer()
+	if connected {
+		return h.DisconnectServer(serverID)
+	}
+	return nil
+}
+
+// ServerIDs 返回所有已连接和已注册服务器的ID
+func (h *MCPHost) ServerIDs() []string {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	serverIDs := make([]string, 0, len(h.connections)+len(h.registrations))
+	for id := range h.connections {
+		serverIDs = append(serverIDs, id)
+	}
+	for id := range h.registrations {
+		if _, connected := h.connections[id]; !connected {
+			serverIDs = append(serverIDs, id)
+		}
+	}
+	if h.parent != nil {
+		for _, id := range h.parent.ServerIDs() {
+			if !slices.Contains(serverIDs, id) {
+				serverIDs = append(serverIDs, id)
+			}
+		}
+	}
+	slices.Sort(serverIDs)
+	return serverIDs
+}
+
+// IsRegistered 判断服务器是否通过RegisterServer注册，无论当前是否已连接
+func (h *MCPHost) IsRegistered(serverID string) bool {
+	_, registered := h.owner(serverID).registration(serverID)
+	return registered
+}
+
+// owner 返回管理服务器的主机：自身没有该服务器而上级主机有时返回上级主机
+func (h *MCPHost) owner(serverID string) *MCPHost {
+	if h.parent == nil || h.hasServer(serverID) || !h.parent.hasServer(serverID) {
+		return h
+	}
+	return h.parent
+}
+
+// hasServer 判断服务器是否已连接或已注册
+func (h *MCPHost) hasServer(serverID string) bool {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	_, connected := h.connections[serverID]
+	_, registered := h.registrations[serverID]
+	return connected || registered
+}
+
+// CatalogTools 返回服务器的工具目录：已连接时重新列出工具，未连接时优先使用缓存的工具定义，
+// 没有缓存时连接服务器
+func (h *MCPHost) CatalogTools(ctx context.Context, serverID string) (*mcp.ListToolsResult, error) {
+	if _, connected := h.GetConnection(serverID); !connected {
+		if tools, ok := h.CachedTools(serverID); ok {
+			return &mcp.ListToolsResult{Tools: tools}, nil
+		}
+	}
+	return h.ListTools(ctx, serverID)
+}
+
+// connectRegistered 按注册的定义连接服务器
+func (h *MCPHost) connectRegistered(ctx context.Context, serverID string, registration *serverRegistration) (*ServerConnection, error) {
+	registration.connectMutex.Lock()
+	defer registration.connectMutex.Unlock()
+
+	if conn, exists := h.GetConnection(serverID); exists {
+		return conn, nil
+	}
+	if current, exists := h.registration(serverID); !exists || current != registration {
+		return nil, fmt.Errorf("server %s is no longer registered", serverID)
+	}
+	conn, err := h.dialRegistered(ctx, serverID, registration)
+	if err != nil {
+		return nil, err
+	}
+	// 连接期间服务器被注销时断开新建的连接，注销后的连接不再有人管理
+	if current, exists := h.registration(serverID); !exists || current != registration {
+		h.disconnect(serverID, conn)
+		return nil, fmt.Errorf("server %s is no longer registered", serverID)
+	}
+	return conn, nil
+}
+
+// dialRegistered 按注册的定义建立连接，调用方需持有connectMutex
+func (h *MCPHost) dialRegistered(ctx context.Context, serverID string, registration *serverRegistration) (*ServerConnection, error) {
+	definition := registration.definition
+	switch definition.Type {
+	case SSEConnectionType:
+		if definition.OAuth == nil {
+			return h.ConnectSSE(ctx, serverID, definition.BaseURL, definition.Options...)
+		}
+		conn, err := h.ConnectSSEWithOAuth(ctx, serverID, definition.BaseURL, *definition.OAuth, definition.Options...)
+		if err == nil {
+			// 保留动态注册得到的客户端，后续重连无需重新注册
+			registration.definition.OAuth = conn.oauth
+		}
+		return conn, err
+	case StdioConnectionType:
+		return h.ConnectStdioWithOptions(ctx, serverID, definition.Command, definition.Env, definition.StdioOptions, definition.Args...)
+	case InProcessConnectionType:
+		return h.ConnectInProcess(ctx, serverID, definition.Server)
+	case ReplayConnectionType:
+		return h.ConnectReplay(ctx, serverID, definition.Cassette, definition.ReplayOptions...)
+	default:
+		return nil, fmt.Errorf("unsupported connection type %q", definition.Type)
+	}
+}
+
+// registration 获取服务器的注册信息
+func (h *MCPHost) registration(serverID string) (*serverRegistration, bool) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	registration, exists := h.registrations[serverID]
+	return registration, exists
+}
+
+// acquire 标记服务器正在使用，返回的函数在使用结束时调用
+func (h *MCPHost) acquire(serverID string) func() {
+	registration, exists := h.registration(serverID)
+	if !exists || registration.idleTimeout <= 0 {
+		return func() {}
+	}
+
+	registration.mutex.Lock()
+	registration.inflight++
+	registration.lastUsed = time.Now()
+	registration.mutex.Unlock()
+
+	return func() {
+		registration.mutex.Lock()
+		defer registration.mutex.Unlock()
+
+		registration.inflight--
+		registration.lastUsed = time.Now()
+		if registration.idleTimer == nil {
+			registration.idleTimer = time.AfterFunc(registration.idleTimeout, func() {
+				h.closeIdle(serverID, registration)
+			})
+		} else {
+			registration.idleTimer.Reset(registration.idleTimeout)
+		}
+	}
+}
+
+// closeIdle 空闲超时后断开连接，仍在使用或期间被使用过时重新计时
+func (h *MCPHost) closeIdle(serverID string, registration *serverRegistration) {
+	// 持有connectMutex，避免与正在进行的连接过程交错
+	registration.connectMutex.Lock()
+	defer registration.connectMutex.Unlock()
+	registration.mutex.Lock()
+	defer registration.mutex.Unlock()
+
+	if registration.inflight > 0 {
+		return
+	}
+	if idle := time.Since(registration.lastUsed); idle < registration.idleTimeout {
+		registration.idleTimer.Reset(registration.idleTimeout - idle)
+		return
+	}
+	if current, exists := h.registration(serverID); !exists || current != registration {
+		return
+	}
+	if _, connected := h.GetConnection(serverID); connected {
+		h.DisconnectServer(serverID)
+	}
+}
+
+func (r *serverRegistration) stopIdleTimer() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.idleTimer != nil {
+		r.idleTimer.Stop()
+	}
+}
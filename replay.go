@@ -0,0 +1,395 @@
+package MCP_Host
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const ReplayConnectionType ConnectionType = "Replay"
+
+// ErrNoRecordedInteraction 回放时没有与请求匹配的记录
+var ErrNoRecordedInteraction = errors.New("no recorded interaction matches request")
+
+// Interaction 一次JSON-RPC请求及其响应
+type Interaction struct {
+	Method string                   `json:"method"`
+	Params json.RawMessage          `json:"params,omitempty"`
+	Result json.RawMessage          `json:"result,omitempty"`
+	Error  *mcp.JSONRPCErrorDetails `json:"error,omitempty"`
+}
+
+// Cassette 按服务器记录的JSON-RPC交互，可保存为文件用于离线回放
+type Cassette struct {
+	Servers map[string][]Interaction `json:"servers"`
+	mutex   sync.Mutex
+}
+
+// NewCassette 创建空的记录
+func NewCassette() *Cassette {
+	return &Cassette{Servers: make(map[string][]Interaction)}
+}
+
+// LoadCassette 从文件加载记录
+func LoadCassette(path string) (*Cassette, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+	c := NewCassette()
+	if err := json.Unmarshal(bs, c); err != nil {
+		return nil, fmt.Errorf("failed to parse cassette: %w", err)
+	}
+	if c.Servers == nil {
+		c.Servers = make(map[string][]Interaction)
+	}
+	return c, nil
+}
+
+// Save 将记录保存到文件，记录中可能包含工具参数和结果，文件仅所有者可读写
+func (c *Cassette) Save(path string) error {
+	c.mutex.Lock()
+	bs, err := json.MarshalIndent(c, "", "  ")
+	c.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, bs, 0o600)
+}
+
+// Interactions 返回服务器的交互记录
+func (c *Cassette) Interactions(serverID string) []Interaction {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return append([]Interaction(nil), c.Servers[serverID]...)
+}
+
+func (c *Cassette) add(serverID string, interaction Interaction) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.Servers[serverID] = append(c.Servers[serverID], interaction)
+}
+
+// WithRecorder 将所有连接的JSON-RPC交互按服务器记录到cassette中，ping请求不记录。
+// 设置了Redactor时参数和结果脱敏后记录，回放时请求参数按相同方式脱敏后匹配
+func WithRecorder(cassette *Cassette) HostOption {
+	return func(h *MCPHost) {
+		h.recorder = cassette
+	}
+}
+
+// recordClient 设置了记录器时，使用记录交互的传输层重新包装客户端，需在Start之前调用
+func (h *MCPHost) recordClient(serverID string, c *client.Client) *client.Client {
+	if h.recorder == nil {
+		return c
+	}
+	return client.NewClient(&recordingTransport{Interface: c.GetTransport(), serverID: serverID, cassette: h.recorder, redactor: h.redactor})
+}
+
+// recordingTransport 记录交互的传输层
+type recordingTransport struct {
+	transport.Interface
+	serverID string
+	cassette *Cassette
+	redactor *Redactor
+}
+
+// SendRequest 转发请求并记录请求与响应
+func (t *recordingTransport) SendRequest(ctx context.Context, request transport.JSONRPCRequest) (*transport.JSONRPCResponse, error) {
+	resp, err := t.Interface.SendRequest(ctx, request)
+	if err != nil || request.Method == string(mcp.MethodPing) {
+		return resp, err
+	}
+	params, marshalErr := json.Marshal(request.Params)
+	if marshalErr != nil || request.Params == nil {
+		params = nil
+	}
+	interaction := Interaction{
+		Method: request.Method,
+		Params: redactParams(t.redactor, request.Method, params),
+		Result: redactResult(t.redactor, request.Method, resp.Result),
+		Error:  resp.Error,
+	}
+	if interaction.Error != nil && t.redactor != nil {
+		detail := *interaction.Error
+		detail.Message = t.redactor.RedactString(detail.Message)
+		detail.Data = t.redactor.RedactValue(detail.Data)
+		interaction.Error = &detail
+	}
+	t.cassette.add(t.serverID, interaction)
+	return resp, nil
+}
+
+// redactParams 返回脱敏后的请求参数，工具调用的参数按RedactArgs处理，使按参数配置的路径规则生效
+func redactParams(r *Redactor, method string, params json.RawMessage) json.RawMessage {
+	if r == nil || len(params) == 0 {
+		return params
+	}
+	if method == string(mcp.MethodToolsCall) {
+		var call map[string]any
+		if err := json.Unmarshal(params, &call); err == nil {
+			if args, ok := call["arguments"].(map[string]any); ok {
+				call["arguments"] = r.RedactArgs(args)
+			}
+			if bs, err := json.Marshal(call); err == nil {
+				return bs
+			}
+		}
+	}
+	return json.RawMessage(r.RedactString(string(params)))
+}
+
+// redactResult 返回脱敏后的响应结果，工具调用的结果按RedactContent处理
+func redactResult(r *Redactor, method string, result json.RawMessage) json.RawMessage {
+	if r == nil || len(result) == 0 {
+		return result
+	}
+	if method == string(mcp.MethodToolsCall) {
+		if callResult, err := mcp.ParseCallToolResult(&result); err == nil {
+			callResult.Content = r.RedactContent(callResult.Content)
+			callResult.StructuredContent = r.RedactValue(callResult.StructuredContent)
+			if bs, err := json.Marshal(callResult); err == nil {
+				return bs
+			}
+		}
+	}
+	return json.RawMessage(r.RedactString(string(result)))
+}
+
+// SetRequestHandler 转发服务器发起的请求，例如采样
+func (t *recordingTransport) SetRequestHandler(handler transport.RequestHandler) {
+	if bidirectional, ok := t.Interface.(transport.BidirectionalInterface); ok {
+		bidirectional.SetRequestHandler(handler)
+	}
+}
+
+// SetProtocolVersion 转发协商后的协议版本
+func (t *recordingTransport) SetProtocolVersion(version string) {
+	if conn, ok := t.Interface.(transport.HTTPConnection); ok {
+		conn.SetProtocolVersion(version)
+	}
+}
+
+// SetConnectionLostHandler 转发连接断开的处理函数
+func (t *recordingTransport) SetConnectionLostHandler(handler func(error)) {
+	if setter, ok := t.Interface.(interface{ SetConnectionLostHandler(func(error)) }); ok {
+		setter.SetConnectionLostHandler(handler)
+	}
+}
+
+// ReplayMatcher 判断记录的参数与实际请求的参数是否匹配，参数为去除忽略字段后解码的JSON
+type ReplayMatcher func(method string, recorded any, actual any) bool
+
+// ReplayOption 回放的配置选项
+type ReplayOption func(*replayTransport)
+
+// WithIgnoredParams 匹配时忽略的参数字段，以 "." 分隔路径，例如 "arguments.request_id"。_meta始终被忽略
+func WithIgnoredParams(paths ...string) ReplayOption {
+	return func(t *replayTransport) {
+		t.ignored = append(t.ignored, paths...)
+	}
+}
+
+// WithReplayMatcher 设置自定义的参数匹配方式，默认要求完全相同
+func WithReplayMatcher(matcher ReplayMatcher) ReplayOption {
+	return func(t *replayTransport) {
+		t.matcher = matcher
+	}
+}
+
+// ConnectReplay 连接到由记录回放的服务器，不需要真实的服务器。请求按顺序匹配尚未使用的记录，
+// 全部使用过后重复使用最后一次匹配的记录
+func (h *MCPHost) ConnectReplay(ctx context.Context, serverID string, cassette *Cassette, opts ...ReplayOption) (*ServerConnection, error) {
+	h.mutex.RLock()
+	_, exists := h.connections[serverID]
+	h.mutex.RUnlock()
+	if exists {
+		return nil, fmt.Errorf("connection with ID %s already exists", serverID)
+	}
+
+	t := &replayTransport{
+		interactions: cassette.Interactions(serverID),
+		ignored:      []string{"_meta"},
+		redactor:     h.redactor,
+		matcher: func(method string, recorded any, actual any) bool {
+			return reflect.DeepEqual(recorded, actual)
+		},
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	t.used = make([]bool, len(t.interactions))
+
+	c := client.NewClient(t)
+	if err := c.Start(ctx); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("failed to start client: %w", err)
+	}
+
+	initRequest := mcp.InitializeRequest{}
+	initRequest.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	initRequest.Params.ClientInfo = mcp.Implementation{
+		Name:    "MCP Host",
+		Version: "1.0.0",
+	}
+
+	serverInfo, err := c.Initialize(ctx, initRequest)
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("failed to initialize connection: %w", err)
+	}
+
+	conn := &ServerConnection{
+		Type:         ReplayConnectionType,
+		Client:       c,
+		ServerID:     serverID,
+		ServerInfo:   serverInfo,
+		Capabilities: serverInfo.Capabilities,
+		Connected:    true,
+	}
+
+	h.mutex.Lock()
+	h.connections[serverID] = conn
+	h.mutex.Unlock()
+	h.notifyConnectionChanged(serverID, true)
+
+	return conn, nil
+}
+
+// replayTransport 从记录中返回响应的传输层
+type replayTransport struct {
+	interactions []Interaction
+	used         []bool
+	ignored      []string
+	matcher      ReplayMatcher
+	redactor     *Redactor // 与记录时相同的脱敏方式，使实际请求能匹配脱敏后的记录
+	mutex        sync.Mutex
+}
+
+// Start 实现transport.Interface
+func (t *replayTransport) Start(ctx context.Context) error {
+	return nil
+}
+
+// SendRequest 返回第一条匹配且未使用的记录，ping请求直接返回成功
+func (t *replayTransport) SendRequest(ctx context.Context, request transport.JSONRPCRequest) (*transport.JSONRPCResponse, error) {
+	if request.Method == string(mcp.MethodPing) {
+		return &transport.JSONRPCResponse{JSONRPC: mcp.JSONRPC_VERSION, ID: request.ID, Result: json.RawMessage("{}")}, nil
+	}
+	actual, err := t.normalize(request.Method, request.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	match := -1
+	for i, interaction := range t.interactions {
+		if t.used[i] || interaction.Method != request.Method {
+			continue
+		}
+		if t.matches(interaction, actual) {
+			match = i
+			break
+		}
+	}
+	if match < 0 {
+		for i := len(t.interactions) - 1; i >= 0; i-- {
+			if t.interactions[i].Method == request.Method && t.matches(t.interactions[i], actual) {
+				match = i
+				break
+			}
+		}
+	}
+	if match < 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNoRecordedInteraction, request.Method)
+	}
+	t.used[match] = true
+
+	interaction := t.interactions[match]
+	return &transport.JSONRPCResponse{
+		JSONRPC: mcp.JSONRPC_VERSION,
+		ID:      request.ID,
+		Result:  interaction.Result,
+		Error:   interaction.Error,
+	}, nil
+}
+
+func (t *replayTransport) matches(interaction Interaction, actual any) bool {
+	recorded, err := t.normalize(interaction.Method, interaction.Params)
+	if err != nil {
+		return false
+	}
+	return t.matcher(interaction.Method, recorded, actual)
+}
+
+// normalize 将参数脱敏后解码为通用JSON值并去除忽略的字段
+func (t *replayTransport) normalize(method string, params any) (any, error) {
+	var bs []byte
+	switch p := params.(type) {
+	case nil:
+		return nil, nil
+	case json.RawMessage:
+		if len(p) == 0 {
+			return nil, nil
+		}
+		bs = p
+	default:
+		var err error
+		if bs, err = json.Marshal(p); err != nil {
+			return nil, fmt.Errorf("failed to marshal params: %w", err)
+		}
+	}
+	var value any
+	if err := json.Unmarshal(redactParams(t.redactor, method, bs), &value); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal params: %w", err)
+	}
+	for _, path := range t.ignored {
+		deletePath(value, strings.Split(path, "."))
+	}
+	return value, nil
+}
+
+// deletePath 删除JSON值中的字段
+func deletePath(value any, path []string) {
+	object, ok := value.(map[string]any)
+	if !ok || len(path) == 0 {
+		return
+	}
+	if len(path) == 1 {
+		delete(object, path[0])
+		return
+	}
+	deletePath(object[path[0]], path[1:])
+}
+
+// SendNotification 实现transport.Interface，通知被忽略
+func (t *replayTransport) SendNotification(ctx context.Context, notification mcp.JSONRPCNotification) error {
+	return nil
+}
+
+// SetNotificationHandler 实现transport.Interface，回放不产生服务器通知
+func (t *replayTransport) SetNotificationHandler(handler func(notification mcp.JSONRPCNotification)) {
+}
+
+// Close 实现transport.Interface
+func (t *replayTransport) Close() error {
+	return nil
+}
+
+// GetSessionId 实现transport.Interface
+func (t *replayTransport) GetSessionId() string {
+	return ""
+}
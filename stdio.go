@@ -0,0 +1,253 @@
+package MCP_Host
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// 默认的SIGTERM到SIGKILL之间的等待时间
+const DefaultStdioKillTimeout = 5 * time.Second
+
+// StdioEnvMode 子进程环境变量的继承方式
+type StdioEnvMode int
+
+const (
+	StdioEnvInherit   StdioEnvMode = iota // 继承当前进程的全部环境变量，再追加env
+	StdioEnvClean                         // 仅使用env
+	StdioEnvAllowlist                     // 仅继承EnvAllowlist中的环境变量，再追加env
+)
+
+// StdioLimits 子进程的资源限制，0表示不限制。仅Linux支持，
+// 限制在进程启动后立即通过prlimit(2)设置，之前已经使用的CPU时间同样计入限制
+type StdioLimits struct {
+	CPUSeconds  uint64 // CPU时间（秒），RLIMIT_CPU
+	MemoryBytes uint64 // 虚拟内存（字节），RLIMIT_AS
+	OpenFiles   uint64 // 文件描述符数量，RLIMIT_NOFILE
+}
+
+// StdioNamespace 子进程使用的Linux命名空间
+type StdioNamespace int
+
+const (
+	StdioNamespaceUser  StdioNamespace = 1 << iota // 用户命名空间，当前用户映射为沙箱内的Credential
+	StdioNamespacePID                              // PID命名空间
+	StdioNamespaceNet                              // 网络命名空间，子进程无法访问网络
+	StdioNamespaceIPC                              // IPC命名空间
+	StdioNamespaceUTS                              // UTS命名空间
+	StdioNamespaceMount                            // 挂载命名空间
+)
+
+// StdioCredential 子进程的用户与组
+type StdioCredential struct {
+	UID uint32
+	GID uint32
+}
+
+// StdioSandbox 子进程的沙箱设置。仅Linux支持，除用户命名空间外通常需要root权限
+type StdioSandbox struct {
+	Credential *StdioCredential // 以指定用户运行，使用用户命名空间时为沙箱内的用户
+	Namespaces StdioNamespace   // 需要创建的命名空间
+}
+
+// StdioOptions Stdio服务器进程的启动选项
+type StdioOptions struct {
+	Dir          string        // 工作目录，默认为当前目录
+	EnvMode      StdioEnvMode  // 环境变量继承方式
+	EnvAllowlist []string      // EnvMode为StdioEnvAllowlist时继承的环境变量，支持以*结尾的前缀匹配
+	Limits       StdioLimits   // 资源限制，进程启动后立即设置
+	Sandbox      *StdioSandbox // 沙箱
+	KillTimeout  time.Duration // 关闭时发送SIGTERM后等待进程退出的时间，超时后发送SIGKILL
+	MaxLifetime  time.Duration // 进程的最长运行时间，超时后关闭进程，0表示不限制
+}
+
+// stdioProcess 由MCPHost管理的服务器进程。Linux下进程位于独立的进程组，关闭时整个进程组一起结束
+type stdioProcess struct {
+	cmd         *exec.Cmd
+	killTimeout time.Duration
+	watchdog    *time.Timer
+	exited      chan struct{} // 进程已退出，Linux下此时尚未回收
+	stopOnce    sync.Once
+}
+
+// ConnectStdioWithOptions 使用Stdio传输连接到MCP服务器，并按opts启动服务器进程
+func (h *MCPHost) ConnectStdioWithOptions(ctx context.Context, serverID string, command string, env []string, opts StdioOptions, args ...string) (*ServerConnection, error) {
+	h.mutex.RLock()
+	_, exists := h.connections[serverID]
+	h.mutex.RUnlock()
+	if exists {
+		return nil, fmt.Errorf("connection with ID %s already exists", serverID)
+	}
+
+	process, stdin, stdout, stderr, err := startStdioProcess(command, env, args, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdio client: %w", err)
+	}
+
+	c := h.recordClient(serverID, client.NewClient(transport.NewIO(stdout, stdin, stderr)))
+	if err := c.Start(context.Background()); err != nil {
+		c.Close()
+		process.stop()
+		return nil, fmt.Errorf("failed to start client: %w", err)
+	}
+
+	initRequest := mcp.InitializeRequest{}
+	initRequest.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	initRequest.Params.ClientInfo = mcp.Implementation{
+		Name:    "MCP Host",
+		Version: "1.0.0",
+	}
+
+	serverInfo, err := c.Initialize(ctx, initRequest)
+	if err != nil {
+		c.Close()
+		process.stop()
+		return nil, fmt.Errorf("failed to initialize connection: %w", err)
+	}
+
+	conn := &ServerConnection{
+		Type:         StdioConnectionType,
+		Client:       c,
+		ServerID:     serverID,
+		ServerInfo:   serverInfo,
+		Capabilities: serverInfo.Capabilities,
+		Connected:    true,
+		process:      process,
+	}
+	if opts.MaxLifetime > 0 {
+		// 超时后按断开连接的流程关闭，观察者会收到连接断开的通知；连接已被替换时只结束该进程
+		process.watchdog = time.AfterFunc(opts.MaxLifetime, func() {
+			if h.disconnect(serverID, conn) != nil {
+				process.stop()
+			}
+		})
+	}
+
+	h.mutex.Lock()
+	h.connections[serverID] = conn
+	h.mutex.Unlock()
+	h.notifyConnectionChanged(serverID, true)
+
+	return conn, nil
+}
+
+// startStdioProcess 启动服务器进程，返回与其标准输入输出相连的管道
+func startStdioProcess(command string, env []string, args []string, opts StdioOptions) (*stdioProcess, io.WriteCloser, io.ReadCloser, io.ReadCloser, error) {
+	cmd := exec.Command(command, args...)
+	cmd.Dir = opts.Dir
+	cmd.Env = stdioEnv(env, opts)
+	if err := configureStdioCommand(cmd, opts); err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	// 使用os.Pipe而非cmd.StdoutPipe，使Wait不会关闭传输层仍在读取的管道
+	stdinReader, stdinWriter, err := os.Pipe()
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("failed to create stdin pipe: %w", err)
+	}
+	stdoutReader, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		closeAll(stdinReader, stdinWriter)
+		return nil, nil, nil, nil, fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+	stderrReader, stderrWriter, err := os.Pipe()
+	if err != nil {
+		closeAll(stdinReader, stdinWriter, stdoutReader, stdoutWriter)
+		return nil, nil, nil, nil, fmt.Errorf("failed to create stderr pipe: %w", err)
+	}
+	cmd.Stdin = stdinReader
+	cmd.Stdout = stdoutWriter
+	cmd.Stderr = stderrWriter
+
+	err = cmd.Start()
+	closeAll(stdinReader, stdoutWriter, stderrWriter)
+	if err != nil {
+		closeAll(stdinWriter, stdoutReader, stderrReader)
+		return nil, nil, nil, nil, fmt.Errorf("failed to start command: %w", err)
+	}
+	if opts.Limits != (StdioLimits{}) {
+		if err := limitStdioProcess(cmd.Process.Pid, opts.Limits); err != nil {
+			signalStdioProcess(cmd.Process, true)
+			cmd.Wait()
+			closeAll(stdinWriter, stdoutReader, stderrReader)
+			return nil, nil, nil, nil, err
+		}
+	}
+
+	process := &stdioProcess{
+		cmd:         cmd,
+		killTimeout: opts.KillTimeout,
+		exited:      make(chan struct{}),
+	}
+	if process.killTimeout <= 0 {
+		process.killTimeout = DefaultStdioKillTimeout
+	}
+	go func() {
+		waitStdioExit(cmd)
+		close(process.exited)
+	}()
+
+	return process, stdinWriter, stdoutReader, stderrReader, nil
+}
+
+// stop 依次发送SIGTERM和SIGKILL结束进程，并等待进程退出。nil stdioProcess不做任何处理
+func (p *stdioProcess) stop() {
+	if p == nil {
+		return
+	}
+	p.stopOnce.Do(func() {
+		if p.watchdog != nil {
+			p.watchdog.Stop()
+		}
+		select {
+		case <-p.exited:
+		default:
+			signalStdioProcess(p.cmd.Process, false)
+			select {
+			case <-p.exited:
+			case <-time.After(p.killTimeout):
+			}
+		}
+		// 进程已退出时仍需清理进程组中残留的子进程，回收之前进程组ID不会被重用
+		signalStdioProcess(p.cmd.Process, true)
+		<-p.exited
+		reapStdioProcess(p.cmd)
+	})
+}
+
+// stdioEnv 按继承方式生成子进程的环境变量
+func stdioEnv(env []string, opts StdioOptions) []string {
+	switch opts.EnvMode {
+	case StdioEnvClean:
+		return append([]string{}, env...)
+	case StdioEnvAllowlist:
+		var result []string
+		for _, kv := range os.Environ() {
+			name, _, _ := strings.Cut(kv, "=")
+			for _, allowed := range opts.EnvAllowlist {
+				if name == allowed || (strings.HasSuffix(allowed, "*") && strings.HasPrefix(name, strings.TrimSuffix(allowed, "*"))) {
+					result = append(result, kv)
+					break
+				}
+			}
+		}
+		return append(result, env...)
+	default:
+		return append(os.Environ(), env...)
+	}
+}
+
+func closeAll(closers ...io.Closer) {
+	for _, closer := range closers {
+		closer.Close()
+	}
+}
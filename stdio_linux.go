@@ -0,0 +1,94 @@
+//go:build linux
+
+package MCP_Host
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// configureStdioCommand 设置独立的进程组和沙箱
+func configureStdioCommand(cmd *exec.Cmd, opts StdioOptions) error {
+	attr := &syscall.SysProcAttr{Setpgid: true}
+	if sandbox := opts.Sandbox; sandbox != nil {
+		attr.Cloneflags = stdioCloneflags(sandbox.Namespaces)
+		if sandbox.Namespaces&StdioNamespaceUser != 0 {
+			var uid, gid int
+			if sandbox.Credential != nil {
+				uid, gid = int(sandbox.Credential.UID), int(sandbox.Credential.GID)
+			}
+			attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: uid, HostID: os.Getuid(), Size: 1}}
+			attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: gid, HostID: os.Getgid(), Size: 1}}
+			attr.GidMappingsEnableSetgroups = false
+		} else if sandbox.Credential != nil {
+			attr.Credential = &syscall.Credential{Uid: sandbox.Credential.UID, Gid: sandbox.Credential.GID}
+		}
+	}
+	cmd.SysProcAttr = attr
+	return nil
+}
+
+// limitStdioProcess 通过prlimit(2)设置已启动的子进程的资源限制
+func limitStdioProcess(pid int, limits StdioLimits) error {
+	for _, limit := range []struct {
+		resource int
+		value    uint64
+	}{
+		{unix.RLIMIT_CPU, limits.CPUSeconds},
+		{unix.RLIMIT_AS, limits.MemoryBytes},
+		{unix.RLIMIT_NOFILE, limits.OpenFiles},
+	} {
+		if limit.value == 0 {
+			continue
+		}
+		if err := unix.Prlimit(pid, limit.resource, &unix.Rlimit{Cur: limit.value, Max: limit.value}, nil); err != nil {
+			return fmt.Errorf("failed to set resource limit %d: %w", limit.resource, err)
+		}
+	}
+	return nil
+}
+
+func stdioCloneflags(namespaces StdioNamespace) uintptr {
+	var flags uintptr
+	for namespace, flag := range map[StdioNamespace]uintptr{
+		StdioNamespaceUser:  syscall.CLONE_NEWUSER,
+		StdioNamespacePID:   syscall.CLONE_NEWPID,
+		StdioNamespaceNet:   syscall.CLONE_NEWNET,
+		StdioNamespaceIPC:   syscall.CLONE_NEWIPC,
+		StdioNamespaceUTS:   syscall.CLONE_NEWUTS,
+		StdioNamespaceMount: syscall.CLONE_NEWNS,
+	} {
+		if namespaces&namespace != 0 {
+			flags |= flag
+		}
+	}
+	return flags
+}
+
+// waitStdioExit 等待进程退出但不回收，使stop结束残留子进程时进程组ID仍然有效
+func waitStdioExit(cmd *exec.Cmd) {
+	var info unix.Siginfo
+	for {
+		if err := unix.Waitid(unix.P_PID, cmd.Process.Pid, &info, unix.WEXITED|unix.WNOWAIT, nil); err != unix.EINTR {
+			return
+		}
+	}
+}
+
+// reapStdioProcess 回收已退出的进程
+func reapStdioProcess(cmd *exec.Cmd) {
+	cmd.Wait()
+}
+
+// signalStdioProcess 向子进程所在的进程组发送SIGTERM或SIGKILL
+func signalStdioProcess(process *os.Process, kill bool) {
+	sig := syscall.SIGTERM
+	if kill {
+		sig = syscall.SIGKILL
+	}
+	syscall.Kill(-process.Pid, sig)
+}
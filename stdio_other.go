@@ -0,0 +1,42 @@
+//go:build !linux
+
+package MCP_Host
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// configureStdioCommand 非Linux平台不支持沙箱和资源限制
+func configureStdioCommand(cmd *exec.Cmd, opts StdioOptions) error {
+	if opts.Sandbox != nil {
+		return errors.New("stdio sandbox is only supported on linux")
+	}
+	if opts.Limits != (StdioLimits{}) {
+		return errors.New("stdio resource limits are only supported on linux")
+	}
+	return nil
+}
+
+// limitStdioProcess 非Linux平台不支持资源限制，configureStdioCommand已拒绝设置了限制的选项
+func limitStdioProcess(pid int, limits StdioLimits) error {
+	return nil
+}
+
+// waitStdioExit 等待进程退出并回收
+func waitStdioExit(cmd *exec.Cmd) {
+	cmd.Wait()
+}
+
+// reapStdioProcess 进程已在waitStdioExit中回收
+func reapStdioProcess(cmd *exec.Cmd) {
+}
+
+// signalStdioProcess 结束子进程，不支持SIGTERM的平台直接结束进程
+func signalStdioProcess(process *os.Process, kill bool) {
+	if kill || process.Signal(syscall.SIGTERM) != nil {
+		process.Kill()
+	}
+}
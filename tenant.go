@@ -0,0 +1,384 @@
+package MCP_Host
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrTooManySessions 租户的会话数量已达上限
+var ErrTooManySessions = errors.New("too many sessions for tenant")
+
+// ErrSessionClosed 会话已关闭
+var ErrSessionClosed = errors.New("tenant session is closed")
+
+// TenantServerFunc 为租户生成服务器定义，例如使用该租户自己的凭据
+type TenantServerFunc func(ctx context.Context, tenantID string) (ServerDefinition, error)
+
+// TenantManager 多租户会话管理。无状态服务器在共享主机上由所有租户共用，
+// 按租户的服务器在每个租户自己的主机上独立连接
+type TenantManager struct {
+	shared        *MCPHost
+	tenantServers map[string]TenantServerFunc
+	hostOptions   []HostOption
+	maxSessions   int
+	idleTimeout   time.Duration
+
+	tenants  map[string]*tenant
+	creating map[string]chan struct{} // 正在创建主机的租户，创建结束时关闭
+	mutex    sync.Mutex
+}
+
+// tenant 一个租户的主机和会话
+type tenant struct {
+	host     *MCPHost
+	sessions map[string]*TenantSession
+}
+
+// TenantSession 租户的一个会话
+type TenantSession struct {
+	ID       string
+	TenantID string
+
+	manager  *TenantManager
+	host     *MCPHost
+	lastUsed time.Time
+	timer    *time.Timer
+	closed   bool
+	mutex    sync.Mutex
+}
+
+// TenantManagerOption TenantManager的配置选项
+type TenantManagerOption func(*TenantManager)
+
+// WithTenantServer 注册按租户连接的服务器，fn在租户首次创建会话时调用，服务器在首次使用时连接
+func WithTenantServer(serverID string, fn TenantServerFunc) TenantManagerOption {
+	return func(m *TenantManager) {
+		m.tenantServers[serverID] = fn
+	}
+}
+
+// WithTenantHostOptions 设置创建租户主机时使用的选项，例如审计、观察者和空闲超时
+func WithTenantHostOptions(opts ...HostOption) TenantManagerOption {
+	return func(m *TenantManager) {
+		m.hostOptions = append(m.hostOptions, opts...)
+	}
+}
+
+// WithMaxSessionsPerTenant 设置每个租户的最大会话数量，0表示不限制
+func WithMaxSessionsPerTenant(max int) TenantManagerOption {
+	return func(m *TenantManager) {
+		m.maxSessions = max
+	}
+}
+
+// WithSessionIdleTimeout 会话空闲超过该时间后自动关闭，0表示不自动关闭
+func WithSessionIdleTimeout(timeout time.Duration) TenantManagerOption {
+	return func(m *TenantManager) {
+		m.idleTimeout = timeout
+	}
+}
+
+// NewTenantManager 创建多租户会话管理，shared为共享服务器所在的主机
+func NewTenantManager(shared *MCPHost, opts ...TenantManagerOption) *TenantManager {
+	m := &TenantManager{
+		shared:        shared,
+		tenantServers: make(map[string]TenantServerFunc),
+		tenants:       make(map[string]*tenant),
+		creating:      make(map[string]chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// NewSession 为租户创建会话，租户的第一个会话会创建租户主机。
+// 创建租户主机时在锁外调用TenantServerFunc，较慢时不会阻塞其他租户，同一租户的并发请求等待其完成
+func (m *TenantManager) NewSession(ctx context.Context, tenantID string) (*TenantSession, error) {
+	for {
+		m.mutex.Lock()
+		if t, exists := m.tenants[tenantID]; exists {
+			defer m.mutex.Unlock()
+			return m.addSession(t, tenantID)
+		}
+		creating, waiting := m.creating[tenantID]
+		if !waiting {
+			creating = make(chan struct{})
+			m.creating[tenantID] = creating
+		}
+		m.mutex.Unlock()
+
+		if waiting {
+			select {
+			case <-creating:
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		host, err := m.newTenantHost(ctx, tenantID)
+		m.mutex.Lock()
+		delete(m.creating, tenantID)
+		close(creating)
+		if err != nil {
+			m.mutex.Unlock()
+			return nil, err
+		}
+		t := &tenant{host: host, sessions: make(map[string]*TenantSession)}
+		m.tenants[tenantID] = t
+		defer m.mutex.Unlock()
+		return m.addSession(t, tenantID)
+	}
+}
+
+// addSession 在租户中创建会话，调用方需持有锁
+func (m *TenantManager) addSession(t *tenant, tenantID string) (*TenantSession, error) {
+	if m.maxSessions > 0 && len(t.sessions) >= m.maxSessions {
+		return nil, fmt.Errorf("%w: %s", ErrTooManySessions, tenantID)
+	}
+
+	session := &TenantSession{
+		ID:       newSessionID(),
+		TenantID: tenantID,
+		manager:  m,
+		host:     t.host,
+		lastUsed: time.Now(),
+	}
+	if m.idleTimeout > 0 {
+		// 持有会话的锁创建计时器，使回调中的closeIfIdle在赋值后才能访问timer
+		session.mutex.Lock()
+		session.timer = time.AfterFunc(m.idleTimeout, session.closeIfIdle)
+		session.mutex.Unlock()
+	}
+	t.sessions[session.ID] = session
+	return session, nil
+}
+
+// newTenantHost 创建租户主机并注册按租户连接的服务器
+func (m *TenantManager) newTenantHost(ctx context.Context, tenantID string) (*MCPHost, error) {
+	host := NewMCPHost(m.hostOptions...)
+	host.parent = m.shared
+	host.activity = &hostActivity{lastUsed: time.Now()}
+	for serverID, fn := range m.tenantServers {
+		definition, err := fn(ctx, tenantID)
+		if err != nil {
+			return nil, fmt.Errorf("tenant %s: failed to define server %s: %w", tenantID, serverID, err)
+		}
+		if err := host.RegisterServer(serverID, definition); err != nil {
+			return nil, fmt.Errorf("tenant %s: %w", tenantID, err)
+		}
+	}
+	return host, nil
+}
+
+// Session 获取租户的会话并刷新其空闲时间
+func (m *TenantManager) Session(tenantID string, sessionID string) (*TenantSession, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	t, exists := m.tenants[tenantID]
+	if !exists {
+		return nil, false
+	}
+	session, exists := t.sessions[sessionID]
+	if !exists {
+		return nil, false
+	}
+	session.Touch()
+	return session, true
+}
+
+// Sessions 返回租户的会话数量
+func (m *TenantManager) Sessions(tenantID string) int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if t, exists := m.tenants[tenantID]; exists {
+		return len(t.sessions)
+	}
+	return 0
+}
+
+// CloseTenant 关闭租户的所有会话并断开其连接
+func (m *TenantManager) CloseTenant(tenantID string) {
+	m.mutex.Lock()
+	t, exists := m.tenants[tenantID]
+	delete(m.tenants, tenantID)
+	m.mutex.Unlock()
+
+	if exists {
+		for _, session := range t.sessions {
+			session.markClosed()
+		}
+		m.closeTenantHost(t.host)
+	}
+}
+
+// closeTenantHost 注销租户的服务器并断开连接，仍持有租户主机的调用方无法再重新连接
+func (m *TenantManager) closeTenantHost(host *MCPHost) {
+	host.mutex.RLock()
+	serverIDs := make([]string, 0, len(host.registrations))
+	for serverID := range host.registrations {
+		serverIDs = append(serverIDs, serverID)
+	}
+	host.mutex.RUnlock()
+
+	for _, serverID := range serverIDs {
+		host.UnregisterServer(serverID)
+	}
+	host.DisconnectAll()
+}
+
+// Close 关闭所有租户，共享主机不受影响
+func (m *TenantManager) Close() {
+	m.mutex.Lock()
+	tenantIDs := make([]string, 0, len(m.tenants))
+	for id := range m.tenants {
+		tenantIDs = append(tenantIDs, id)
+	}
+	m.mutex.Unlock()
+
+	for _, id := range tenantIDs {
+		m.CloseTenant(id)
+	}
+}
+
+// removeSession 移除会话，租户没有会话时断开租户主机的连接
+func (m *TenantManager) removeSession(session *TenantSession) {
+	m.mutex.Lock()
+	t, exists := m.tenants[session.TenantID]
+	if !exists || t.sessions[session.ID] != session {
+		m.mutex.Unlock()
+		return
+	}
+	delete(t.sessions, session.ID)
+	empty := len(t.sessions) == 0
+	if empty {
+		delete(m.tenants, session.TenantID)
+	}
+	m.mutex.Unlock()
+
+	if empty {
+		m.closeTenantHost(t.host)
+	}
+}
+
+// Host 返回会话使用的主机，可直接用于llm.NewMCPClient。会话已关闭时返回ErrSessionClosed
+func (s *TenantSession) Host() (*MCPHost, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return nil, ErrSessionClosed
+	}
+	s.lastUsed = time.Now()
+	return s.host, nil
+}
+
+// Context 在上下文中设置租户和会话，审计记录中分别作为主体和会话ID
+func (s *TenantSession) Context(ctx context.Context) context.Context {
+	ctx = ContextWithPrincipal(ctx, s.TenantID)
+	return ContextWithConversationID(ctx, s.ID)
+}
+
+// Touch 刷新会话的空闲时间
+func (s *TenantSession) Touch() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.lastUsed = time.Now()
+}
+
+// Close 关闭会话
+func (s *TenantSession) Close() {
+	if s.markClosed() {
+		s.manager.removeSession(s)
+	}
+}
+
+// markClosed 标记会话已关闭，返回是否为首次关闭
+func (s *TenantSession) markClosed() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return false
+	}
+	s.closed = true
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	return true
+}
+
+// closeIfIdle 空闲超时后关闭会话。租户主机上仍有操作在进行，或期间会话或主机被使用过时重新计时
+func (s *TenantSession) closeIfIdle() {
+	busy, lastUsed := s.host.activity.state()
+	s.mutex.Lock()
+	if s.lastUsed.After(lastUsed) {
+		lastUsed = s.lastUsed
+	}
+	if busy {
+		s.timer.Reset(s.manager.idleTimeout)
+		s.mutex.Unlock()
+		return
+	}
+	if idle := time.Since(lastUsed); idle < s.manager.idleTimeout {
+		s.timer.Reset(s.manager.idleTimeout - idle)
+		s.mutex.Unlock()
+		return
+	}
+	s.mutex.Unlock()
+	s.Close()
+}
+
+// hostActivity 租户主机上的操作，会话据此判断是否空闲
+type hostActivity struct {
+	mutex    sync.Mutex
+	inflight int
+	lastUsed time.Time
+}
+
+// use 标记主机上的一次操作开始，返回的函数在操作结束时调用。未记录操作的主机不做处理
+func (h *MCPHost) use() func() {
+	a := h.activity
+	if a == nil {
+		return func() {}
+	}
+	a.mutex.Lock()
+	a.inflight++
+	a.lastUsed = time.Now()
+	a.mutex.Unlock()
+
+	return func() {
+		a.mutex.Lock()
+		defer a.mutex.Unlock()
+
+		a.inflight--
+		a.lastUsed = time.Now()
+	}
+}
+
+// state 返回是否有操作正在进行以及最近一次使用的时间
+func (a *hostActivity) state() (bool, time.Time) {
+	if a == nil {
+		return false, time.Time{}
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return a.inflight > 0, a.lastUsed
+}
+
+// newSessionID 生成随机会话ID
+func newSessionID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
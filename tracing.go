@@ -0,0 +1,104 @@
+package MCP_Host
+
+import (
+	"context"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 追踪器名称
+const tracerName = "github.com/longdexin/MCP_Host"
+
+// GenAI语义约定中使用的属性名
+const (
+	AttrGenAIOperationName = "gen_ai.operation.name"
+	AttrGenAIToolName      = "gen_ai.tool.name"
+	AttrGenAIToolType      = "gen_ai.tool.type"
+	AttrMCPServerID        = "mcp.server.id"
+	AttrMCPConnectionType  = "mcp.connection.type"
+	AttrMCPToolIsError     = "mcp.tool.is_error"
+)
+
+// WithTracerProvider 设置链路追踪的TracerProvider，默认使用全局TracerProvider
+func WithTracerProvider(provider trace.TracerProvider) HostOption {
+	return func(h *MCPHost) {
+		h.tracerProvider = provider
+	}
+}
+
+// WithPropagator 设置向MCP服务器传播追踪上下文的传播器，默认使用W3C Trace Context
+func WithPropagator(propagator propagation.TextMapPropagator) HostOption {
+	return func(h *MCPHost) {
+		h.propagator = propagator
+	}
+}
+
+// tracer 返回主机使用的追踪器
+func (h *MCPHost) tracer() trace.Tracer {
+	provider := h.tracerProvider
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return provider.Tracer(tracerName)
+}
+
+// startToolSpan 开始一个工具执行span
+func (h *MCPHost) startToolSpan(ctx context.Context, serverID string, toolName string) (context.Context, trace.Span) {
+	return h.tracer().Start(ctx, "execute_tool "+toolName,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String(AttrGenAIOperationName, "execute_tool"),
+			attribute.String(AttrGenAIToolName, toolName),
+			attribute.String(AttrGenAIToolType, "function"),
+			attribute.String(AttrMCPServerID, serverID),
+		),
+	)
+}
+
+// startReconnectSpan 开始一个重连span
+func (h *MCPHost) startReconnectSpan(ctx context.Context, conn *ServerConnection) (context.Context, trace.Span) {
+	return h.tracer().Start(ctx, "mcp.reconnect",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String(AttrMCPServerID, conn.ServerID),
+			attribute.String(AttrMCPConnectionType, string(conn.Type)),
+		),
+	)
+}
+
+// endSpan 根据错误设置span状态并结束span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// injectTraceMeta 将追踪上下文写入请求的_meta
+func (h *MCPHost) injectTraceMeta(ctx context.Context, meta *mcp.Meta) *mcp.Meta {
+	propagator := h.propagator
+	if propagator == nil {
+		propagator = propagation.TraceContext{}
+	}
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return meta
+	}
+	if meta == nil {
+		meta = &mcp.Meta{}
+	}
+	if meta.AdditionalFields == nil {
+		meta.AdditionalFields = make(map[string]any, len(carrier))
+	}
+	for k, v := range carrier {
+		meta.AdditionalFields[k] = v
+	}
+	return meta
+}